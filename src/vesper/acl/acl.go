@@ -0,0 +1,249 @@
+// Package acl holds network access control lists of endpoints - CIDRs
+// that requests to an endpoint are allowed from, and denied from.
+//
+// The lists are read from a file. An endpoint is a path, or a path prefix
+// ending with "/*" - which matches its base path too. The rule of the endpoint
+// that matches a request path exactly wins, then the rule of the longest
+// matching prefix, then the "default" rule, if any
+//
+//	{
+//	  "routes": {
+//	    "/stir/v1/signing/*": {"allow": ["10.1.0.0/16"]},
+//	    "/stir/v1/admin/*": {"allow": ["10.9.0.0/24"], "deny": ["10.9.0.13"]},
+//	    "default": {"deny": ["192.0.2.0/24"]}
+//	  }
+//	}
+//
+// A request is denied if its client IP is in deny, or if allow is not empty and
+// the client IP is not in allow.
+//
+// This data structure is thread safe.
+package acl
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"sync"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+// Rule - CIDRs (or IP addresses) requests are allowed from and denied from
+type Rule struct {
+	Allow	[]string	`json:"allow"`
+	Deny	[]string	`json:"deny"`
+}
+
+type rule struct {
+	allow	[]*net.IPNet
+	deny	[]*net.IPNet
+}
+
+// ACL - access control lists by endpoint
+type ACL struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file					string
+	modifiedTime	int64
+	paths					map[string]rule
+	prefixes			map[string]rule
+	required			[]string
+}
+
+// Initialize object
+// Saves file modified time for future use
+func InitObject(f string) (*ACL, error) {
+	if len(strings.TrimSpace(f)) == 0 {
+		return nil, fmt.Errorf("file name (with ACLs) is an empty string")
+	}
+	a := &ACL{file: f}
+	if err := a.UpdateACL(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// UpdateACL reads the ACL file only if its modified time has changed. The
+// current lists are kept on failure
+func (a *ACL) UpdateACL() error {
+	fi, err := os.Stat(a.file)
+	if err != nil {
+		return fmt.Errorf("%v - ACL file", err)
+	}
+	m := fi.ModTime().Unix()
+	a.RLock()
+	same := a.modifiedTime == m
+	a.RUnlock()
+	if same {
+		return nil
+	}
+	b, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		return fmt.Errorf("%v - ACL file", err)
+	}
+	paths, prefixes, err := parse(b)
+	if err != nil {
+		return err
+	}
+	a.Lock()
+	defer a.Unlock()
+	n := &ACL{paths: paths, prefixes: prefixes}
+	for _, p := range a.required {
+		if !n.restricted(p) {
+			return fmt.Errorf("%v MUST have an allow list - ACL file", p)
+		}
+	}
+	a.paths = paths
+	a.prefixes = prefixes
+	a.modifiedTime = m
+	return nil
+}
+
+// Allowed returns true if a request to path from ip is allowed
+func (a *ACL) Allowed(path string, ip net.IP) bool {
+	a.RLock()
+	defer a.RUnlock()
+	r, ok := a.rule(path)
+	if !ok {
+		return true
+	}
+	if ip == nil {
+		return len(r.allow) == 0 && len(r.deny) == 0
+	}
+	if contains(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || contains(r.allow, ip)
+}
+
+// Restricted returns true if requests to path are allowed only from the CIDRs
+// of an allow list
+func (a *ACL) Restricted(path string) bool {
+	a.RLock()
+	defer a.RUnlock()
+	return a.restricted(path)
+}
+
+// Require makes path required to be restricted - an updated ACL file in which
+// it is not is rejected, and the current lists are kept. Returns false if path
+// is not restricted now
+func (a *ACL) Require(path string) bool {
+	a.Lock()
+	defer a.Unlock()
+	if !a.restricted(path) {
+		return false
+	}
+	a.required = append(a.required, path)
+	return true
+}
+
+// restricted - caller holds the lock
+func (a *ACL) restricted(path string) bool {
+	r, ok := a.rule(path)
+	return ok && len(r.allow) > 0
+}
+
+// Size returns the number of endpoints with a rule
+func (a *ACL) Size() int {
+	a.RLock()
+	defer a.RUnlock()
+	return len(a.paths) + len(a.prefixes)
+}
+
+// rule returns the rule of path - caller holds the lock
+func (a *ACL) rule(path string) (rule, bool) {
+	r, ok := a.paths[path]
+	if !ok {
+		r, ok = a.match(path)
+	}
+	if !ok {
+		r, ok = a.paths["default"]
+	}
+	return r, ok
+}
+
+// match returns the rule of the longest prefix of path - caller holds the lock.
+// A prefix matches its own base path too (/stir/v1/signing/* matches
+// /stir/v1/signing)
+func (a *ACL) match(path string) (rule, bool) {
+	if r, ok := a.prefixes[strings.TrimSuffix(path, "/") + "/"]; ok {
+		return r, true
+	}
+	for p := path; len(p) > 0; {
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+		if r, ok := a.prefixes[p + "/"]; ok {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(b []byte) (map[string]rule, map[string]rule, error) {
+	var c struct {
+		Routes map[string]Rule `json:"routes"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("%v - decode JSON object in ACL file", err)
+	}
+	paths := make(map[string]rule)
+	prefixes := make(map[string]rule)
+	for p, v := range c.Routes {
+		if p != "default" && !strings.HasPrefix(p, "/") {
+			return nil, nil, fmt.Errorf("ACL endpoint %v MUST be a path or \"default\"", p)
+		}
+		var r rule
+		var err error
+		if r.allow, err = cidrs(v.Allow); err != nil {
+			return nil, nil, fmt.Errorf("%v - ACL of %v", err, p)
+		}
+		if r.deny, err = cidrs(v.Deny); err != nil {
+			return nil, nil, fmt.Errorf("%v - ACL of %v", err, p)
+		}
+		if strings.HasSuffix(p, "/*") {
+			prefixes[strings.TrimSuffix(p, "*")] = r
+		} else {
+			paths[p] = r
+		}
+	}
+	return paths, prefixes, nil
+}
+
+func cidrs(l []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(l))
+	for _, c := range l {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("%v MUST be a CIDR or an IP address", c)
+			}
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("%v MUST be a CIDR or an IP address", c)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
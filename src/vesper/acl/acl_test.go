@@ -0,0 +1,100 @@
+package acl
+
+import (
+	"os"
+	"net"
+	"time"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestAllowed(t *testing.T) {
+	paths, prefixes, err := parse([]byte(`{
+		"routes": {
+			"/stir/v1/signing": {"allow": ["10.1.0.0/16"]},
+			"/stir/v1/admin/*": {"allow": ["10.9.0.0/24"], "deny": ["10.9.0.13"]},
+			"/stir/v1/admin/origids/*": {"allow": ["10.8.0.0/24"]},
+			"/stir/v1/messaging/*": {"allow": ["10.7.0.0/24"]},
+			"default": {"deny": ["192.0.2.0/24"]}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &ACL{paths: paths, prefixes: prefixes}
+	if n := a.Size(); n != 5 {
+		t.Errorf("Size() = %v - want 5", n)
+	}
+	for _, c := range []struct {
+		path	string
+		ip		string
+		want	bool
+	}{
+		{"/stir/v1/signing", "10.1.2.3", true},
+		{"/stir/v1/signing", "10.2.2.3", false},
+		{"/stir/v1/admin/tns", "10.9.0.1", true},
+		{"/stir/v1/admin/tns/12025551212", "10.9.0.13", false},
+		{"/stir/v1/admin/origids/x", "10.9.0.1", false},
+		{"/stir/v1/admin/origids/x", "10.8.0.1", true},
+		{"/stir/v1/admin/origids", "10.8.0.1", true},
+		{"/stir/v1/admin/origids", "10.9.0.1", false},
+		{"/stir/v1/messaging", "10.7.0.1", true},
+		{"/stir/v1/messaging/", "10.1.0.1", false},
+		{"/stir/v1/verification", "192.0.2.1", false},
+		{"/stir/v1/verification", "198.51.100.1", true},
+	} {
+		if got := a.Allowed(c.path, net.ParseIP(c.ip)); got != c.want {
+			t.Errorf("Allowed(%v, %v) = %v - want %v", c.path, c.ip, got, c.want)
+		}
+	}
+}
+
+func TestRestricted(t *testing.T) {
+	paths, prefixes, _ := parse([]byte(`{
+		"routes": {
+			"/sip/signing": {"allow": ["10.1.0.0/16"]},
+			"/sip/verification": {"deny": ["192.0.2.0/24"]}
+		}
+	}`))
+	a := &ACL{paths: paths, prefixes: prefixes}
+	if !a.Restricted("/sip/signing") || a.Restricted("/sip/verification") || a.Restricted("/stir/v1/signing") {
+		t.Errorf("Restricted() - want only /sip/signing restricted")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, b := range []string{
+		`{"routes": {"stir/v1/signing": {}}}`,
+		`{"routes": {"/stir/v1/signing": {"allow": ["10.0.0.0/33"]}}}`,
+		`{"routes": {"/stir/v1/signing": {"deny": ["bogus"]}}}`,
+		`[]`,
+	} {
+		if _, _, err := parse([]byte(b)); err == nil {
+			t.Errorf("parse(%v) - want error", b)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "acl.json")
+	ioutil.WriteFile(f, []byte(`{"routes": {"/sip/signing": {"allow": ["10.1.0.0/16"]}}}`), 0644)
+	a, err := InitObject(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Require("/sip/verification") || !a.Require("/sip/signing") {
+		t.Errorf("Require() - want only /sip/signing required")
+	}
+	// a reload without an allow list for a required path is rejected
+	ioutil.WriteFile(f, []byte(`{"routes": {"/sip/signing": {"deny": ["192.0.2.0/24"]}}}`), 0644)
+	os.Chtimes(f, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if err := a.UpdateACL(); err == nil || !a.Restricted("/sip/signing") || a.Allowed("/sip/signing", net.ParseIP("192.0.2.1")) {
+		t.Errorf("UpdateACL() = %v - want error, current lists kept", err)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"vesper/stats"
+)
+
+// accessControl wraps the HTTP handler of all endpoints. With ACLs (acl_file)
+// configured, requests from client IPs that are not allowed to use an endpoint
+// are denied, counted and logged
+func accessControl(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if accessControlLists == nil {
+			h.ServeHTTP(response, request)
+			return
+		}
+		clientIP := getClientIP(request)
+		if !accessControlLists.Allowed(request.URL.Path, net.ParseIP(clientIP)) {
+			stats.IncrAclDeniedCount()
+			rejectClient(response, request, clientIP, "", http.StatusForbidden, "VESPER-4320", "client IP " + clientIP + " is not allowed to use " + request.URL.Path)
+			return
+		}
+		h.ServeHTTP(response, request)
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"time"
+	"strconv"
+	"net/url"
+	"net/http"
+	"github.com/httprouter"
+	"vesper/audit"
+	"vesper/analytics"
+	"vesper/publickeys"
+)
+
+// recordOutcome aggregates a verification decision by signer - the SPC of the
+// certificate of the x5u and the domain of the x5u - and attest, if analytics
+// is enabled
+func recordOutcome(e audit.Entry) {
+	// a call without a PASSporT is neither verified nor failed
+	if analyticsStore == nil || e.Result == "unverified" {
+		return
+	}
+	o := analytics.Outcome{Time: time.Now(), Attest: e.Attest, Verified: e.Result == "verified", ReasonCode: e.ReasonCode}
+	if len(e.X5u) > 0 {
+		o.SPC = publickeys.SPC(e.X5u)
+		if u, err := url.Parse(e.X5u); err == nil {
+			o.Domain = u.Hostname()
+		}
+	}
+	analyticsStore.Add(o)
+}
+
+// getVerificationAnalytics - top signers (by spc or domain) or attest levels of
+// verification outcomes, optionally in a time range (query from and to, in
+// seconds)
+func getVerificationAnalytics(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "verificationAnalytics")
+	if !ok {
+		return
+	}
+	v := request.URL.Query()
+	q := analytics.Query{By: v.Get("by"), OrderBy: v.Get("order"), SPC: v.Get("spc"), Domain: v.Get("domain"), Attest: v.Get("attest")}
+	if len(q.By) == 0 {
+		q.By = "spc"
+	}
+	var err error
+	if s := v.Get("from"); len(s) > 0 {
+		if q.From, err = strconv.ParseInt(s, 10, 64); err != nil || q.From <= 0 {
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4612", "from and to in query MUST be times in seconds, > 0", nil)
+			return
+		}
+	}
+	if s := v.Get("to"); len(s) > 0 {
+		if q.To, err = strconv.ParseInt(s, 10, 64); err != nil || q.To <= 0 || q.To < q.From {
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4612", "from and to in query MUST be times in seconds, > 0, with from <= to", nil)
+			return
+		}
+	}
+	if s := v.Get("limit"); len(s) > 0 {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 1 || q.Limit > 1000 {
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4613", "limit in query MUST be 1 to 1000", nil)
+			return
+		}
+	}
+	if err := analytics.ValidateQuery(&q); err != nil {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4611", err.Error(), nil)
+		return
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{"by": q.By, "order": q.OrderBy, "from": q.From, "to": q.To, "rows": analyticsStore.Find(q)})
+}
@@ -0,0 +1,225 @@
+// Package analytics aggregates verification outcomes by signer - the SPC (OCN)
+// of the certificate of the x5u, the domain of the x5u - and by attest, per
+// hour, for top-N reports over time ranges (e.g. signers with the most failed
+// or C-attested calls).
+//
+// Aggregates are kept in memory, for a retention period.
+//
+// This data structure is thread safe.
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Outcome - a verification outcome
+type Outcome struct {
+	Time				time.Time
+	SPC					string
+	Domain			string
+	Attest			string
+	Verified		bool
+	ReasonCode	string
+}
+
+// Row - aggregate of a signer (SPC or domain) or an attest level
+type Row struct {
+	Key					string						`json:"key"`
+	Total				int64							`json:"total"`
+	Verified		int64							`json:"verified"`
+	Failed			int64							`json:"failed"`
+	FailedRate	float64						`json:"failedRate"`						// percentage
+	Attest			map[string]int64	`json:"attest"`
+	ReasonCodes	map[string]int64	`json:"reasonCodes,omitempty"`
+}
+
+// Query - top-N query. From and To are times in seconds, 0 if open
+type Query struct {
+	By					string		// "spc", "domain" or "attest"
+	OrderBy			string		// "total", "verified", "failed", "failedRate", "A", "B" or "C"
+	From				int64
+	To					int64
+	Limit				int
+	SPC					string		// filters
+	Domain			string
+	Attest			string
+}
+
+type key struct {
+	spc			string
+	domain	string
+	attest	string
+}
+
+type counts struct {
+	verified		int64
+	failed			int64
+	reasonCodes	map[string]int64
+}
+
+// Store - aggregates by hour
+type Store struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	retention		time.Duration
+	hours				map[int64]map[key]*counts		// by unix time / 3600
+}
+
+// Unknown - SPC, domain or attest that is not known (e.g. verification failed
+// before the signature was verified)
+const Unknown = "unknown"
+
+var groupings = map[string]bool{"spc": true, "domain": true, "attest": true}
+var orders = map[string]bool{"total": true, "verified": true, "failed": true, "failedRate": true, "A": true, "B": true, "C": true}
+
+// Initialize object
+// Aggregates are kept for retentionDays
+func InitObject(retentionDays int) (*Store, error) {
+	if retentionDays < 1 {
+		return nil, fmt.Errorf("analytics retention MUST be at least 1 day")
+	}
+	return &Store{retention: time.Duration(retentionDays) * 24 * time.Hour, hours: make(map[int64]map[key]*counts)}, nil
+}
+
+// Add aggregates an outcome
+func (s *Store) Add(o Outcome) {
+	k := key{spc: orUnknown(o.SPC), domain: orUnknown(o.Domain), attest: orUnknown(o.Attest)}
+	h := o.Time.Unix() / 3600
+	s.Lock()
+	defer s.Unlock()
+	hour, ok := s.hours[h]
+	if !ok {
+		hour = make(map[key]*counts)
+		s.hours[h] = hour
+	}
+	c, ok := hour[k]
+	if !ok {
+		c = &counts{reasonCodes: make(map[string]int64)}
+		hour[k] = c
+	}
+	if o.Verified {
+		c.verified++
+	} else {
+		c.failed++
+	}
+	if len(o.ReasonCode) > 0 {
+		c.reasonCodes[o.ReasonCode]++
+	}
+}
+
+// ValidateQuery checks a query, and sets defaults - order by total, limit 10
+func ValidateQuery(q *Query) error {
+	if !groupings[q.By] {
+		return fmt.Errorf("by MUST be \"spc\", \"domain\" or \"attest\"")
+	}
+	if len(q.OrderBy) == 0 {
+		q.OrderBy = "total"
+	}
+	if !orders[q.OrderBy] {
+		return fmt.Errorf("order MUST be \"total\", \"verified\", \"failed\", \"failedRate\", \"A\", \"B\" or \"C\"")
+	}
+	if q.From < 0 || q.To < 0 || (q.To > 0 && q.To < q.From) {
+		return fmt.Errorf("from and to MUST be times in seconds, with from <= to")
+	}
+	if q.Limit == 0 {
+		q.Limit = 10
+	}
+	if q.Limit < 1 {
+		return fmt.Errorf("limit MUST be at least 1")
+	}
+	return nil
+}
+
+// Find returns the top q.Limit rows of a (validated) query. Hours that overlap
+// the time range are included
+func (s *Store) Find(q Query) []Row {
+	rows := make(map[string]*Row)
+	s.RLock()
+	for h, hour := range s.hours {
+		if (q.From > 0 && (h + 1) * 3600 <= q.From) || (q.To > 0 && h * 3600 > q.To) {
+			continue
+		}
+		for k, c := range hour {
+			if (len(q.SPC) > 0 && k.spc != q.SPC) || (len(q.Domain) > 0 && k.domain != q.Domain) || (len(q.Attest) > 0 && k.attest != q.Attest) {
+				continue
+			}
+			var g string
+			switch q.By {
+			case "spc":
+				g = k.spc
+			case "domain":
+				g = k.domain
+			default:
+				g = k.attest
+			}
+			r, ok := rows[g]
+			if !ok {
+				r = &Row{Key: g, Attest: make(map[string]int64), ReasonCodes: make(map[string]int64)}
+				rows[g] = r
+			}
+			r.Verified += c.verified
+			r.Failed += c.failed
+			r.Attest[k.attest] += c.verified + c.failed
+			for rc, n := range c.reasonCodes {
+				r.ReasonCodes[rc] += n
+			}
+		}
+	}
+	s.RUnlock()
+	l := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		r.Total = r.Verified + r.Failed
+		if r.Total > 0 {
+			r.FailedRate = float64(int64(float64(r.Failed) / float64(r.Total) * 10000)) / 100
+		}
+		l = append(l, *r)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		a, b := value(l[i], q.OrderBy), value(l[j], q.OrderBy)
+		if a != b {
+			return a > b
+		}
+		return l[i].Key < l[j].Key
+	})
+	if len(l) > q.Limit {
+		l = l[:q.Limit]
+	}
+	return l
+}
+
+// RemoveExpired removes aggregates older than the retention period
+func (s *Store) RemoveExpired(now time.Time) {
+	oldest := now.Add(-s.retention).Unix() / 3600
+	s.Lock()
+	defer s.Unlock()
+	for h := range s.hours {
+		if h < oldest {
+			delete(s.hours, h)
+		}
+	}
+}
+
+func value(r Row, orderBy string) float64 {
+	switch orderBy {
+	case "verified":
+		return float64(r.Verified)
+	case "failed":
+		return float64(r.Failed)
+	case "failedRate":
+		return r.FailedRate
+	case "A", "B", "C":
+		return float64(r.Attest[orderBy])
+	}
+	return float64(r.Total)
+}
+
+func orUnknown(s string) string {
+	if len(s) == 0 {
+		return Unknown
+	}
+	return s
+}
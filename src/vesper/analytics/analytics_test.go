@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"time"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	s, err := InitObject(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	add := func(n int, o Outcome) {
+		for i := 0; i < n; i++ {
+			s.Add(o)
+		}
+	}
+	add(5, Outcome{Time: now, SPC: "1234", Domain: "cert.a.com", Attest: "A", Verified: true})
+	add(3, Outcome{Time: now, SPC: "1234", Domain: "cert.a.com", Attest: "C", Verified: true})
+	add(4, Outcome{Time: now, SPC: "5678", Domain: "cert.b.com", Attest: "C", ReasonCode: "VESPER-4166"})
+	add(1, Outcome{Time: now.Add(-3*time.Hour), SPC: "9999", Domain: "cert.c.com", Attest: "C", ReasonCode: "VESPER-4160"})
+	add(1, Outcome{Time: now, ReasonCode: "VESPER-4100"})
+
+	q := Query{By: "spc", OrderBy: "failed", From: now.Add(-time.Hour).Unix()}
+	if err := ValidateQuery(&q); err != nil {
+		t.Fatal(err)
+	}
+	rows := s.Find(q)
+	if len(rows) != 3 || rows[0].Key != "5678" || rows[0].Failed != 4 || rows[0].FailedRate != 100 || rows[0].ReasonCodes["VESPER-4166"] != 4 {
+		t.Fatalf("Find(%+v) = %+v", q, rows)
+	}
+	if rows[1].Key != Unknown || rows[2].Key != "1234" || rows[2].Total != 8 || rows[2].Attest["C"] != 3 {
+		t.Errorf("Find(%+v) = %+v", q, rows)
+	}
+
+	q = Query{By: "domain", OrderBy: "C", Limit: 1}
+	ValidateQuery(&q)
+	if rows := s.Find(q); len(rows) != 1 || rows[0].Key != "cert.b.com" || rows[0].Attest["C"] != 4 {
+		t.Errorf("Find(%+v) = %+v", q, rows)
+	}
+
+	q = Query{By: "attest", Attest: "C"}
+	ValidateQuery(&q)
+	if rows := s.Find(q); len(rows) != 1 || rows[0].Total != 8 {
+		t.Errorf("Find(%+v) = %+v", q, rows)
+	}
+
+	s.RemoveExpired(now.Add(24 * time.Hour))
+	q = Query{By: "spc"}
+	ValidateQuery(&q)
+	if rows := s.Find(q); len(rows) != 3 {
+		t.Errorf("Find() after RemoveExpired = %+v - want the last 24 hours", rows)
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	for _, q := range []Query{
+		{By: "ocn"},
+		{By: "spc", OrderBy: "D"},
+		{By: "spc", From: 10, To: 5},
+		{By: "spc", Limit: -1},
+	} {
+		if err := ValidateQuery(&q); err == nil {
+			t.Errorf("ValidateQuery(%+v) - want error", q)
+		}
+	}
+}
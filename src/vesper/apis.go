@@ -4,44 +4,41 @@ package main
 
 import (
 	"net/http"
-	"strings"
-	"net"
 	"encoding/json"
 	"github.com/httprouter"
 	"github.com/satori/go.uuid"
 	"vesper/stats"
 )
 
-// getClientIP returns client's real public IP address from http request headers.
+// getClientIP returns client's real public IP address. Forwarding headers
+// (Forwarded, X-Forwarded-For, X-Real-Ip) are honored only if the request comes
+// from a trusted proxy (trusted_proxies)
 func getClientIP(r *http.Request) string {
-	// Fetch header value
-	xRealIP := r.Header.Get("X-Real-Ip")
-	xForwardedFor := r.Header.Get("X-Forwarded-For")
-
-	// If both are empty, lookip IP from remote address
-	if xRealIP == "" && xForwardedFor == "" {
-		var remoteIP string
+	return trustedProxies.ClientIP(r.RemoteAddr, r.Header)
+}
 
-		// If colon in remote address, remove the port number
-		// otherwise, return remote address as is
-		if strings.ContainsRune(r.RemoteAddr, ':') {
-			remoteIP, _, _ = net.SplitHostPort(r.RemoteAddr)
-		} else {
-			remoteIP = r.RemoteAddr
-		}
-		return remoteIP
+// Retrieves all stats
+func getStats(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	resp := stats.Stats()
+	if len(rateLimiters) > 0 {
+		resp["clientUsage"] = rateLimitUsage()
 	}
-	// Check list of IPs in X-Forwarded-For and return the first address
-	for _, address := range strings.Split(xForwardedFor, ",") {
-		address = strings.TrimSpace(address)
-		return address
+	if eventPipeline != nil {
+		resp["events"] = eventPipeline.Stats()
 	}
-	// If not X-Forwarded-For or RemoteAddr, return X-Real-IP
-	return xRealIP
+	response.WriteHeader(http.StatusOK)
+	json.NewEncoder(response).Encode(resp)
 }
 
-// Retrieves all stats
-func getStats(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+// Retrieves stats of the last minute, 5 minutes and hour, by endpoint
+func getStatsWindows(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
 	response.Header().Set("Access-Control-Allow-Origin", "*")
 	response.Header().Set("Content-Type", "application/json")
 	traceID := request.Header.Get("Trace-Id")
@@ -50,7 +47,7 @@ func getStats(response http.ResponseWriter, request *http.Request, _ httprouter.
 	}
 	response.Header().Set("Trace-Id", traceID)
 	response.WriteHeader(http.StatusOK)
-	json.NewEncoder(response).Encode(stats.Stats())
+	json.NewEncoder(response).Encode(stats.Windows())
 }
 
 // Resets all stats
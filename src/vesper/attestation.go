@@ -0,0 +1,101 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"net/http"
+	"vesper/attestpolicy"
+	"vesper/configuration"
+)
+
+// callOrigin extracts what is known about the origin of a call - customer,
+// trunk and gateway - from a signing request payload, for the attestation
+// policy and the origid registry. The fields are removed from the payload, so
+// that the payload has the fields expected by validatePayload.
+// The customer MUST be one of the customers of the client of request, if the
+// client is authenticated by certificate.
+// Returns nil if neither an attestation policy nor an origid registry is
+// configured
+func callOrigin(r map[string]interface{}, request *http.Request) (*attestpolicy.Request, int, string, error) {
+	if attestPolicy == nil && origIDRegistry == nil {
+		return nil, http.StatusOK, "", nil
+	}
+	var req attestpolicy.Request
+	if v, ok := r["customer"]; ok {
+		s, ok := v.(string)
+		if !ok || len(strings.TrimSpace(s)) == 0 {
+			return nil, http.StatusBadRequest, "VESPER-4040", fmt.Errorf("customer field in request payload MUST be a non-empty string")
+		}
+		if !clientServes(request, s) {
+			return nil, http.StatusForbidden, "VESPER-4047", fmt.Errorf("customer %v is not a customer of client %v", s, clientIdentity(request))
+		}
+		req.Customer = s
+		delete(r, "customer")
+	}
+	if v, ok := r["trunk"]; ok {
+		s, ok := v.(string)
+		if !ok || len(strings.TrimSpace(s)) == 0 {
+			return nil, http.StatusBadRequest, "VESPER-4041", fmt.Errorf("trunk field in request payload MUST be a non-empty string")
+		}
+		req.Trunk = s
+		delete(r, "trunk")
+	}
+	if v, ok := r["gateway"]; ok {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, http.StatusBadRequest, "VESPER-4042", fmt.Errorf("gateway field in request payload MUST be a boolean")
+		}
+		req.Gateway = b
+		delete(r, "gateway")
+	}
+	// orig TN is validated by validatePayload
+	if o, ok := r["orig"].(map[string]interface{}); ok {
+		req.OrigTN, _ = o["tn"].(string)
+	}
+	return &req, http.StatusOK, "", nil
+}
+
+// applyAttestPolicy decides attest in a signing request payload from the
+// attestation policy, for the origin of the call. attest is set to the decided
+// level.
+// Returns nil if no attestation policy is configured
+func applyAttestPolicy(r map[string]interface{}, req *attestpolicy.Request) (*attestpolicy.Decision, int, string, error) {
+	if attestPolicy == nil {
+		return nil, http.StatusOK, "", nil
+	}
+	var requested string
+	if v, ok := r["attest"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			// validatePayload reports it
+			return nil, http.StatusOK, "", nil
+		}
+		requested = s
+	}
+	d, ok := attestPolicy.Apply(*req, requested, configuration.ConfigurationInstance().AttestPolicyDowngrade)
+	if !ok {
+		return &d, http.StatusForbidden, "VESPER-4043", fmt.Errorf("attest %v in request payload is not supported by attestation policy - %v", requested, d.Reason)
+	}
+	r["attest"] = d.Attest
+	return &d, http.StatusOK, "", nil
+}
+
+// applyOrigIDRegistry sets origid in a signing request payload to the origid
+// registered for the customer (and trunk) of the call, if origid is not in the
+// payload
+func applyOrigIDRegistry(r map[string]interface{}, req *attestpolicy.Request) (string, error) {
+	if origIDRegistry == nil || len(req.Customer) == 0 {
+		return "", nil
+	}
+	if _, ok := r["origid"]; ok {
+		return "", nil
+	}
+	e, ok := origIDRegistry.Lookup(req.Customer, req.Trunk)
+	if !ok {
+		return "VESPER-4045", fmt.Errorf("no origid registered for customer %v trunk %v", req.Customer, req.Trunk)
+	}
+	r["origid"] = e.OrigID
+	return "", nil
+}
@@ -0,0 +1,211 @@
+// Package attestpolicy decides the SHAKEN attestation level of a call from
+// configured policy (ATIS-1000074 section 5.2.3)
+//
+//	A - the customer is authenticated and has the right to use the orig TN
+//	B - the customer is authenticated, but its right to use the orig TN is not
+//	    established
+//	C - the call entered the network at a gateway, or the customer is unknown
+//
+// The policy is read from a file
+//
+//	{
+//	  "customers": {
+//	    "acme": {
+//	      "trunks": ["acme-trunk-1"],
+//	      "tns": ["12155551212"],
+//	      "prefixes": ["1215555"],
+//	      "maxAttest": "A"
+//	    }
+//	  }
+//	}
+//
+// This data structure is thread safe.
+package attestpolicy
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+// Customer - policy for a customer
+type Customer struct {
+	Trunks		[]string	`json:"trunks"`			// trunks the customer is authenticated on. Any trunk if empty
+	TNs				[]string	`json:"tns"`				// TNs assigned to the customer
+	Prefixes	[]string	`json:"prefixes"`		// TN blocks assigned to the customer
+	MaxAttest	string		`json:"maxAttest"`		// highest attestation level for the customer. "A" if empty
+}
+
+// Request - what is known about the origin of a call
+type Request struct {
+	Customer	string
+	Trunk			string
+	Gateway		bool
+	OrigTN		string
+}
+
+// Decision - attestation level and the reason for it
+type Decision struct {
+	Attest		string	`json:"attest"`
+	Requested	string	`json:"requested,omitempty"`
+	Reason		string	`json:"reason"`
+}
+
+// Ownership reports whether a TN is assigned to a customer, by means other than
+// the policy file (e.g. a TN inventory)
+type Ownership func(customer, tn string) bool
+
+// Policy - attestation policy
+type Policy struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file					string
+	modifiedTime	int64
+	customers			map[string]Customer
+	ownership			Ownership
+}
+
+// rank of attestation levels - A is the highest
+var rank = map[string]int{"A": 3, "B": 2, "C": 1}
+
+// Initialize object
+// Saves file modified time for future use
+func InitObject(f string) (*Policy, error) {
+	if len(strings.TrimSpace(f)) == 0 {
+		return nil, fmt.Errorf("file name (with attestation policy) is an empty string")
+	}
+	p := &Policy{file: f}
+	if err := p.UpdatePolicy(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetOwnership adds a source of TN ownership, consulted if the policy file does
+// not assign the orig TN to the customer
+func (p *Policy) SetOwnership(o Ownership) {
+	p.Lock()
+	defer p.Unlock()
+	p.ownership = o
+}
+
+// UpdatePolicy reads the policy file only if its modified time has changed.
+// The current policy is kept on failure
+func (p *Policy) UpdatePolicy() error {
+	fi, err := os.Stat(p.file)
+	if err != nil {
+		return fmt.Errorf("%v - attestation policy file", err)
+	}
+	m := fi.ModTime().Unix()
+	p.RLock()
+	same := p.modifiedTime == m
+	p.RUnlock()
+	if same {
+		return nil
+	}
+	b, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		return fmt.Errorf("%v - attestation policy file", err)
+	}
+	c, err := parse(b)
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.customers = c
+	p.modifiedTime = m
+	return nil
+}
+
+func parse(b []byte) (map[string]Customer, error) {
+	var c struct {
+		Customers map[string]Customer `json:"customers"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%v - decode JSON object in attestation policy file", err)
+	}
+	for k, v := range c.Customers {
+		if len(v.MaxAttest) == 0 {
+			v.MaxAttest = "A"
+			c.Customers[k] = v
+		}
+		if _, ok := rank[v.MaxAttest]; !ok {
+			return nil, fmt.Errorf("customer %v - maxAttest %v MUST be \"A\", \"B\" or \"C\"", k, v.MaxAttest)
+		}
+	}
+	return c.Customers, nil
+}
+
+// Decide computes the attestation level of a call
+func (p *Policy) Decide(r Request) Decision {
+	p.RLock()
+	c, ok := p.customers[r.Customer]
+	o := p.ownership
+	p.RUnlock()
+	switch {
+	case r.Gateway:
+		return Decision{Attest: "C", Reason: "call originated at a gateway"}
+	case len(r.Customer) == 0:
+		return Decision{Attest: "C", Reason: "customer not identified"}
+	case !ok:
+		return Decision{Attest: "C", Reason: fmt.Sprintf("customer %v not in attestation policy", r.Customer)}
+	case len(c.Trunks) > 0 && !contains(c.Trunks, r.Trunk):
+		return Decision{Attest: "C", Reason: fmt.Sprintf("trunk %v is not a trunk of customer %v", r.Trunk, r.Customer)}
+	}
+	d := Decision{Attest: "A", Reason: fmt.Sprintf("orig TN is assigned to customer %v", r.Customer)}
+	if !owns(c, r.OrigTN) && (o == nil || !o(r.Customer, r.OrigTN)) {
+		d = Decision{Attest: "B", Reason: fmt.Sprintf("orig TN is not assigned to customer %v", r.Customer)}
+	}
+	if rank[d.Attest] > rank[c.MaxAttest] {
+		d = Decision{Attest: c.MaxAttest, Reason: fmt.Sprintf("%v; capped at maxAttest %v", d.Reason, c.MaxAttest)}
+	}
+	return d
+}
+
+// Apply decides the attestation level of a call for a requested level. A
+// requested level lower than the policy allows is kept. A higher one is
+// downgraded if downgrade is true, and refused (ok is false) otherwise
+func (p *Policy) Apply(r Request, requested string, downgrade bool) (Decision, bool) {
+	d := p.Decide(r)
+	if len(requested) == 0 {
+		return d, true
+	}
+	d.Requested = requested
+	switch {
+	case rank[requested] <= rank[d.Attest]:
+		d.Attest = requested
+		d.Reason = "requested attest is supported by policy - " + d.Reason
+		return d, true
+	case downgrade:
+		d.Reason = "requested attest downgraded - " + d.Reason
+		return d, true
+	}
+	d.Reason = "requested attest is not supported by policy - " + d.Reason
+	return d, false
+}
+
+func owns(c Customer, tn string) bool {
+	if contains(c.TNs, tn) {
+		return true
+	}
+	for _, v := range c.Prefixes {
+		if len(v) > 0 && strings.HasPrefix(tn, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package attestpolicy
+
+import (
+	"testing"
+)
+
+const policy = `{
+  "customers": {
+    "acme": {"trunks": ["acme-1"], "tns": ["12155551212"], "prefixes": ["1215666"]},
+    "resold": {"prefixes": ["1267"], "maxAttest": "B"}
+  }
+}`
+
+func TestDecide(t *testing.T) {
+	c, err := parse([]byte(policy))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	p := &Policy{customers: c}
+	tests := []struct {
+		r				Request
+		attest	string
+	}{
+		{Request{Customer: "acme", Trunk: "acme-1", OrigTN: "12155551212"}, "A"},
+		{Request{Customer: "acme", Trunk: "acme-1", OrigTN: "12156660000"}, "A"},
+		{Request{Customer: "acme", Trunk: "acme-1", OrigTN: "12155550000"}, "B"},
+		{Request{Customer: "acme", Trunk: "other", OrigTN: "12155551212"}, "C"},
+		{Request{Customer: "acme", Trunk: "acme-1", Gateway: true, OrigTN: "12155551212"}, "C"},
+		{Request{Customer: "unknown", OrigTN: "12155551212"}, "C"},
+		{Request{Customer: "resold", OrigTN: "12675550000"}, "B"},
+	}
+	for _, v := range tests {
+		if d := p.Decide(v.r); d.Attest != v.attest {
+			t.Errorf("%+v - got %v (%v), expected %v", v.r, d.Attest, d.Reason, v.attest)
+		}
+	}
+	p.SetOwnership(func(customer, tn string) bool { return customer == "acme" && tn == "12155550000" })
+	if d := p.Decide(Request{Customer: "acme", Trunk: "acme-1", OrigTN: "12155550000"}); d.Attest != "A" {
+		t.Errorf("ownership not consulted - got %v", d.Attest)
+	}
+	if _, err := parse([]byte(`{"customers": {"x": {"maxAttest": "D"}}}`)); err == nil {
+		t.Errorf("invalid maxAttest accepted")
+	}
+}
+
+func TestApply(t *testing.T) {
+	c, _ := parse([]byte(policy))
+	p := &Policy{customers: c}
+	r := Request{Customer: "acme", Trunk: "acme-1", OrigTN: "12155550000"}
+	if d, ok := p.Apply(r, "", false); !ok || d.Attest != "B" {
+		t.Errorf("got %v %v, expected B", d.Attest, ok)
+	}
+	if d, ok := p.Apply(r, "C", false); !ok || d.Attest != "C" || d.Requested != "C" {
+		t.Errorf("lower requested attest not kept - %+v", d)
+	}
+	if d, ok := p.Apply(r, "A", true); !ok || d.Attest != "B" || d.Requested != "A" {
+		t.Errorf("requested attest not downgraded - %+v", d)
+	}
+	if _, ok := p.Apply(r, "A", false); ok {
+		t.Errorf("unsupported requested attest accepted")
+	}
+}
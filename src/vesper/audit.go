@@ -0,0 +1,105 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"time"
+	"net/http"
+	"io/ioutil"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"vesper/audit"
+)
+
+// recordDecision records a signing or verification decision (typ "signing" or
+// "verification"), of a request started at start, in the request metrics, in
+// verification analytics, as an event and in the audit log, if enabled. A
+// failure to record does not fail the request - it is logged
+func recordDecision(response http.ResponseWriter, typ string, start time.Time, e audit.Entry) {
+	observeOutcome(response, e.ReasonCode, e.Attest)
+	if typ == "verification" {
+		recordOutcome(e)
+	}
+	publishEvent(typ, start, e)
+	if auditLog == nil {
+		return
+	}
+	if err := auditLog.Append(typ, e); err != nil {
+		logError("type", "auditLog", "traceID", e.TraceID, "message", fmt.Sprintf("%v - unable to record in audit log", err))
+	}
+}
+
+// auditCommand - vesper audit verify [-cert file] [-from-seq n] dir
+// Verifies the chain of the audit log in dir and reports the first broken link.
+// The chain MUST start with seq 1 or, with -from-seq, with seq n.
+// With -cert, seal signatures are verified with the public key of the
+// certificate (PEM). Returns the exit code
+func auditCommand(args []string) int {
+	if len(args) < 1 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: vesper audit verify [-cert file] [-from-seq n] dir")
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	certFile := fs.String("cert", "", "certificate (PEM) to verify seal signatures with")
+	fromSeq := fs.Int64("from-seq", 0, "seq of the first record, if earlier segments were removed")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 || *fromSeq < 0 {
+		fmt.Fprintln(os.Stderr, "usage: vesper audit verify [-cert file] [-from-seq n] dir")
+		return 2
+	}
+	var k *ecdsa.PublicKey
+	if len(*certFile) > 0 {
+		var err error
+		if k, err = certPublicKey(*certFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if fi, err := os.Stat(fs.Arg(0)); err != nil || !fi.IsDir() {
+		fmt.Fprintf(os.Stderr, "%v is not an audit log directory\n", fs.Arg(0))
+		return 2
+	}
+	rep, err := audit.Verify(fs.Arg(0), k, *fromSeq)
+	if bl, ok := err.(*audit.BrokenLink); ok {
+		fmt.Printf("BROKEN - first broken link: %v\n", bl)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Printf("OK - %v records in %v segments, %v seals, from seq %v\n", rep.Records, rep.Segments, rep.Seals, rep.FirstSeq)
+	if k == nil {
+		fmt.Println("seal signatures not verified (no -cert)")
+	}
+	for _, f := range rep.Unsealed {
+		fmt.Printf("segment %v is not sealed\n", f)
+	}
+	for _, f := range rep.Torn {
+		fmt.Printf("segment %v has a truncated last line\n", f)
+	}
+	return 0
+}
+
+func certPublicKey(f string) (*ecdsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%v - no PEM certificate", f)
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%v - %v", f, err)
+	}
+	k, ok := c.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%v - public key is not an ECDSA key", f)
+	}
+	return k, nil
+}
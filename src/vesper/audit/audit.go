@@ -0,0 +1,255 @@
+// Package audit is the tamper-evident audit log of signing and verification
+// decisions.
+//
+// Records are hash chained - each record carries the hash of the previous one,
+// and its own hash covers all its fields, so that altering, removing or
+// inserting a record breaks the chain. The log is written in segments, one
+// file per segment, audit-<start time>.log, one JSON object per line. The
+// chain continues across segments. A segment is closed with a seal - a record
+// with the ES256 signature of the hash of the last record, made with the
+// signing key of vesper.
+//
+// This data structure is thread safe.
+package audit
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"bufio"
+	"math/big"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"path/filepath"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/base64"
+)
+
+// Entry - a signing, verification or CPS decision
+type Entry struct {
+	TraceID			string		`json:"traceID"`
+	Client			string		`json:"client,omitempty"`
+	Result			string		`json:"result"`										// "signed", "refused", "verified", "failed", "unverified", "published" or "retrieved"
+	ReasonCode	string		`json:"reasonCode,omitempty"`
+	Orig				string		`json:"orig,omitempty"`
+	Dest				[]string	`json:"dest,omitempty"`
+	Attest			string		`json:"attest,omitempty"`
+	OrigID			string		`json:"origid,omitempty"`
+	Iat					int64			`json:"iat,omitempty"`
+	X5u					string		`json:"x5u,omitempty"`
+}
+
+// Record - a line of the audit log
+type Record struct {
+	Seq				int64		`json:"seq"`
+	Time			int64		`json:"time"`
+	Type			string	`json:"type"`									// "signing", "verification", "cpsPublish", "cpsRetrieve" or "seal"
+	Entry			*Entry	`json:"entry,omitempty"`
+	X5u				string	`json:"x5u,omitempty"`				// seal - x5u of the signing key
+	Signature	string	`json:"signature,omitempty"`	// seal - signature of prev
+	Prev			string	`json:"prev"`
+	Hash			string	`json:"hash,omitempty"`
+}
+
+// Signer returns the x5u and private key segments are sealed with
+type Signer func() (string, *ecdsa.PrivateKey)
+
+// Log - audit log
+type Log struct {
+	sync.Mutex		// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	dir			string
+	signer	Signer
+	file		*os.File
+	seq			int64
+	prev		string
+}
+
+// fixed width, so that segments sort by name
+const layout = "20060102T150405.000000000Z"
+
+// Initialize object
+// The chain is continued from the last record of the last segment in dir. A
+// new segment is started. Segments are not sealed if signer is nil
+func InitObject(dir string, signer Signer) (*Log, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("%v - audit log directory", err)
+	}
+	l := &Log{dir: dir, signer: signer}
+	segments, err := Segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	// the last segment may hold no record, or only a torn line
+	for i := len(segments) - 1; i >= 0; i-- {
+		last, err := lastRecord(segments[i])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq, l.prev = last.Seq, last.Hash
+			break
+		}
+	}
+	if err := l.open(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append adds a decision of type typ ("signing", "verification", "cpsPublish" or "cpsRetrieve")
+func (l *Log) Append(typ string, e Entry) error {
+	l.Lock()
+	defer l.Unlock()
+	return l.write(&Record{Time: time.Now().Unix(), Type: typ, Entry: &e})
+}
+
+// Rotate seals the current segment and starts a new one
+func (l *Log) Rotate() error {
+	l.Lock()
+	defer l.Unlock()
+	if err := l.seal(); err != nil {
+		return err
+	}
+	return l.open(time.Now())
+}
+
+// Close seals the current segment
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.seal()
+	l.file.Close()
+	l.file = nil
+	return err
+}
+
+// seal - caller holds the lock
+func (l *Log) seal() error {
+	if l.signer == nil {
+		return nil
+	}
+	x5u, p := l.signer()
+	if p == nil {
+		return fmt.Errorf("no signing key to seal audit log segment with")
+	}
+	sig, err := sign(p, l.prev)
+	if err != nil {
+		return err
+	}
+	return l.write(&Record{Time: time.Now().Unix(), Type: "seal", X5u: x5u, Signature: sig})
+}
+
+// write chains and appends a record - caller holds the lock
+func (l *Log) write(r *Record) error {
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	r.Seq, r.Prev = l.seq + 1, l.prev
+	h, err := hash(r)
+	if err != nil {
+		return err
+	}
+	r.Hash = h
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%v - audit log segment", err)
+	}
+	l.seq, l.prev = r.Seq, r.Hash
+	return nil
+}
+
+// open starts a new segment - caller holds the lock
+func (l *Log) open(t time.Time) error {
+	if l.file != nil {
+		l.file.Close()
+	}
+	f := filepath.Join(l.dir, "audit-" + t.UTC().Format(layout) + ".log")
+	fd, err := os.OpenFile(f, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("%v - audit log segment", err)
+	}
+	l.file = fd
+	return nil
+}
+
+// Segments returns the segment files in dir, oldest first
+func Segments(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// lastRecord returns the last record of a segment, nil if it has none. Lines
+// that do not parse (e.g. the last line, truncated by a crash) are skipped
+func lastRecord(f string) (*Record, error) {
+	fd, err := os.Open(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v - audit log segment", err)
+	}
+	defer fd.Close()
+	var last *Record
+	s := bufio.NewScanner(fd)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var r Record
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			continue
+		}
+		last = &r
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%v - audit log segment %v", err, f)
+	}
+	return last, nil
+}
+
+// hash of a record - SHA-256 of its JSON form without hash, in hex
+func hash(r *Record) (string, error) {
+	c := *r
+	c.Hash = ""
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// sign returns the ES256 signature (r || s, base64url) of s
+func sign(p *ecdsa.PrivateKey, s string) (string, error) {
+	h := sha256.Sum256([]byte(s))
+	r, t, err := ecdsa.Sign(rand.Reader, p, h[:])
+	if err != nil {
+		return "", fmt.Errorf("%v - unable to seal audit log segment", err)
+	}
+	b := make([]byte, 64)
+	rb, tb := r.Bytes(), t.Bytes()
+	copy(b[32-len(rb):32], rb)
+	copy(b[64-len(tb):], tb)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// verifySignature verifies an ES256 signature of s
+func verifySignature(k *ecdsa.PublicKey, s, sig string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || len(b) != 64 {
+		return false
+	}
+	h := sha256.Sum256([]byte(s))
+	return ecdsa.Verify(k, h[:], new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:]))
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := func() (string, *ecdsa.PrivateKey) { return "https://cert.example.com/cert.pem", p }
+	l, err := InitObject(dir, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append("signing", Entry{TraceID: "1", Result: "signed", Orig: "12155551212", Dest: []string{"12155551213"}, Attest: "A"})
+	l.Append("verification", Entry{TraceID: "2", Result: "failed", ReasonCode: "VESPER-4166"})
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	l.Append("signing", Entry{TraceID: "3", Result: "signed"})
+	l.Close()
+	// the chain is continued after a restart
+	l, err = InitObject(dir, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append("signing", Entry{TraceID: "4", Result: "signed"})
+	l.Close()
+
+	rep, err := Verify(dir, &p.PublicKey, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Segments != 3 || rep.Records != 7 || rep.Seals != 3 || rep.FirstSeq != 1 || len(rep.Unsealed) != 0 {
+		t.Errorf("Verify() = %+v - want 3 segments, 7 records, 3 seals, from seq 1", rep)
+	}
+	// seals made with another key
+	o, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := Verify(dir, &o.PublicKey, 0); err == nil {
+		t.Errorf("Verify() with another key - want error")
+	}
+
+	// a torn last line is reported, and the chain is continued after a restart
+	segments, _ := Segments(dir)
+	fd, err := os.OpenFile(segments[2], os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Write([]byte(`{"seq":8,"ti`))
+	fd.Close()
+	if l, err = InitObject(dir, signer); err != nil {
+		t.Fatal(err)
+	}
+	l.Append("signing", Entry{TraceID: "5", Result: "signed"})
+	l.Close()
+	rep, err = Verify(dir, &p.PublicKey, 0)
+	if err != nil || rep.Records != 9 || len(rep.Torn) != 1 || rep.Torn[0] != segments[2] {
+		t.Errorf("Verify() with a torn line = %+v, %v - want 9 records, segment %v torn", rep, err, segments[2])
+	}
+	// earlier segments removed
+	segments, _ = Segments(dir)
+	first, _ := ioutil.ReadFile(segments[0])
+	os.Remove(segments[0])
+	if _, err := Verify(dir, nil, 0); err == nil {
+		t.Errorf("Verify() without the first segment - want error")
+	}
+	if rep, err := Verify(dir, nil, 4); err != nil || rep.FirstSeq != 4 {
+		t.Errorf("Verify() from seq 4 = %+v, %v - want first seq 4", rep, err)
+	}
+	if _, err := Verify(dir, nil, 3); err == nil {
+		t.Errorf("Verify() from seq 3 - want error")
+	}
+	ioutil.WriteFile(segments[0], first, 0640)
+
+	// alter the second record
+	b, _ := ioutil.ReadFile(segments[0])
+	ioutil.WriteFile(segments[0], []byte(strings.Replace(string(b), "VESPER-4166", "VESPER-4167", 1)), 0640)
+	_, err = Verify(dir, nil, 0)
+	bl, ok := err.(*BrokenLink)
+	if !ok || bl.Line != 2 || bl.Seq != 2 {
+		t.Errorf("Verify() of altered record = %v - want broken link at line 2", err)
+	}
+	// remove the second record - the third does not chain to the first
+	lines := strings.SplitAfter(string(b), "\n")
+	ioutil.WriteFile(segments[0], []byte(lines[0] + lines[2]), 0640)
+	_, err = Verify(dir, nil, 0)
+	if bl, ok := err.(*BrokenLink); !ok || bl.Line != 2 || bl.Seq != 3 {
+		t.Errorf("Verify() with removed record = %v - want broken link at line 2", err)
+	}
+}
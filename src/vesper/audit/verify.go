@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"os"
+	"fmt"
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/json"
+)
+
+// Report - result of verifying an audit log
+type Report struct {
+	Segments	int
+	Records		int64
+	Seals			int
+	FirstSeq	int64
+	Unsealed	[]string		// segments without a seal as last record
+	Torn			[]string		// segments with a truncated last line (e.g. after a crash)
+}
+
+// BrokenLink - the first record that does not chain to the previous one
+type BrokenLink struct {
+	File		string
+	Line		int
+	Seq			int64
+	Reason	string
+}
+
+func (b *BrokenLink) Error() string {
+	return fmt.Sprintf("%v line %v (seq %v) - %v", b.File, b.Line, b.Seq, b.Reason)
+}
+
+// Verify checks the chain of the segments in dir. If k is not nil, seal
+// signatures are verified with it. The chain MUST start with seq 1 and an empty
+// prev or, if fromSeq > 0 (earlier segments were removed), with seq fromSeq. A
+// truncated last line of a segment is reported, not broken - the chain is
+// continued from the record before it. A *BrokenLink is returned for the first
+// broken link
+func Verify(dir string, k *ecdsa.PublicKey, fromSeq int64) (*Report, error) {
+	segments, err := Segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{}
+	var seq int64
+	var prev string
+	first := true
+	for _, f := range segments {
+		fd, err := os.Open(f)
+		if err != nil {
+			return rep, err
+		}
+		rep.Segments++
+		sealed := false
+		s := bufio.NewScanner(fd)
+		s.Buffer(make([]byte, 64*1024), 1024*1024)
+		torn := 0
+		for line := 1; s.Scan(); line++ {
+			var r Record
+			if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+				// only the last line may be torn
+				if torn == 0 {
+					torn = line
+					continue
+				}
+				fd.Close()
+				return rep, &BrokenLink{File: f, Line: torn, Seq: seq + 1, Reason: fmt.Sprintf("%v - unable to parse record", err)}
+			}
+			if torn > 0 {
+				fd.Close()
+				return rep, &BrokenLink{File: f, Line: torn, Seq: seq + 1, Reason: "unable to parse record"}
+			}
+			broken := func(reason string) error {
+				fd.Close()
+				return &BrokenLink{File: f, Line: line, Seq: r.Seq, Reason: reason}
+			}
+			if first {
+				rep.FirstSeq = r.Seq
+				switch {
+				case fromSeq > 0 && r.Seq != fromSeq:
+					return rep, broken(fmt.Sprintf("first seq %v is not seq %v", r.Seq, fromSeq))
+				case fromSeq == 0 && (r.Seq != 1 || len(r.Prev) > 0):
+					return rep, broken(fmt.Sprintf("first record (seq %v) is not seq 1 with an empty prev - earlier records are missing", r.Seq))
+				}
+			} else {
+				if r.Seq != seq + 1 {
+					return rep, broken(fmt.Sprintf("seq %v does not follow seq %v", r.Seq, seq))
+				}
+				if r.Prev != prev {
+					return rep, broken("prev does not match hash of previous record")
+				}
+			}
+			h, err := hash(&r)
+			if err != nil {
+				return rep, broken(err.Error())
+			}
+			if h != r.Hash {
+				return rep, broken("hash does not match record")
+			}
+			sealed = r.Type == "seal"
+			if sealed {
+				if k != nil && !verifySignature(k, r.Prev, r.Signature) {
+					return rep, broken("seal signature is not valid")
+				}
+				rep.Seals++
+			}
+			seq, prev, first = r.Seq, r.Hash, false
+			rep.Records++
+		}
+		err = s.Err()
+		fd.Close()
+		if err != nil {
+			return rep, err
+		}
+		if torn > 0 {
+			rep.Torn = append(rep.Torn, f)
+		}
+		if !sealed {
+			rep.Unsealed = append(rep.Unsealed, f)
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"context"
+	"net/http"
+	"encoding/json"
+	"vesper/clientauth"
+	"vesper/configuration"
+	"github.com/comcast/irisjwt"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+type contextKey string
+
+const (
+	// clientIdentityKey - request context key of the identity of an authenticated client
+	clientIdentityKey		contextKey = "clientIdentity"
+	// jwtAuthenticatedKey - request context key set if the bearer token is a valid JWT
+	jwtAuthenticatedKey	contextKey = "jwtAuthenticated"
+	// clientCertIdentityKey - request context key of the identity of a client
+	// certificate
+	clientCertIdentityKey	contextKey = "clientCertIdentity"
+)
+
+// JWT scopes by permission
+var scopes = map[string]string{
+	clientauth.Signing				: "stir.sign",
+	clientauth.Rph						: "stir.sign.rph",
+	clientauth.Verification		: "stir.verify",
+	clientauth.Stats					: "stir.stats",
+	clientauth.Admin					: "stir.admin",
+}
+
+// authorize wraps a handler of an endpoint that requires permission p. The
+// client is authenticated and authorized (authenticate), then admitted by the
+// rate limits of p, if configured (admit)
+func authorize(p string, h httprouter.Handle) httprouter.Handle {
+	return func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+		clientIP := getClientIP(request)
+		request, ok := authenticate(p, response, request, clientIP)
+		if !ok {
+			return
+		}
+		if !admit(p, response, request, clientIP) {
+			return
+		}
+		h(response, request, ps)
+	}
+}
+
+// authenticate checks the client of a request to an endpoint that requires
+// permission p.
+// With client authentication (client_ca_file) configured, the request MUST carry a
+// client certificate mapped to an identity with permission p.
+// With JWT authentication (jwt_auth_enabled) configured, the request MUST carry a
+// bearer JWT with a valid signature, not expired, with the scope of permission p.
+// The request is returned with the identity of the client in its context.
+// Without either, all requests are passed on
+func authenticate(p string, response http.ResponseWriter, request *http.Request, clientIP string) (*http.Request, bool) {
+	if clientIdentities == nil && !configuration.ConfigurationInstance().JwtAuthEnabled {
+		return request, true
+	}
+	ctx := request.Context()
+	var client string
+	if clientIdentities != nil {
+		if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+			rejectClient(response, request, clientIP, "", http.StatusUnauthorized, "VESPER-4301", "client certificate required")
+			return request, false
+		}
+		c := request.TLS.PeerCertificates[0]
+		id, ok := clientIdentities.Identify(c)
+		if !ok {
+			rejectClient(response, request, clientIP, c.Subject.String(), http.StatusForbidden, "VESPER-4302", "client certificate is not mapped to a client identity")
+			return request, false
+		}
+		if !id.Allowed(p) {
+			rejectClient(response, request, clientIP, id.Name, http.StatusForbidden, "VESPER-4303", "client identity " + id.Name + " is not authorized for " + p)
+			return request, false
+		}
+		client = id.Name
+		ctx = context.WithValue(ctx, clientCertIdentityKey, id)
+	}
+	if configuration.ConfigurationInstance().JwtAuthEnabled {
+		auth := request.Header.Get("Authorization")
+		token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		if !strings.HasPrefix(auth, "Bearer ") || len(token) == 0 {
+			rejectClient(response, request, clientIP, client, http.StatusUnauthorized, "VESPER-4304", "bearer token required")
+			return request, false
+		}
+		subject, granted, err := validateBearerJwt(token)
+		if err != nil {
+			rejectClient(response, request, clientIP, client, http.StatusUnauthorized, "VESPER-4305", fmt.Sprintf("%v - invalid bearer token", err))
+			return request, false
+		}
+		// the certificate identity, if any, takes precedence
+		if len(client) == 0 {
+			client = subject
+		}
+		if !hasScope(granted, scopes[p]) {
+			rejectClient(response, request, clientIP, client, http.StatusForbidden, "VESPER-4306", "bearer token does not have scope " + scopes[p])
+			return request, false
+		}
+		ctx = context.WithValue(ctx, jwtAuthenticatedKey, true)
+	}
+	return request.WithContext(context.WithValue(ctx, clientIdentityKey, client)), true
+}
+
+// validateBearerJwt validates the signature and exp of a bearer JWT, and
+// returns its subject and scopes. The signature is verified with the public key
+// of the "app_key" claim, so the subject is the app_key - a "sub" claim, if
+// present, MUST be the app_key. irisjwt panics on some malformed tokens, which
+// are reported as invalid
+func validateBearerJwt(token string) (subject, granted string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed JWT")
+		}
+	}()
+	if err = irisjwt.ValidateJwt(token); err != nil {
+		return "", "", err
+	}
+	b, err := irisjwt.Base64Decode(strings.Split(token, ".")[1])
+	if err != nil {
+		return "", "", err
+	}
+	var claims map[string]interface{}
+	if err = json.Unmarshal(b, &claims); err != nil {
+		return "", "", err
+	}
+	subject, _ = claims["app_key"].(string)
+	if len(subject) == 0 {
+		return "", "", fmt.Errorf("app_key claim missing")
+	}
+	if sub, ok := claims["sub"]; ok && sub != subject {
+		return "", "", fmt.Errorf("sub claim %v is not the app_key %v", sub, subject)
+	}
+	if err = jwtKeys.Verify(token, subject); err != nil {
+		return "", "", err
+	}
+	// a token without scopes is authorized for nothing
+	granted, _ = irisjwt.Scopes(token)
+	return subject, granted, nil
+}
+
+// hasScope - true if scope is one of granted (space or comma separated) scopes
+func hasScope(granted, scope string) bool {
+	for _, v := range strings.FieldsFunc(granted, func(c rune) bool { return c == ' ' || c == ',' }) {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectClient answers a request that is not authenticated or authorized. The
+// client is logged by IP address and identity (certificate subject if the
+// certificate is not mapped to an identity)
+func rejectClient(response http.ResponseWriter, request *http.Request, clientIP, client string, httpCode int, eCode, eString string) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	lg := kitlog.With(glogger, "type", "clientAuthorization", "clientIP", clientIP, "client", client, "method", request.Method, "path", request.URL.Path)
+	serveHttpResponse(start, response, lg, httpCode, "error", traceID, eCode, eString, nil)
+}
+
+// requestClient returns the identity of the authenticated client of a request,
+// clientIP if the client is not authenticated
+func requestClient(request *http.Request, clientIP string) string {
+	if id := clientIdentity(request); len(id) > 0 {
+		return id
+	}
+	return clientIP
+}
+
+// clientServes returns true if the client of a request may sign for customer.
+// A client authenticated by certificate signs only for the customers of its
+// identity
+func clientServes(request *http.Request, customer string) bool {
+	id, ok := request.Context().Value(clientCertIdentityKey).(clientauth.Identity)
+	return !ok || id.Serves(customer)
+}
+
+// clientIdentity returns the identity of the authenticated client of a request,
+// empty string if the client is not authenticated
+func clientIdentity(request *http.Request) string {
+	id, _ := request.Context().Value(clientIdentityKey).(string)
+	return id
+}
@@ -0,0 +1,111 @@
+// Package claimconstraints parses the JWT Claim Constraints certificate
+// extension (RFC 8226) of STIR certificates - the PASSporT claims a certificate
+// is authorized to sign, and the values it is authorized to sign them with
+//
+//	JWTClaimConstraints ::= SEQUENCE {
+//	  mustInclude [0] JWTClaimNames OPTIONAL,
+//	  permittedValues [1] JWTClaimPermittedValuesList OPTIONAL
+//	}
+//	JWTClaimNames ::= SEQUENCE SIZE (1..MAX) OF JWTClaimName
+//	JWTClaimPermittedValuesList ::= SEQUENCE SIZE (1..MAX) OF JWTClaimPermittedValues
+//	JWTClaimPermittedValues ::= SEQUENCE {
+//	  claim JWTClaimName,
+//	  permitted SEQUENCE SIZE (1..MAX) OF UTF8String
+//	}
+//	JWTClaimName ::= IA5String
+//
+// The ASN.1 module uses EXPLICIT tags.
+package claimconstraints
+
+import (
+	"fmt"
+	"strings"
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// OID - id-pe-JWTClaimConstraints
+var OID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 27}
+
+// Constraints - the claims a certificate MUST include, and the values permitted
+// for claims, by claim
+type Constraints struct {
+	MustInclude	[]string						`json:"mustInclude,omitempty"`
+	Permitted		map[string][]string	`json:"permittedValues,omitempty"`
+}
+
+type jwtClaimConstraints struct {
+	MustInclude			[]string									`asn1:"optional,explicit,tag:0"`
+	PermittedValues	[]jwtClaimPermittedValues	`asn1:"optional,explicit,tag:1"`
+}
+
+type jwtClaimPermittedValues struct {
+	Claim			string	`asn1:"ia5"`
+	Permitted	[]string
+}
+
+// Parse decodes the DER encoded value of a JWTClaimConstraints extension
+func Parse(der []byte) (*Constraints, error) {
+	var v jwtClaimConstraints
+	rest, err := asn1.Unmarshal(der, &v)
+	if err != nil {
+		return nil, fmt.Errorf("%v - invalid JWTClaimConstraints", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data after JWTClaimConstraints")
+	}
+	if len(v.MustInclude) == 0 && len(v.PermittedValues) == 0 {
+		return nil, fmt.Errorf("JWTClaimConstraints has neither mustInclude nor permittedValues")
+	}
+	c := &Constraints{MustInclude: v.MustInclude, Permitted: make(map[string][]string, len(v.PermittedValues))}
+	for _, p := range v.PermittedValues {
+		if len(p.Permitted) == 0 {
+			return nil, fmt.Errorf("no permitted values of claim %v in JWTClaimConstraints", p.Claim)
+		}
+		c.Permitted[p.Claim] = append(c.Permitted[p.Claim], p.Permitted...)
+	}
+	return c, nil
+}
+
+// FromCertificate returns the JWTClaimConstraints of a certificate, nil if it
+// has none
+func FromCertificate(cert *x509.Certificate) (*Constraints, error) {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(OID) {
+			return Parse(e.Value)
+		}
+	}
+	return nil, nil
+}
+
+// Authorizes returns true if the constraints authorize signing claim with
+// each of values (compared case-insensitively) - claim MUST be in mustInclude
+// or permittedValues and, if it has permitted values, each value MUST be one
+// of them. nil constraints authorize nothing
+func (c *Constraints) Authorizes(claim string, values []string) bool {
+	if c == nil {
+		return false
+	}
+	permitted, ok := c.Permitted[claim]
+	if !ok {
+		for _, m := range c.MustInclude {
+			if m == claim {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range values {
+		found := false
+		for _, p := range permitted {
+			if strings.EqualFold(v, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
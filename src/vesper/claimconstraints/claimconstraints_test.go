@@ -0,0 +1,54 @@
+package claimconstraints
+
+import (
+	"testing"
+	"encoding/asn1"
+)
+
+func TestParse(t *testing.T) {
+	der, err := asn1.Marshal(jwtClaimConstraints{
+		MustInclude: []string{"rph"},
+		PermittedValues: []jwtClaimPermittedValues{{Claim: "rph", Permitted: []string{"ets.0", "wps.1"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		claim		string
+		values	[]string
+		want		bool
+	}{
+		{"rph", []string{"ets.0"}, true},
+		{"rph", []string{"ETS.0", "wps.1"}, true},
+		{"rph", []string{"ets.0", "ets.1"}, false},
+		{"attest", nil, false},
+	} {
+		if got := c.Authorizes(tc.claim, tc.values); got != tc.want {
+			t.Errorf("Authorizes(%v, %v) = %v - want %v", tc.claim, tc.values, got, tc.want)
+		}
+	}
+
+	// a claim that MUST be included, without permitted values, is authorized with any value
+	der, _ = asn1.Marshal(jwtClaimConstraints{MustInclude: []string{"rph"}})
+	if c, err := Parse(der); err != nil || !c.Authorizes("rph", []string{"ets.3"}) {
+		t.Errorf("Parse() = %+v, %v - want rph authorized", c, err)
+	}
+	var none *Constraints
+	if none.Authorizes("rph", nil) {
+		t.Errorf("Authorizes() of nil constraints = true")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	empty, _ := asn1.Marshal(jwtClaimConstraints{})
+	noValues, _ := asn1.Marshal(jwtClaimConstraints{PermittedValues: []jwtClaimPermittedValues{{Claim: "rph"}}})
+	for _, der := range [][]byte{{0x30, 0x03, 0x01}, empty, noValues, append(empty, 0x00)} {
+		if c, err := Parse(der); err == nil {
+			t.Errorf("Parse(%x) = %+v - want error", der, c)
+		}
+	}
+}
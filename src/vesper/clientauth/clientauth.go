@@ -0,0 +1,194 @@
+// Package clientauth maps authenticated clients to identities, and identities
+// to the endpoints (permissions) they are authorized for.
+//
+// Clients are authenticated with TLS client certificates. A certificate is
+// mapped to an identity by its subject (e.g. "CN=sbc1.example.com,O=Example")
+// or by one of its subject alternative names (DNS name, email address, URI or
+// IP address).
+//
+// The identities are listed in a file
+//
+//	{
+//	  "identities": [
+//	    {
+//	      "name": "sbc1",
+//	      "subjects": ["CN=sbc1.example.com,O=Example"],
+//	      "sans": ["sbc1.example.com"],
+//	      "permissions": ["signing", "verification"],
+//	      "customers": ["acme"]
+//	    }
+//	  ]
+//	}
+//
+// This data structure is thread safe.
+package clientauth
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"strings"
+	"io/ioutil"
+	"crypto/x509"
+	"encoding/json"
+)
+
+// Permissions
+const (
+	Signing				= "signing"
+	Rph						= "rph"
+	Verification	= "verification"
+	Stats					= "stats"
+	Admin					= "admin"
+)
+
+var permissions = map[string]bool{Signing: true, Rph: true, Verification: true, Stats: true, Admin: true}
+
+// Identity - a client and the endpoints it is authorized for
+type Identity struct {
+	Name				string		`json:"name"`
+	Subjects		[]string	`json:"subjects"`
+	SANs				[]string	`json:"sans"`
+	Permissions	[]string	`json:"permissions"`
+	Customers		[]string	`json:"customers"`		// customers the client signs for
+}
+
+// Allowed returns true if the identity has permission p
+func (id Identity) Allowed(p string) bool {
+	for _, v := range id.Permissions {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Serves returns true if customer is one of the customers of the identity
+func (id Identity) Serves(customer string) bool {
+	for _, v := range id.Customers {
+		if v == customer {
+			return true
+		}
+	}
+	return false
+}
+
+// Identities - client identities
+type Identities struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file					string
+	modifiedTime	int64
+	bySubject			map[string]Identity
+	bySAN					map[string]Identity
+}
+
+// Initialize object
+// Saves file modified time for future use
+func InitObject(f string) (*Identities, error) {
+	if len(strings.TrimSpace(f)) == 0 {
+		return nil, fmt.Errorf("file name (with client identities) is an empty string")
+	}
+	ids := &Identities{file: f}
+	if err := ids.UpdateIdentities(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// UpdateIdentities reads the client identities file only if its modified time
+// has changed. The current identities are kept on failure
+func (ids *Identities) UpdateIdentities() error {
+	fi, err := os.Stat(ids.file)
+	if err != nil {
+		return fmt.Errorf("%v - client identities file", err)
+	}
+	m := fi.ModTime().Unix()
+	ids.RLock()
+	same := ids.modifiedTime == m
+	ids.RUnlock()
+	if same {
+		return nil
+	}
+	b, err := ioutil.ReadFile(ids.file)
+	if err != nil {
+		return fmt.Errorf("%v - client identities file", err)
+	}
+	bySubject, bySAN, err := parse(b)
+	if err != nil {
+		return err
+	}
+	ids.Lock()
+	defer ids.Unlock()
+	ids.bySubject = bySubject
+	ids.bySAN = bySAN
+	ids.modifiedTime = m
+	return nil
+}
+
+// Identify returns the identity of a client certificate. The subject is
+// matched first, then the subject alternative names
+func (ids *Identities) Identify(c *x509.Certificate) (Identity, bool) {
+	ids.RLock()
+	defer ids.RUnlock()
+	if id, ok := ids.bySubject[c.Subject.String()]; ok {
+		return id, true
+	}
+	for _, san := range SANs(c) {
+		if id, ok := ids.bySAN[san]; ok {
+			return id, true
+		}
+	}
+	return Identity{}, false
+}
+
+// SANs returns the subject alternative names of a certificate
+func SANs(c *x509.Certificate) []string {
+	s := append([]string{}, c.DNSNames...)
+	s = append(s, c.EmailAddresses...)
+	for _, u := range c.URIs {
+		s = append(s, u.String())
+	}
+	for _, ip := range c.IPAddresses {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+func parse(b []byte) (map[string]Identity, map[string]Identity, error) {
+	var c struct {
+		Identities []Identity `json:"identities"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("%v - decode JSON object in client identities file", err)
+	}
+	bySubject := make(map[string]Identity)
+	bySAN := make(map[string]Identity)
+	for _, id := range c.Identities {
+		if len(strings.TrimSpace(id.Name)) == 0 {
+			return nil, nil, fmt.Errorf("name of a client identity MUST be a non-empty string")
+		}
+		if len(id.Subjects) == 0 && len(id.SANs) == 0 {
+			return nil, nil, fmt.Errorf("client identity %v MUST have subjects or sans", id.Name)
+		}
+		for _, p := range id.Permissions {
+			if !permissions[p] {
+				return nil, nil, fmt.Errorf("client identity %v - permission %v MUST be \"signing\", \"rph\", \"verification\", \"stats\" or \"admin\"", id.Name, p)
+			}
+		}
+		for _, s := range id.Subjects {
+			if v, ok := bySubject[s]; ok {
+				return nil, nil, fmt.Errorf("subject %v is mapped to client identities %v and %v", s, v.Name, id.Name)
+			}
+			bySubject[s] = id
+		}
+		for _, s := range id.SANs {
+			if v, ok := bySAN[s]; ok {
+				return nil, nil, fmt.Errorf("san %v is mapped to client identities %v and %v", s, v.Name, id.Name)
+			}
+			bySAN[s] = id
+		}
+	}
+	return bySubject, bySAN, nil
+}
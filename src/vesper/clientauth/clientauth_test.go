@@ -0,0 +1,60 @@
+package clientauth
+
+import (
+	"net"
+	"testing"
+	"crypto/x509"
+	"crypto/x509/pkix"
+)
+
+func TestIdentify(t *testing.T) {
+	bySubject, bySAN, err := parse([]byte(`{
+		"identities": [
+			{"name": "sbc1", "subjects": ["CN=sbc1.example.com,O=Example"], "permissions": ["signing"], "customers": ["acme"]},
+			{"name": "sbc2", "sans": ["sbc2.example.com", "10.0.0.2"], "permissions": ["verification", "stats"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := &Identities{bySubject: bySubject, bySAN: bySAN}
+	for _, c := range []struct {
+		cert	*x509.Certificate
+		want	string
+	}{
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "sbc1.example.com", Organization: []string{"Example"}}}, "sbc1"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "x"}, DNSNames: []string{"sbc2.example.com"}}, "sbc2"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "x"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.2")}}, "sbc2"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "sbc1.example.com"}}, ""},
+	} {
+		id, ok := ids.Identify(c.cert)
+		if ok != (len(c.want) > 0) || id.Name != c.want {
+			t.Errorf("Identify(%v) = %v, %v - want %v", c.cert.Subject, id.Name, ok, c.want)
+		}
+	}
+	id, _ := ids.Identify(&x509.Certificate{DNSNames: []string{"sbc2.example.com"}})
+	if id.Allowed(Signing) || !id.Allowed(Stats) {
+		t.Errorf("permissions of sbc2 = %v - want verification, stats", id.Permissions)
+	}
+	// the signing permission does not cover rph signing
+	id, _ = ids.Identify(&x509.Certificate{Subject: pkix.Name{CommonName: "sbc1.example.com", Organization: []string{"Example"}}})
+	if !id.Allowed(Signing) || id.Allowed(Rph) {
+		t.Errorf("permissions of sbc1 = %v - want signing", id.Permissions)
+	}
+	if !id.Serves("acme") || id.Serves("globex") {
+		t.Errorf("customers of sbc1 = %v - want acme", id.Customers)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, b := range []string{
+		`{"identities": [{"name": "", "sans": ["a"]}]}`,
+		`{"identities": [{"name": "a"}]}`,
+		`{"identities": [{"name": "a", "sans": ["a"], "permissions": ["sign"]}]}`,
+		`{"identities": [{"name": "a", "sans": ["a"]}, {"name": "b", "sans": ["a"]}]}`,
+	} {
+		if _, _, err := parse([]byte(b)); err == nil {
+			t.Errorf("parse(%v) - want error", b)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"strings"
 	"reflect"
+	"crypto/subtle"
 	"vesper/errorhandler"
 	"vesper/stats"
 	kitlog "github.com/go-kit/kit/log"
@@ -51,6 +52,47 @@ func validatePayload(r map[string]interface{}, traceID, clientIP string) (map[st
 		return orderedMap, origTN, iat, destTNs, "", "VESPER-4007", fmt.Errorf("attest field in request payload MUST be a string")
 	}
 	
+	// dest, iat and orig ...
+	origTN, iat, destTNs, errCode, err := validateTNsAndIat(r, orderedMap, traceID, clientIP)
+	if err != nil {
+		return orderedMap, origTN, iat, destTNs, "", errCode, err
+	}
+	
+	// origid ...
+	switch reflect.TypeOf(r["origid"]).Kind() {
+	case reflect.String:
+		origID = reflect.ValueOf(r["origid"]).String()
+		if len(strings.TrimSpace(origID)) == 0 {
+			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4010", "reasonString", "origid field in request payload is an empty string", "requestPayload", r)
+			return orderedMap, origTN, iat, destTNs, "", "VESPER-4010", fmt.Errorf("origid field in request payload is an empty string")
+		}
+		orderedMap["origid"] = r["origid"]
+	default:
+		logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4011", "reasonString", "origid field in request payload MUST be a string", "requestPayload", r)
+		return orderedMap, origTN, iat, destTNs, "", "VESPER-4011", fmt.Errorf("origid field in request payload MUST be a string")
+	}
+	
+	return orderedMap, origTN, iat, destTNs, origID, "", nil
+}
+
+// canonicalTN - TN in the canonical form of RFC 8224 section 8.3 - digits only,
+// without "+" and visual separators
+func canonicalTN(tn string) string {
+	var b strings.Builder
+	for i := 0; i < len(tn); i++ {
+		if tn[i] >= '0' && tn[i] <= '9' {
+			b.WriteByte(tn[i])
+		}
+	}
+	return b.String()
+}
+
+// validateTNsAndIat validates dest, iat and orig in a request payload (or JWT
+// claims) and copies them to orderedMap
+func validateTNsAndIat(r, orderedMap map[string]interface{}, traceID, clientIP string) (string, int64, []string, string, error) {
+	var origTN string
+	var iat int64
+	var destTNs []string
 	// dest ...
 	switch reflect.TypeOf(r["dest"]).Kind() {
 	case reflect.Map:
@@ -58,15 +100,15 @@ func validatePayload(r map[string]interface{}, traceID, clientIP string) (map[st
 		switch {
 		case len(destKeys) == 0 :
 			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4018", "reasonString", "dest in request payload is an empty object", "requestPayload", r)
-			return orderedMap, origTN, iat, destTNs, "", "VESPER-4018", fmt.Errorf("dest in request payload is an empty object")
+			return origTN, iat, destTNs, "VESPER-4018", fmt.Errorf("dest in request payload is an empty object")
 		case len(destKeys) > 1 :
 			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4019", "reasonString", "dest in request payload should contain only one field", "requestPayload", r)
-			return orderedMap, origTN, iat, destTNs, "", "VESPER-4019", fmt.Errorf("dest in request payload should contain only one field")
+			return origTN, iat, destTNs, "VESPER-4019", fmt.Errorf("dest in request payload should contain only one field")
 		default:
 			// field should be "tn" only
 			if destKeys[0].String() != "tn" {
 				logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4020", "reasonString", "dest in request payload does not contain field \"tn\"", "requestPayload", r)
-				return orderedMap, origTN, iat, destTNs, "", "VESPER-4020", fmt.Errorf("dest in request payload does not contain field \"tn\"")
+				return origTN, iat, destTNs, "VESPER-4020", fmt.Errorf("dest in request payload does not contain field \"tn\"")
 			}
 			// validate "tn" value is of type string and is not an empty string
 			switch reflect.TypeOf(r["dest"].(map[string]interface{})["tn"]).Kind() {
@@ -75,18 +117,18 @@ func validatePayload(r map[string]interface{}, traceID, clientIP string) (map[st
 				dt := reflect.ValueOf(r["dest"].(map[string]interface{})["tn"])
 				if dt.Len() == 0 {
 					logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4021", "reasonString", "dest tn in request payload is an empty array", "requestPayload", r)
-					return orderedMap, origTN, iat, destTNs, "", "VESPER-4021", fmt.Errorf("dest tn in request payload is an empty array")
+					return origTN, iat, destTNs, "VESPER-4021", fmt.Errorf("dest tn in request payload is an empty array")
 				}
 				// contains empty string
 				for i := 0; i < dt.Len(); i++ {
 					tn := dt.Index(i).Elem()
 					if tn.Kind() != reflect.String {
 						logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4022", "reasonString", "one or more dest tns in request payload is not a string", "requestPayload", r)
-						return orderedMap, origTN, iat, destTNs, "", "VESPER-4022", fmt.Errorf("one or more dest tns in request payload is not a string")
+						return origTN, iat, destTNs, "VESPER-4022", fmt.Errorf("one or more dest tns in request payload is not a string")
 					} else {
 						if len(strings.TrimSpace(tn.String())) == 0 {
 							logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4023", "reasonString", "one or more dest tns in request payload is an empty string", "requestPayload", r)
-							return orderedMap, origTN, iat, destTNs, "", "VESPER-4023", fmt.Errorf("one or more dest tns in request payload is an empty string")
+							return origTN, iat, destTNs, "VESPER-4023", fmt.Errorf("one or more dest tns in request payload is an empty string")
 						}
 						// append desl TNs here
 						destTNs = append(destTNs, tn.String())
@@ -94,13 +136,13 @@ func validatePayload(r map[string]interface{}, traceID, clientIP string) (map[st
 				}
 			default:
 				logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4024", "reasonString", "dest tn in request payload is not an array", "requestPayload", r)
-				return orderedMap, origTN, iat, destTNs, "", "VESPER-4024", fmt.Errorf("dest tn in request payload is not an array")
+				return origTN, iat, destTNs, "VESPER-4024", fmt.Errorf("dest tn in request payload is not an array")
 			}
 			orderedMap["dest"] = r["dest"]
 		}
 	default:
 		logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4025", "reasonString", "dest field in request payload MUST be a JSON object", "requestPayload", r)
-		return orderedMap, origTN, iat, destTNs, "", "VESPER-4025", fmt.Errorf("dest field in request payload MUST be a JSON object")
+		return origTN, iat, destTNs, "VESPER-4025", fmt.Errorf("dest field in request payload MUST be a JSON object")
 	}
 	
 	// iat ...
@@ -109,12 +151,12 @@ func validatePayload(r map[string]interface{}, traceID, clientIP string) (map[st
 		iat = int64(reflect.ValueOf(r["iat"]).Float())
 		if iat <= 0 {
 			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4008", "reasonString", "iat value in request payload is <= 0", "requestPayload", r)
-			return orderedMap, origTN, iat, destTNs, "", "VESPER-4008", fmt.Errorf("iat value in request payload is <= 0")
+			return origTN, iat, destTNs, "VESPER-4008", fmt.Errorf("iat value in request payload is <= 0")
 		}
 		orderedMap["iat"] = r["iat"]
 	default:
 		logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4009", "reasonString", "iat field in request payload MUST be a number", "requestPayload", r)
-		return orderedMap, origTN, iat, destTNs, "", "VESPER-4009", fmt.Errorf("iat field in request payload MUST be a number")
+		return origTN, iat, destTNs, "VESPER-4009", fmt.Errorf("iat field in request payload MUST be a number")
 	}
 	
 	// orig ...
@@ -124,53 +166,40 @@ func validatePayload(r map[string]interface{}, traceID, clientIP string) (map[st
 		switch {
 		case len(origKeys) == 0 :
 			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4012", "reasonString", "orig in request payload is an empty object", "requestPayload", r)
-			return orderedMap, origTN, iat, destTNs, "", "VESPER-4012", fmt.Errorf("orig in request payload is an empty object")
+			return origTN, iat, destTNs, "VESPER-4012", fmt.Errorf("orig in request payload is an empty object")
 		case len(origKeys) > 1 :
 			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4013", "reasonString", "orig in request payload should contain only one field", "requestPayload", r)
-			return orderedMap, origTN, iat, destTNs, "", "VESPER-4013", fmt.Errorf("orig in request payload should contain only one field")
+			return origTN, iat, destTNs, "VESPER-4013", fmt.Errorf("orig in request payload should contain only one field")
 		default:
 			// field should be "tn" only
 			if origKeys[0].String() != "tn" {
 				logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4014", "reasonString", "orig in request payload does not contain field \"tn\"", "requestPayload", r)
-				return orderedMap, origTN, iat, destTNs, "", "VESPER-4014", fmt.Errorf("orig in request payload does not contain field \"tn\"")
+				return origTN, iat, destTNs, "VESPER-4014", fmt.Errorf("orig in request payload does not contain field \"tn\"")
 			}
 			// validate "tn" value is of type string and is not an empty string
 			_, ok := r["orig"].(map[string]interface{})["tn"].(string)
 			if !ok {
 				logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4015", "reasonString", "orig tn in request payload is not of type string", "requestPayload", r)
-				return orderedMap, origTN, iat, destTNs, "", "VESPER-4015", fmt.Errorf("orig tn in request payload is not of type string")
+				return origTN, iat, destTNs, "VESPER-4015", fmt.Errorf("orig tn in request payload is not of type string")
 			}
 			origTN = r["orig"].(map[string]interface{})["tn"].(string)
 			if len(strings.TrimSpace(origTN)) == 0 {
 				logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4016", "reasonString", "orig tn in request payload is an empty string", "requestPayload", r)
-				return orderedMap, origTN, iat, destTNs, "", "VESPER-4016", fmt.Errorf("orig tn in request payload is an empty string")
+				return origTN, iat, destTNs, "VESPER-4016", fmt.Errorf("orig tn in request payload is an empty string")
 			}
 		}
 		orderedMap["orig"] = r["orig"]
 	default:
 		logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4017", "reasonString", "orig field in request payload MUST be a JSON object", "requestPayload", r)
-		return orderedMap, origTN, iat, destTNs, "", "VESPER-4017", fmt.Errorf("orig field in request payload MUST be a JSON object")
+		return origTN, iat, destTNs, "VESPER-4017", fmt.Errorf("orig field in request payload MUST be a JSON object")
 	}
-	
-	// origid ...
-	switch reflect.TypeOf(r["origid"]).Kind() {
-	case reflect.String:
-		origID = reflect.ValueOf(r["origid"]).String()
-		if len(strings.TrimSpace(origID)) == 0 {
-			logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4010", "reasonString", "origid field in request payload is an empty string", "requestPayload", r)
-			return orderedMap, origTN, iat, destTNs, "", "VESPER-4010", fmt.Errorf("origid field in request payload is an empty string")
-		}
-		orderedMap["origid"] = r["origid"]
-	default:
-		logError("type", "requestPayload", "traceID", traceID, "clientIP", clientIP, "module", "validatePayload", "reasonCode", "VESPER-4011", "reasonString", "origid field in request payload MUST be a string", "requestPayload", r)
-		return orderedMap, origTN, iat, destTNs, "", "VESPER-4011", fmt.Errorf("origid field in request payload MUST be a string")
-	}
-	
-	return orderedMap, origTN, iat, destTNs, origID, "", nil
+
+	return origTN, iat, destTNs, "", nil
 }
 
 func serveHttpResponse(s time.Time, w http.ResponseWriter, l kitlog.Logger, httpCode int, level, traceID, eCode, eString string, data interface{}) {
 	var errString string
+	observeOutcome(w, eCode, "")
 	w.WriteHeader(httpCode)
 	if data != nil {
 		json.NewEncoder(w).Encode(data)
@@ -193,3 +222,25 @@ func serveHttpResponse(s time.Time, w http.ResponseWriter, l kitlog.Logger, http
 	)
 	lg.Log()
 }
+
+// bearerAuthorized - true if the bearer token in the request is one of tokens,
+// or a JWT validated by authorize
+func bearerAuthorized(request *http.Request, tokens []string) bool {
+	if ok, _ := request.Context().Value(jwtAuthenticatedKey).(bool); ok {
+		return true
+	}
+	h := request.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+	t := []byte(strings.TrimSpace(h[7:]))
+	if len(t) == 0 {
+		return false
+	}
+	for _, v := range tokens {
+		if subtle.ConstantTimeCompare(t, []byte(v)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,15 @@ type Configuration struct {
 	EksCredentialsRefreshInterval								int64			`json:"eks_credentials_refresh_interval"`
 	SticrHostFile																string		`json:"sticr_host_file"`
 	SticrFileCheckInterval											int64			`json:"sticr_file_check_interval"`
+	SigningMode																	string		`json:"signing_mode"`
+	DelegateCredentialsFile											string		`json:"delegate_credentials_file"`
+	DelegateCredentialsFileCheckInterval				int64			`json:"delegate_credentials_file_check_interval"`
+	AttestPolicyFile														string		`json:"attest_policy_file"`
+	AttestPolicyFileCheckInterval								int64			`json:"attest_policy_file_check_interval"`
+	AttestPolicyDowngrade												bool			`json:"attest_policy_downgrade"`
+	RphX5u																			string		`json:"rph_x5u"`
+	RphCertFile																	string		`json:"rph_cert_file"`
+	RphKeyFile																	string		`json:"rph_key_file"`
 	
 	RootCertsFetchInterval											int64			`json:"root_certs_fetch_interval"`
 	SigningCredentialsFetchInterval 						int64			`json:"signing_credentials_fetch_interval"`
@@ -29,6 +38,89 @@ type Configuration struct {
 	
 	VerifyRootCA																bool			`json:"verify_root_ca"`
 	ValidIatPeriod															int64			`json:"valid_iat_period"`
+	IatDateTolerance														int64			`json:"iat_date_tolerance"`
+	IatFutureTolerance													int64			`json:"iat_future_tolerance"`
+
+	SipHost																			string		`json:"sip_host"`
+	SipSigningTransports												[]string	`json:"sip_signing_transports"`
+	SipSigningPort															string		`json:"sip_signing_port"`
+	SipSigningTlsPort														string		`json:"sip_signing_tls_port"`
+	SipDefaultAttest														string		`json:"sip_default_attest"`
+	SipDefaultOrigID														string		`json:"sip_default_origid"`
+	SipVerificationTransports										[]string	`json:"sip_verification_transports"`
+	SipVerificationPort													string		`json:"sip_verification_port"`
+	SipVerificationTlsPort											string		`json:"sip_verification_tls_port"`
+
+	CpsEnabled																	bool			`json:"cps_enabled"`
+	CpsPassportTTL															int64			`json:"cps_passport_ttl"`
+	CpsPublishTokens														[]string	`json:"cps_publish_tokens"`
+	CpsRetrieveTokens														[]string	`json:"cps_retrieve_tokens"`
+	CpsPersistenceFile													string		`json:"cps_persistence_file"`
+	CpsPersistenceInterval											int64			`json:"cps_persistence_interval"`
+	CpsMaxPassportsPerCall											int				`json:"cps_max_passports_per_call"`
+	CpsMaxStoreSize															int64			`json:"cps_max_store_size"`
+	CpsUrl																			string		`json:"cps_url"`
+	CpsToken																		string		`json:"cps_token"`
+
+	TnInventoryEnabled													bool			`json:"tn_inventory_enabled"`
+	TnInventoryFile															string		`json:"tn_inventory_file"`
+	AdminTokens																	[]string	`json:"admin_tokens"`
+	ClientCAFile																string		`json:"client_ca_file"`
+	ClientIdentitiesFile												string		`json:"client_identities_file"`
+	ClientIdentitiesFileCheckInterval						int64			`json:"client_identities_file_check_interval"`
+	JwtAuthEnabled															bool			`json:"jwt_auth_enabled"`
+	JwtPublicKeyUrl															string		`json:"jwt_public_key_url"`
+	JwtAppKeys																	[]string	`json:"jwt_app_keys"`
+	SigningRateLimit														float64		`json:"signing_rate_limit"`
+	SigningRateBurst														int				`json:"signing_rate_burst"`
+	SigningDailyQuota														int64			`json:"signing_daily_quota"`
+	VerificationRateLimit												float64		`json:"verification_rate_limit"`
+	VerificationRateBurst												int				`json:"verification_rate_burst"`
+	VerificationDailyQuota											int64			`json:"verification_daily_quota"`
+	TrustedProxies															[]string	`json:"trusted_proxies"`
+	TrustedProxyHeader													string		`json:"trusted_proxy_header"`
+	AclFile																			string		`json:"acl_file"`
+	AclFileCheckInterval												int64			`json:"acl_file_check_interval"`
+
+	AnalyticsEnabled														bool			`json:"analytics_enabled"`
+	AnalyticsRetention													int64			`json:"analytics_retention"`
+	AnalyticsRetentionCheckInterval							int64			`json:"analytics_retention_check_interval"`
+
+	EventsBufferSize														int				`json:"events_buffer_size"`
+	EventsBatchSize															int				`json:"events_batch_size"`
+	EventsFlushInterval													int64			`json:"events_flush_interval"`
+	EventsFile																	string		`json:"events_file"`
+	EventsFileMaxSize														int64			`json:"events_file_max_size"`
+	EventsWebhookUrl														string		`json:"events_webhook_url"`
+	EventsWebhookToken													string		`json:"events_webhook_token"`
+	EventsWebhookTimeout												int64			`json:"events_webhook_timeout"`
+	EventsWebhookRetries												int				`json:"events_webhook_retries"`
+
+	PreSignHookUrl															string		`json:"pre_sign_hook_url"`
+	PreSignHookToken														string		`json:"pre_sign_hook_token"`
+	PreSignHookTimeout													int64			`json:"pre_sign_hook_timeout"`
+	PreSignHookPolicy														string		`json:"pre_sign_hook_policy"`
+	PostVerifyHookUrl														string		`json:"post_verify_hook_url"`
+	PostVerifyHookToken													string		`json:"post_verify_hook_token"`
+	PostVerifyHookTimeout												int64			`json:"post_verify_hook_timeout"`
+	PostVerifyHookPolicy												string		`json:"post_verify_hook_policy"`
+	OrigIDRegistryEnabled												bool			`json:"origid_registry_enabled"`
+	OrigIDRegistryFile													string		`json:"origid_registry_file"`
+
+	DnoFile																			string		`json:"dno_file"`
+	DnoFileCheckInterval												int64			`json:"dno_file_check_interval"`
+	DnoVerificationPolicy												string		`json:"dno_verification_policy"`
+
+	NumberingFile																string		`json:"numbering_file"`
+	NumberingFileCheckInterval									int64			`json:"numbering_file_check_interval"`
+
+	LedgerDir																		string		`json:"ledger_dir"`
+	LedgerRetention															int64			`json:"ledger_retention"`
+	LedgerRetentionCheckInterval								int64			`json:"ledger_retention_check_interval"`
+
+	AuditDir																		string		`json:"audit_dir"`
+	AuditSegmentInterval												int64			`json:"audit_segment_interval"`
+	AuditSeal																		bool			`json:"audit_seal"`
 }
 
 var configurationInstance *Configuration = nil
@@ -48,6 +140,15 @@ func ConfigurationInstance() *Configuration {
 			EksCredentialsRefreshInterval					: 60,
 			SticrHostFile													: "",
 			SticrFileCheckInterval								: 60,
+			SigningMode														: "spc",
+			DelegateCredentialsFile								: "",
+			DelegateCredentialsFileCheckInterval	: 60,
+			AttestPolicyFile											: "",
+			AttestPolicyFileCheckInterval					: 60,
+			AttestPolicyDowngrade									: false,
+			RphX5u																: "",
+			RphCertFile														: "",
+			RphKeyFile														: "",
 			
 			RootCertsFetchInterval								: 300,
 			SigningCredentialsFetchInterval				: 300,
@@ -56,6 +157,81 @@ func ConfigurationInstance() *Configuration {
 			
 			VerifyRootCA													: true,
 			ValidIatPeriod												: 60,
+			IatDateTolerance											: 60,
+			IatFutureTolerance										: 5,
+
+			SipHost																: "",
+			SipSigningTransports									: []string{},
+			SipSigningPort												: "5060",
+			SipSigningTlsPort											: "5061",
+			SipDefaultAttest											: "",
+			SipDefaultOrigID											: "",
+			SipVerificationTransports							: []string{},
+			SipVerificationPort										: "5070",
+			SipVerificationTlsPort								: "5071",
+
+			CpsEnabled														: false,
+			CpsPassportTTL												: 15,
+			CpsPublishTokens											: []string{},
+			CpsRetrieveTokens											: []string{},
+			CpsPersistenceFile										: "",
+			CpsPersistenceInterval								: 10,
+			CpsMaxPassportsPerCall								: 10,
+			CpsMaxStoreSize												: 100000000,
+			CpsUrl																: "",
+			CpsToken															: "",
+			TnInventoryEnabled										: false,
+			TnInventoryFile												: "",
+			AdminTokens														: []string{},
+			ClientCAFile													: "",
+			ClientIdentitiesFile									: "",
+			ClientIdentitiesFileCheckInterval			: 60,
+			JwtAuthEnabled												: false,
+			JwtPublicKeyUrl												: "",
+			JwtAppKeys														: []string{},
+			SigningRateLimit											: 0,
+			SigningRateBurst											: 0,
+			SigningDailyQuota											: 0,
+			VerificationRateLimit									: 0,
+			VerificationRateBurst									: 0,
+			VerificationDailyQuota								: 0,
+			TrustedProxies												: []string{},
+			TrustedProxyHeader										: "x-forwarded-for",
+			AclFile																: "",
+			AclFileCheckInterval									: 60,
+			AnalyticsEnabled											: false,
+			AnalyticsRetention										: 7,
+			AnalyticsRetentionCheckInterval				: 60,
+			EventsBufferSize											: 10000,
+			EventsBatchSize												: 100,
+			EventsFlushInterval										: 5,
+			EventsFile														: "",
+			EventsFileMaxSize											: 50000000,
+			EventsWebhookUrl											: "",
+			EventsWebhookToken										: "",
+			EventsWebhookTimeout									: 5,
+			EventsWebhookRetries									: 3,
+			PreSignHookUrl												: "",
+			PreSignHookToken											: "",
+			PreSignHookTimeout										: 500,
+			PreSignHookPolicy											: "open",
+			PostVerifyHookUrl											: "",
+			PostVerifyHookToken										: "",
+			PostVerifyHookTimeout									: 500,
+			PostVerifyHookPolicy									: "open",
+			OrigIDRegistryEnabled									: false,
+			OrigIDRegistryFile										: "",
+			DnoFile																: "",
+			DnoFileCheckInterval									: 60,
+			DnoVerificationPolicy									: "flag",
+			NumberingFile													: "",
+			NumberingFileCheckInterval						: 60,
+			LedgerDir															: "",
+			LedgerRetention												: 90,
+			LedgerRetentionCheckInterval					: 60,
+			AuditDir															: "",
+			AuditSegmentInterval									: 60,
+			AuditSeal															: true,
 		}
 		configurationInstance = config
 	}
@@ -0,0 +1,256 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"bytes"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	"vesper/cps"
+	"vesper/audit"
+	"vesper/configuration"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// CpsRequest - body of a PASSporT publish request (ATIS-1000096)
+type CpsRequest struct {
+	Passports []string `json:"passports"`
+}
+
+// validCpsTN - TNs in the path must be in the canonical SHAKEN form
+func validCpsTN(tn string) bool {
+	if len(tn) == 0 {
+		return false
+	}
+	for _, c := range tn {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateCpsClaims - claims of a PASSporT p published for call dest, orig MUST be
+// valid, be for the call and have a fresh iat at time t
+func validateCpsClaims(p, dest, orig string, t int64, traceID, clientIP string) (string, error) {
+	c, err := base64Decode(strings.Split(p, ".")[1])
+	if err != nil {
+		return "VESPER-4152", fmt.Errorf("%v - unable to base64 url decode claims part of JWT", err)
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(c, &m); err != nil {
+		return "VESPER-4153", fmt.Errorf("%v - unable to unmarshal decoded claims to map[string]interface{}", err)
+	}
+	_, origTN, iat, destTNs, _, errCode, err := validatePayload(m, traceID, clientIP)
+	if err != nil {
+		return errCode, err
+	}
+	if canonicalTN(origTN) != orig {
+		return "VESPER-4154", fmt.Errorf("orig TN %v in path does not match orig TN in JWT claims (%+v)", orig, m)
+	}
+	found := false
+	for _, d := range destTNs {
+		if canonicalTN(d) == dest {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "VESPER-4155", fmt.Errorf("dest TN %v in path is not a dest TN in JWT claims (%+v)", dest, m)
+	}
+	return validateIatFreshness(iat, t)
+}
+
+// publishPassports - a signer publishes PASSporTs for a call
+func publishPassports(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	// every terminal outcome is recorded
+	outcome := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "refused"}
+	refuse := func(reasonCode string) {
+		outcome.ReasonCode = reasonCode
+		recordDecision(response, "cpsPublish", start, outcome)
+	}
+	lg := kitlog.With(glogger, "type", "cpsPublish", "clientIP", clientIP, "client", client, "module", "publishPassports")
+	if !bearerAuthorized(request, configuration.ConfigurationInstance().CpsPublishTokens) {
+		refuse("VESPER-4401")
+		serveHttpResponse(start, response, lg, http.StatusUnauthorized, "error", traceID, "VESPER-4401", "not authorized to publish PASSporTs", nil)
+		return
+	}
+	dest, orig := ps.ByName("dest"), ps.ByName("orig")
+	if !validCpsTN(dest) || !validCpsTN(orig) {
+		refuse("VESPER-4406")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4406", "dest and orig TN in path MUST be digits only", nil)
+		return
+	}
+	outcome.Orig, outcome.Dest = orig, []string{dest}
+	var r CpsRequest
+	err := json.NewDecoder(request.Body).Decode(&r)
+	switch {
+	case err == io.EOF:
+		refuse("VESPER-4402")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4402", "empty request body", nil)
+		return
+	case err != nil :
+		refuse("VESPER-4403")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4403", "unable to parse request body", nil)
+		return
+	}
+	if len(r.Passports) == 0 {
+		refuse("VESPER-4404")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4404", "passports field in request payload MUST be a non-empty array of strings", nil)
+		return
+	}
+	for _, p := range r.Passports {
+		if len(strings.Split(p, ".")) != 3 {
+			refuse("VESPER-4405")
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4405", "Invalid JWT format in one or more PASSporTs in request payload", nil)
+			return
+		}
+		if _, _, errCode, err := validateHeader(p, "shaken"); err != nil {
+			refuse("VESPER-4405")
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4405", fmt.Sprintf("%v (%v) - invalid PASSporT in request payload", err, errCode), nil)
+			return
+		}
+		if errCode, err := validateCpsClaims(p, dest, orig, start.Unix(), traceID, clientIP); err != nil {
+			refuse("VESPER-4409")
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4409", fmt.Sprintf("%v (%v) - PASSporT claims in request payload are not valid for the call", err, errCode), nil)
+			return
+		}
+	}
+	switch err := cpsStore.Publish(dest, orig, r.Passports); err {
+	case nil:
+	case cps.ErrCallFull:
+		refuse("VESPER-4408")
+		serveHttpResponse(start, response, lg, http.StatusConflict, "error", traceID, "VESPER-4408", fmt.Sprintf("%v - at most %v PASSporTs can be published for a call", err, configuration.ConfigurationInstance().CpsMaxPassportsPerCall), nil)
+		return
+	default:
+		refuse("VESPER-5401")
+		serveHttpResponse(start, response, lg, http.StatusServiceUnavailable, "error", traceID, "VESPER-5401", err.Error(), nil)
+		return
+	}
+	outcome.Result = "published"
+	recordDecision(response, "cpsPublish", start, outcome)
+	logInfo("type", "cpsPublish", "traceID", traceID, "client", client, "clientIP", clientIP, "module", "publishPassports", "dest", dest, "orig", orig, "passports", len(r.Passports))
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{})
+}
+
+// retrievePassports - a verifier retrieves PASSporTs for a call. With query
+// verify=true, the signature of each PASSporT is verified
+func retrievePassports(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	// every terminal outcome is recorded
+	outcome := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "refused"}
+	refuse := func(reasonCode string) {
+		outcome.ReasonCode = reasonCode
+		recordDecision(response, "cpsRetrieve", start, outcome)
+	}
+	lg := kitlog.With(glogger, "type", "cpsRetrieve", "clientIP", clientIP, "client", client, "module", "retrievePassports")
+	if !bearerAuthorized(request, configuration.ConfigurationInstance().CpsRetrieveTokens) {
+		refuse("VESPER-4401")
+		serveHttpResponse(start, response, lg, http.StatusUnauthorized, "error", traceID, "VESPER-4401", "not authorized to retrieve PASSporTs", nil)
+		return
+	}
+	dest, orig := ps.ByName("dest"), ps.ByName("orig")
+	if !validCpsTN(dest) || !validCpsTN(orig) {
+		refuse("VESPER-4406")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4406", "dest and orig TN in path MUST be digits only", nil)
+		return
+	}
+	outcome.Orig, outcome.Dest = orig, []string{dest}
+	passports := cpsStore.Retrieve(dest, orig)
+	if len(passports) == 0 {
+		refuse("VESPER-4407")
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4407", "no PASSporTs published for dest and orig TN", nil)
+		return
+	}
+	outcome.Result = "retrieved"
+	recordDecision(response, "cpsRetrieve", start, outcome)
+	if request.URL.Query().Get("verify") != "true" {
+		serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", CpsRequest{Passports: passports})
+		return
+	}
+	results := make([]map[string]interface{}, 0, len(passports))
+	for _, p := range passports {
+		res := map[string]interface{}{"passport": p}
+		x5u, _, errCode, err := validateHeader(p, "shaken")
+		if err == nil {
+			errCode, err = validateCpsClaims(p, dest, orig, start.Unix(), traceID, clientIP)
+		}
+		if err == nil {
+			errCode, _, err = verifySignature(x5u, p, configuration.ConfigurationInstance().VerifyRootCA)
+		}
+		if err != nil {
+			res["reasonCode"] = errCode
+			res["reasonString"] = err.Error()
+		} else {
+			res["verified"] = true
+		}
+		results = append(results, res)
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{"passports": results})
+}
+
+// publishToCps - CPS client mode. Publishes a PASSporT created by signRequest to
+// the configured CPS, for each dest TN. Failures are logged only
+func publishToCps(traceID, identity, origTN string, destTNs []string) {
+	u := strings.TrimRight(configuration.ConfigurationInstance().CpsUrl, "/")
+	b, err := json.Marshal(CpsRequest{Passports: []string{strings.Split(identity, ";")[0]}})
+	if err != nil {
+		logError("type", "cpsClient", "traceID", traceID, "module", "publishToCps", "message", fmt.Sprintf("%v - unable to encode request body", err))
+		return
+	}
+	// TNs in the path are in the canonical form
+	o := canonicalTN(origTN)
+	for _, tn := range destTNs {
+		d := canonicalTN(tn)
+		if len(d) == 0 || len(o) == 0 {
+			logError("type", "cpsClient", "traceID", traceID, "module", "publishToCps", "message", fmt.Sprintf("dest TN %v or orig TN %v has no digits - not published", tn, origTN))
+			continue
+		}
+		url := u + "/passports/" + d + "/" + o
+		req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+		if err != nil {
+			logError("type", "cpsClient", "traceID", traceID, "module", "publishToCps", "message", fmt.Sprintf("%v - http.NewRequest failed", err))
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer " + configuration.ConfigurationInstance().CpsToken)
+		req.Header.Set("Trace-Id", traceID)
+		start := time.Now()
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			logError("type", "cpsClient", "traceID", traceID, "module", "publishToCps", "message", fmt.Sprintf("%v - POST %v failed", err, url))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			logError("type", "cpsClient", "traceID", traceID, "module", "publishToCps", "message", fmt.Sprintf("POST %v response status - %v", url, resp.StatusCode))
+			continue
+		}
+		logInfo("type", "cpsClient", "traceID", traceID, "module", "publishToCps", "cpsResponseTime", fmt.Sprintf("%v", time.Since(start)))
+	}
+}
@@ -0,0 +1,230 @@
+// Package cps implements the PASSporT store of an out-of-band SHAKEN Call
+// Placement Service (ATIS-1000096).
+//
+// PASSporTs are keyed by dest and orig TN and expire after a configured time.
+// The number of PASSporTs per call, and the total size of all PASSporTs, are
+// capped. The store can optionally be persisted to a file.
+//
+// This data structure is thread safe.
+package cps
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"sync"
+	"errors"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+)
+
+// entry - a published PASSporT
+type entry struct {
+	Passport	string	`json:"passport"`
+	Expires		int64		`json:"expires"`
+}
+
+var (
+	// ErrCallFull - publishing would exceed the PASSporTs allowed per call
+	ErrCallFull = errors.New("maximum number of PASSporTs for call reached")
+	// ErrStoreFull - publishing would exceed the total size of the store
+	ErrStoreFull = errors.New("maximum size of PASSporT store reached")
+)
+
+// Store - PASSporTs published for calls, keyed by dest/orig
+type Store struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	ttl				int64
+	file			string
+	perCall		int
+	maxSize		int64
+	size			int64		// total length of all stored PASSporTs
+	passports	map[string][]entry
+}
+
+func key(dest, orig string) string {
+	return dest + "/" + orig
+}
+
+// Initialize object
+// ttl is the time, in seconds, a PASSporT is kept. At most maxPerCall PASSporTs
+// are kept per call, and at most maxSize bytes of PASSporTs in total. If f is
+// not empty, PASSporTs persisted in f, that have not expired, are loaded
+func InitObject(ttl int64, f string, maxPerCall int, maxSize int64) (*Store, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("PASSporT ttl (%v) must be > 0", ttl)
+	}
+	if maxPerCall <= 0 {
+		return nil, fmt.Errorf("maximum PASSporTs per call (%v) must be > 0", maxPerCall)
+	}
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("maximum PASSporT store size (%v) must be > 0", maxSize)
+	}
+	s := &Store{ttl: ttl, file: strings.TrimSpace(f), perCall: maxPerCall, maxSize: maxSize, passports: make(map[string][]entry)}
+	if len(s.file) == 0 {
+		return s, nil
+	}
+	b, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("%v - CPS persistence file", err)
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.passports); err != nil {
+			return nil, fmt.Errorf("%v - decode JSON object in CPS persistence file", err)
+		}
+	}
+	for _, entries := range s.passports {
+		for _, e := range entries {
+			s.size += int64(len(e.Passport))
+		}
+	}
+	s.RemoveExpired()
+	return s, nil
+}
+
+// Publish stores PASSporTs for a call. PASSporTs already stored for the call are
+// kept, unless identical. Either all PASSporTs are stored, or, if a cap would be
+// exceeded, none and ErrCallFull or ErrStoreFull is returned
+func (s *Store) Publish(dest, orig string, passports []string) error {
+	s.Lock()
+	defer s.Unlock()
+	k := key(dest, orig)
+	now := time.Now().Unix()
+	// expired PASSporTs of the call do not count
+	entries := s.passports[k][:0]
+	for _, e := range s.passports[k] {
+		if e.Expires >= now {
+			entries = append(entries, e)
+		} else {
+			s.size -= int64(len(e.Passport))
+		}
+	}
+	var added []string
+	var size int64
+	for _, p := range passports {
+		if !stored(entries, p) && !contains(added, p) {
+			added = append(added, p)
+			size += int64(len(p))
+		}
+	}
+	if len(entries) + len(added) > s.perCall {
+		s.set(k, entries)
+		return ErrCallFull
+	}
+	if s.size + size > s.maxSize {
+		s.set(k, entries)
+		return ErrStoreFull
+	}
+	exp := now + s.ttl
+	for i, e := range entries {
+		if contains(passports, e.Passport) {
+			entries[i].Expires = exp
+		}
+	}
+	for _, p := range added {
+		entries = append(entries, entry{Passport: p, Expires: exp})
+	}
+	s.size += size
+	s.set(k, entries)
+	return nil
+}
+
+// set stores the entries of a call, the lock held by the caller
+func (s *Store) set(k string, entries []entry) {
+	if len(entries) == 0 {
+		delete(s.passports, k)
+	} else {
+		s.passports[k] = entries
+	}
+}
+
+func stored(entries []entry, p string) bool {
+	for _, e := range entries {
+		if e.Passport == p {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, p string) bool {
+	for _, v := range l {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Retrieve returns PASSporTs, that have not expired, for a call
+func (s *Store) Retrieve(dest, orig string) []string {
+	s.RLock()
+	defer s.RUnlock()
+	now := time.Now().Unix()
+	var p []string
+	for _, e := range s.passports[key(dest, orig)] {
+		if e.Expires >= now {
+			p = append(p, e.Passport)
+		}
+	}
+	return p
+}
+
+// RemoveExpired removes all expired PASSporTs
+func (s *Store) RemoveExpired() {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().Unix()
+	for k, entries := range s.passports {
+		e := entries[:0]
+		for _, v := range entries {
+			if v.Expires >= now {
+				e = append(e, v)
+			} else {
+				s.size -= int64(len(v.Passport))
+			}
+		}
+		s.set(k, e)
+	}
+}
+
+// Size returns the number of calls PASSporTs are stored for
+func (s *Store) Size() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.passports)
+}
+
+// Save persists all PASSporTs. The file is replaced atomically
+func (s *Store) Save() error {
+	if len(s.file) == 0 {
+		return nil
+	}
+	s.RLock()
+	b, err := json.Marshal(s.passports)
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file)
+}
@@ -0,0 +1,112 @@
+package cps
+
+import (
+	"os"
+	"time"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestPublishRetrieve(t *testing.T) {
+	s, err := InitObject(15, "", 3, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish("12155551213", "12155551212", []string{"a.b.c", "d.e.f", "a.b.c"}); err != nil {
+		t.Fatal(err)
+	}
+	// identical PASSporT is not stored twice
+	if err := s.Publish("12155551213", "12155551212", []string{"d.e.f", "g.h.i"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Retrieve("12155551213", "12155551212"); len(p) != 3 || p[0] != "a.b.c" || p[2] != "g.h.i" {
+		t.Errorf("Retrieve() = %v", p)
+	}
+	if p := s.Retrieve("12155551212", "12155551213"); len(p) != 0 {
+		t.Errorf("Retrieve() = %v - want none", p)
+	}
+	if s.Size() != 1 || s.size != 15 {
+		t.Errorf("Size() = %v, size = %v", s.Size(), s.size)
+	}
+}
+
+func TestCaps(t *testing.T) {
+	s, _ := InitObject(15, "", 2, 12)
+	s.Publish("12155551213", "12155551212", []string{"a.b.c"})
+	if err := s.Publish("12155551213", "12155551212", []string{"d.e.f", "g.h.i"}); err != ErrCallFull {
+		t.Errorf("Publish() = %v - want ErrCallFull", err)
+	}
+	if err := s.Publish("12155551214", "12155551212", []string{"d.e.f", "g.h.i"}); err != ErrStoreFull {
+		t.Errorf("Publish() = %v - want ErrStoreFull", err)
+	}
+	// nothing stored by a rejected publish
+	if p := s.Retrieve("12155551213", "12155551212"); len(p) != 1 || s.Size() != 1 || s.size != 5 {
+		t.Errorf("Retrieve() = %v, Size() = %v, size = %v", p, s.Size(), s.size)
+	}
+	// expired PASSporTs do not count
+	s.passports[key("12155551213", "12155551212")][0].Expires = time.Now().Unix() - 1
+	if err := s.Publish("12155551213", "12155551212", []string{"d.e.f", "g.h.i"}); err != nil {
+		t.Errorf("Publish() = %v after expiry", err)
+	}
+	for _, c := range []struct {
+		perCall	int
+		size		int64
+	}{
+		{0, 12},
+		{2, 0},
+	} {
+		if _, err := InitObject(15, "", c.perCall, c.size); err == nil {
+			t.Errorf("InitObject(%v, %v) - want error", c.perCall, c.size)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s, _ := InitObject(15, "", 10, 1000)
+	s.Publish("12155551213", "12155551212", []string{"a.b.c", "d.e.f"})
+	s.Publish("12155551214", "12155551212", []string{"g.h.i"})
+	s.passports[key("12155551213", "12155551212")][0].Expires = time.Now().Unix() - 1
+	if p := s.Retrieve("12155551213", "12155551212"); len(p) != 1 || p[0] != "d.e.f" {
+		t.Errorf("Retrieve() = %v - want d.e.f", p)
+	}
+	s.passports[key("12155551214", "12155551212")][0].Expires = time.Now().Unix() - 1
+	s.RemoveExpired()
+	if s.Size() != 1 || s.size != 5 {
+		t.Errorf("Size() = %v, size = %v after RemoveExpired()", s.Size(), s.size)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "cps.json")
+	s, err := InitObject(15, f, 10, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Publish("12155551213", "12155551212", []string{"a.b.c", "d.e.f"})
+	s.Publish("12155551214", "12155551212", []string{"g.h.i"})
+	s.passports[key("12155551214", "12155551212")][0].Expires = time.Now().Unix() - 1
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := InitObject(15, f, 10, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := l.Retrieve("12155551213", "12155551212"); len(p) != 2 || p[1] != "d.e.f" {
+		t.Errorf("Retrieve() = %v after reload", p)
+	}
+	if l.Size() != 1 || l.size != 10 {
+		t.Errorf("Size() = %v, size = %v after reload - want expired PASSporT dropped", l.Size(), l.size)
+	}
+
+	ioutil.WriteFile(f, []byte("{"), 0644)
+	if _, err := InitObject(15, f, 10, 1000); err == nil {
+		t.Errorf("InitObject() - want error for malformed file")
+	}
+}
@@ -0,0 +1,234 @@
+// Package delegatecredentials holds delegate certificate credentials
+// (ATIS-1000092). Each delegate has its own private key and x5u, and is scoped
+// to the telephone numbers in the TNAuthList of its certificate. A delegate is
+// only used while its certificate is valid.
+//
+// The delegates are listed in a file
+//
+//	{
+//	  "delegates": [
+//	    {
+//	      "x5u": "https://cert.example.com/delegate1.pem",
+//	      "certFile": "/etc/vesper/delegate1.pem",
+//	      "keyFile": "/etc/vesper/delegate1.key"
+//	    }
+//	  ]
+//	}
+//
+// This data structure is thread safe.
+package delegatecredentials
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"time"
+	"strings"
+	"io/ioutil"
+	"encoding/pem"
+	"encoding/json"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"vesper/tnauthlist"
+)
+
+// delegate - credentials of a delegate certificate
+type delegate struct {
+	x5u					string
+	tnAuthList	*tnauthlist.TNAuthList
+	privateKey	*ecdsa.PrivateKey
+	notBefore		time.Time
+	notAfter		time.Time
+}
+
+// valid returns true if the certificate of the delegate is valid at t
+func (d delegate) valid(t time.Time) bool {
+	return !t.Before(d.notBefore) && !t.After(d.notAfter)
+}
+
+// DelegateCredentials - structure that holds all delegate credentials
+type DelegateCredentials struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file					string
+	modifiedTime	int64
+	delegates			[]delegate
+}
+
+// Initialize object
+// Saves file modified time for future use
+func InitObject(f string) (*DelegateCredentials, error) {
+	if len(strings.TrimSpace(f)) == 0 {
+		return nil, fmt.Errorf("file name (with delegate credentials) is an empty string")
+	}
+	dc := &DelegateCredentials{file: f}
+	if _, err := dc.UpdateDelegateCredentials(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// UpdateDelegateCredentials reads the delegate credentials file only if its
+// modified time has changed, and returns true if it was read. Current
+// credentials are kept on failure
+func (dc *DelegateCredentials) UpdateDelegateCredentials() (bool, error) {
+	fi, err := os.Stat(dc.file)
+	if err != nil {
+		return false, fmt.Errorf("%v - delegate credentials file", err)
+	}
+	m := fi.ModTime().Unix()
+	dc.RLock()
+	same := dc.modifiedTime == m
+	dc.RUnlock()
+	if same {
+		return false, nil
+	}
+	d, err := readDelegateCredentialsFile(dc.file)
+	if err != nil {
+		return false, err
+	}
+	dc.Lock()
+	defer dc.Unlock()
+	dc.delegates = d
+	dc.modifiedTime = m
+	return true, nil
+}
+
+// Signing returns the x5u and private key of the delegate whose TNAuthList
+// covers tn. If more than one delegate covers tn, the one with the narrowest
+// scope is returned. Delegates whose certificate has expired, or is not yet
+// valid, are skipped
+func (dc *DelegateCredentials) Signing(tn string) (string, *ecdsa.PrivateKey, bool) {
+	dc.RLock()
+	defer dc.RUnlock()
+	now := time.Now()
+	var s int64
+	var d delegate
+	for _, v := range dc.delegates {
+		if !v.valid(now) {
+			continue
+		}
+		if n := v.tnAuthList.Scope(tn); n > 0 && (s == 0 || n < s) {
+			s = n
+			d = v
+		}
+	}
+	if s == 0 {
+		return "", nil, false
+	}
+	return d.x5u, d.privateKey, true
+}
+
+// Has returns true if x5u is the x5u of one of the delegates
+func (dc *DelegateCredentials) Has(x5u string) bool {
+	dc.RLock()
+	defer dc.RUnlock()
+	for _, v := range dc.delegates {
+		if v.x5u == x5u {
+			return true
+		}
+	}
+	return false
+}
+
+// NotValid describes each delegate whose certificate is not valid at t
+func (dc *DelegateCredentials) NotValid(t time.Time) []string {
+	dc.RLock()
+	defer dc.RUnlock()
+	var l []string
+	for i, v := range dc.delegates {
+		switch {
+		case t.Before(v.notBefore):
+			l = append(l, fmt.Sprintf("delegate %v (%v) - certificate not valid before %v", i, v.x5u, v.notBefore.UTC().Format(time.RFC3339)))
+		case t.After(v.notAfter):
+			l = append(l, fmt.Sprintf("delegate %v (%v) - certificate expired at %v", i, v.x5u, v.notAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+	return l
+}
+
+// Size returns the number of delegate credentials
+func (dc *DelegateCredentials) Size() int {
+	dc.RLock()
+	defer dc.RUnlock()
+	return len(dc.delegates)
+}
+
+func readDelegateCredentialsFile(f string) ([]delegate, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v - delegate credentials file", err)
+	}
+	var c struct {
+		Delegates []struct {
+			X5u				string	`json:"x5u"`
+			CertFile	string	`json:"certFile"`
+			KeyFile		string	`json:"keyFile"`
+		} `json:"delegates"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%v - decode JSON object in delegate credentials file", err)
+	}
+	d := make([]delegate, 0, len(c.Delegates))
+	for i, v := range c.Delegates {
+		if len(strings.TrimSpace(v.X5u)) == 0 || len(strings.TrimSpace(v.CertFile)) == 0 || len(strings.TrimSpace(v.KeyFile)) == 0 {
+			return nil, fmt.Errorf("delegate %v - \"x5u\", \"certFile\" and \"keyFile\" MUST be non-empty strings", i)
+		}
+		cert, err := readCertificate(v.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("delegate %v - %v", i, err)
+		}
+		l, err := tnauthlist.FromCertificate(cert)
+		if err != nil {
+			return nil, fmt.Errorf("delegate %v - %v - %v", i, err, v.CertFile)
+		}
+		p, err := readPrivateKey(v.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("delegate %v - %v", i, err)
+		}
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok || pub.X.Cmp(p.X) != 0 || pub.Y.Cmp(p.Y) != 0 {
+			return nil, fmt.Errorf("delegate %v - private key in %v does not match certificate in %v", i, v.KeyFile, v.CertFile)
+		}
+		d = append(d, delegate{x5u: v.X5u, tnAuthList: l, privateKey: p, notBefore: cert.NotBefore, notAfter: cert.NotAfter})
+	}
+	return d, nil
+}
+
+// readCertificate - the delegate certificate is the first certificate in f
+func readCertificate(f string) (*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found in %v", f)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// readPrivateKey - alg = ES256
+func readPrivateKey(f string) (*ecdsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %v", f)
+	}
+	if p, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return p, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%v - %v", err, f)
+	}
+	p, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %v is not an EC key", f)
+	}
+	return p, nil
+}
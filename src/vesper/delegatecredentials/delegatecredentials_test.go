@@ -0,0 +1,154 @@
+package delegatecredentials
+
+import (
+	"os"
+	"time"
+	"testing"
+	"math/big"
+	"io/ioutil"
+	"crypto/rand"
+	"encoding/pem"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"encoding/json"
+	"encoding/asn1"
+	"crypto/elliptic"
+	"vesper/tnauthlist"
+)
+
+type tnRange struct {
+	Start	string	`asn1:"ia5"`
+	Count	int
+}
+
+type testDelegate struct {
+	X5u				string	`json:"x5u"`
+	CertFile	string	`json:"certFile"`
+	KeyFile		string	`json:"keyFile"`
+}
+
+// writeDelegate writes a self-signed delegate certificate, with a TNAuthList of
+// TN range start/count, and its key, and returns the delegates file entry
+func writeDelegate(t *testing.T, dir, name, start string, count int, notBefore, notAfter time.Time) testDelegate {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := asn1.Marshal(tnRange{Start: start, Count: count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: r}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore: notBefore,
+		NotAfter: notAfter,
+		ExtraExtensions: []pkix.Extension{{Id: tnauthlist.OID, Value: l}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := testDelegate{X5u: "https://cert.example.com/" + name + ".pem", CertFile: filepath.Join(dir, name + ".pem"), KeyFile: filepath.Join(dir, name + ".key")}
+	ioutil.WriteFile(d.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(d.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600)
+	return d
+}
+
+func writeDelegates(t *testing.T, f string, d ...testDelegate) {
+	b, _ := json.Marshal(map[string]interface{}{"delegates": d})
+	if err := ioutil.WriteFile(f, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSigning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delegates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	wide := writeDelegate(t, dir, "wide", "12155551000", 1000, now.Add(-time.Hour), now.Add(time.Hour))
+	narrow := writeDelegate(t, dir, "narrow", "12155551200", 10, now.Add(-time.Hour), now.Add(time.Hour))
+	expired := writeDelegate(t, dir, "expired", "12155551200", 2, now.Add(-2 * time.Hour), now.Add(-time.Hour))
+	future := writeDelegate(t, dir, "future", "12155551205", 2, now.Add(time.Hour), now.Add(2 * time.Hour))
+	f := filepath.Join(dir, "delegates.json")
+	writeDelegates(t, f, wide, narrow, expired, future)
+
+	dc, err := InitObject(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dc.Size() != 4 {
+		t.Errorf("Size() = %v - want 4", dc.Size())
+	}
+	tests := map[string]string{
+		"12155551500": wide.X5u,
+		"12155551201": narrow.X5u,		// expired delegate skipped
+		"12155551205": narrow.X5u,		// not yet valid delegate skipped
+		"12155552000": "",
+	}
+	for tn, x5u := range tests {
+		x, p, ok := dc.Signing(tn)
+		if x != x5u || ok != (len(x5u) > 0) || ok != (p != nil) {
+			t.Errorf("Signing(%v) = %v, %v - want %v", tn, x, ok, x5u)
+		}
+	}
+	if l := dc.NotValid(now); len(l) != 2 {
+		t.Errorf("NotValid() = %v - want expired and future", l)
+	}
+	if !dc.Has(expired.X5u) || dc.Has("https://cert.example.com/other.pem") {
+		t.Errorf("Has() - want true for delegate x5u's only")
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delegates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	d := writeDelegate(t, dir, "d", "12155551000", 1000, now.Add(-time.Hour), now.Add(time.Hour))
+	other := writeDelegate(t, dir, "other", "12155551000", 1000, now.Add(-time.Hour), now.Add(time.Hour))
+	f := filepath.Join(dir, "delegates.json")
+
+	ioutil.WriteFile(f, []byte(`{"delegates": [`), 0644)
+	if _, err := InitObject(f); err == nil {
+		t.Errorf("InitObject() - want error for malformed JSON")
+	}
+	writeDelegates(t, f, testDelegate{X5u: d.X5u, CertFile: d.CertFile})
+	if _, err := InitObject(f); err == nil {
+		t.Errorf("InitObject() - want error for missing keyFile")
+	}
+	writeDelegates(t, f, testDelegate{X5u: d.X5u, CertFile: d.CertFile, KeyFile: other.KeyFile})
+	if _, err := InitObject(f); err == nil {
+		t.Errorf("InitObject() - want error for key not matching certificate")
+	}
+	writeDelegates(t, f, testDelegate{X5u: d.X5u, CertFile: d.KeyFile, KeyFile: d.KeyFile})
+	if _, err := InitObject(f); err == nil {
+		t.Errorf("InitObject() - want error for certFile without certificate")
+	}
+
+	// a failed reload keeps current credentials
+	writeDelegates(t, f, d)
+	dc, err := InitObject(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(f, []byte("{"), 0644)
+	os.Chtimes(f, now.Add(time.Minute), now.Add(time.Minute))
+	if reloaded, err := dc.UpdateDelegateCredentials(); err == nil || reloaded || dc.Size() != 1 {
+		t.Errorf("UpdateDelegateCredentials() = %v, %v, Size() = %v - want error, credentials kept", reloaded, err, dc.Size())
+	}
+}
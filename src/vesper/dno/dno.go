@@ -0,0 +1,171 @@
+// Package dno holds the Do-Not-Originate (DNO) list - TNs that never originate
+// calls (e.g. inbound-only government and bank numbers). A call from a DNO TN
+// is spoofed.
+//
+// The list is read from a file
+//
+//	{
+//	  "tns": ["18005551212"],
+//	  "ranges": [
+//	    {
+//	      "start": "18005550000",
+//	      "end": "18005550999"
+//	    }
+//	  ]
+//	}
+//
+// This data structure is thread safe.
+package dno
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+// Range - TNs from Start to End, both included. Start and End have the same
+// number of digits
+type Range struct {
+	Start	string	`json:"start"`
+	End		string	`json:"end"`
+}
+
+// List - DNO list
+type List struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file					string
+	modifiedTime	int64
+	tns						map[string]struct{}
+	ranges				map[int][]Range		// by number of digits - sorted, not overlapping
+}
+
+// Initialize object
+// Saves file modified time for future use
+func InitObject(f string) (*List, error) {
+	if len(strings.TrimSpace(f)) == 0 {
+		return nil, fmt.Errorf("file name (with DNO list) is an empty string")
+	}
+	l := &List{file: f}
+	if err := l.UpdateList(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// UpdateList reads the DNO list file only if its modified time has changed.
+// The current list is kept on failure
+func (l *List) UpdateList() error {
+	fi, err := os.Stat(l.file)
+	if err != nil {
+		return fmt.Errorf("%v - DNO list file", err)
+	}
+	m := fi.ModTime().Unix()
+	l.RLock()
+	same := l.modifiedTime == m
+	l.RUnlock()
+	if same {
+		return nil
+	}
+	b, err := ioutil.ReadFile(l.file)
+	if err != nil {
+		return fmt.Errorf("%v - DNO list file", err)
+	}
+	tns, ranges, err := parse(b)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.tns = tns
+	l.ranges = ranges
+	l.modifiedTime = m
+	return nil
+}
+
+// Contains returns true if tn is on the DNO list
+func (l *List) Contains(tn string) bool {
+	l.RLock()
+	defer l.RUnlock()
+	if _, ok := l.tns[tn]; ok {
+		return true
+	}
+	r := l.ranges[len(tn)]
+	// first range ending at or after tn
+	i := sort.Search(len(r), func(i int) bool { return r[i].End >= tn })
+	return i < len(r) && r[i].Start <= tn
+}
+
+// Size returns the number of TNs and ranges on the DNO list
+func (l *List) Size() (int, int) {
+	l.RLock()
+	defer l.RUnlock()
+	n := 0
+	for _, r := range l.ranges {
+		n += len(r)
+	}
+	return len(l.tns), n
+}
+
+func parse(b []byte) (map[string]struct{}, map[int][]Range, error) {
+	var c struct {
+		TNs			[]string	`json:"tns"`
+		Ranges	[]Range		`json:"ranges"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("%v - decode JSON object in DNO list file", err)
+	}
+	tns := make(map[string]struct{}, len(c.TNs))
+	for _, v := range c.TNs {
+		if !digits(v) {
+			return nil, nil, fmt.Errorf("tn %v in DNO list file MUST be digits only", v)
+		}
+		tns[v] = struct{}{}
+	}
+	ranges := make(map[int][]Range)
+	for _, v := range c.Ranges {
+		if !digits(v.Start) || !digits(v.End) || len(v.Start) != len(v.End) || v.Start > v.End {
+			return nil, nil, fmt.Errorf("range %v - %v in DNO list file MUST be digits only, of the same length, with start <= end", v.Start, v.End)
+		}
+		ranges[len(v.Start)] = append(ranges[len(v.Start)], v)
+	}
+	for k, r := range ranges {
+		ranges[k] = merge(r)
+	}
+	return tns, ranges, nil
+}
+
+// merge sorts ranges of the same length and merges overlapping ones, so that a
+// TN is matched by binary search
+func merge(r []Range) []Range {
+	sort.Slice(r, func(i, j int) bool { return r[i].Start < r[j].Start })
+	m := r[:1]
+	for _, v := range r[1:] {
+		last := &m[len(m)-1]
+		if v.Start <= last.End {
+			if v.End > last.End {
+				last.End = v.End
+			}
+			continue
+		}
+		m = append(m, v)
+	}
+	return m
+}
+
+func digits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
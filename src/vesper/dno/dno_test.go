@@ -0,0 +1,52 @@
+package dno
+
+import (
+	"testing"
+)
+
+func TestContains(t *testing.T) {
+	tns, ranges, err := parse([]byte(`{
+		"tns": ["12025551212"],
+		"ranges": [
+			{"start": "18005550000", "end": "18005550999"},
+			{"start": "18005550500", "end": "18005551499"},
+			{"start": "18885550000", "end": "18885550000"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &List{tns: tns, ranges: ranges}
+	if n, r := l.Size(); n != 1 || r != 2 {
+		t.Errorf("Size() = %v, %v - want 1, 2", n, r)
+	}
+	for tn, want := range map[string]bool{
+		"12025551212": true,
+		"12025551213": false,
+		"18005550000": true,
+		"18005551000": true,
+		"18005551499": true,
+		"18005551500": false,
+		"18005549999": false,
+		"18885550000": true,
+		"1800555000": false,
+		"": false,
+	} {
+		if got := l.Contains(tn); got != want {
+			t.Errorf("Contains(%v) = %v - want %v", tn, got, want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, b := range []string{
+		`{"tns": ["+12025551212"]}`,
+		`{"ranges": [{"start": "18005550999", "end": "18005550000"}]}`,
+		`{"ranges": [{"start": "1800555000", "end": "18005550999"}]}`,
+		`[]`,
+	} {
+		if _, _, err := parse([]byte(b)); err == nil {
+			t.Errorf("parse(%v) - want error", b)
+		}
+	}
+}
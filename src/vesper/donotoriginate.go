@@ -0,0 +1,33 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"vesper/configuration"
+)
+
+// dnoSigning refuses to sign for an orig TN on the Do-Not-Originate list - the
+// call is spoofed. The TN is checked in the canonical form (digits only), so
+// that "+" and visual separators do not hide it
+func dnoSigning(origTN string) (int, string, error) {
+	if dnoList != nil && dnoList.Contains(canonicalTN(origTN)) {
+		return http.StatusForbidden, "VESPER-4050", fmt.Errorf("orig TN %v is on the Do-Not-Originate list", origTN)
+	}
+	return http.StatusOK, "", nil
+}
+
+// dnoVerification checks the orig TN of a verified call against the
+// Do-Not-Originate list. Returns an error if the TN is on the list - fail is
+// true if verification MUST fail (dno_verification_policy "fail"), false if the
+// call is only flagged. The TN is checked in the canonical form
+func dnoVerification(origTN string) (bool, string, error) {
+	if dnoList == nil || !dnoList.Contains(canonicalTN(origTN)) {
+		return false, "", nil
+	}
+	if configuration.ConfigurationInstance().DnoVerificationPolicy == "fail" {
+		return true, "VESPER-4211", fmt.Errorf("orig TN %v is on the Do-Not-Originate list - verification failed", origTN)
+	}
+	return false, "VESPER-4210", fmt.Errorf("orig TN %v is on the Do-Not-Originate list", origTN)
+}
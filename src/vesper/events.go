@@ -0,0 +1,69 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"vesper/audit"
+	"vesper/events"
+	"vesper/publickeys"
+	"vesper/configuration"
+)
+
+// initEvents creates the event pipeline with the configured sinks - "file"
+// and/or "webhook"
+func initEvents() (*events.Pipeline, error) {
+	c := configuration.ConfigurationInstance()
+	p, err := events.InitObject(c.EventsBufferSize, c.EventsBatchSize, time.Duration(c.EventsFlushInterval)*time.Second, func(sink string, err error) {
+		logError("type", "events", "sink", sink, "message", fmt.Sprintf("%v - unable to deliver events", err))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if f := strings.TrimSpace(c.EventsFile); len(f) > 0 {
+		s, err := events.NewFileSink(f, c.EventsFileMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		p.AddSink("file", s)
+	}
+	if u := strings.TrimSpace(c.EventsWebhookUrl); len(u) > 0 {
+		s, err := events.NewWebhookSink(u, c.EventsWebhookToken, time.Duration(c.EventsWebhookTimeout)*time.Second, c.EventsWebhookRetries)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.AddSink("webhook", s)
+	}
+	return p, nil
+}
+
+// publishEvent publishes a signing or verification decision (typ "signing" or
+// "verification") of a request started at start, if events are enabled. The
+// SPC is that of the certificate of the x5u, if known
+func publishEvent(typ string, start time.Time, e audit.Entry) {
+	if eventPipeline == nil {
+		return
+	}
+	now := time.Now()
+	ev := events.Event{
+		Time: now.UnixNano() / int64(time.Millisecond),
+		Type: typ,
+		TraceID: e.TraceID,
+		Client: e.Client,
+		Result: e.Result,
+		ReasonCode: e.ReasonCode,
+		Orig: e.Orig,
+		Dest: e.Dest,
+		Attest: e.Attest,
+		OrigID: e.OrigID,
+		X5u: e.X5u,
+		Latency: float64(now.Sub(start)) / float64(time.Millisecond),
+	}
+	if len(e.X5u) > 0 {
+		ev.SPC = publickeys.SPC(e.X5u)
+	}
+	eventPipeline.Publish(ev)
+}
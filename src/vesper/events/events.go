@@ -0,0 +1,193 @@
+// Package events delivers signing and verification decisions, as structured
+// events, to sinks (e.g. an NDJSON file or a webhook) asynchronously.
+//
+// Each sink has a bounded buffer - events published while it is full are
+// dropped, and counted, so that a slow sink never slows requests down. Events
+// are written to a sink in batches, when a batch is full or every flush
+// interval.
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"sync/atomic"
+)
+
+// Event - a signing or verification decision
+type Event struct {
+	Time				int64			`json:"time"`														// in milliseconds
+	Type				string		`json:"type"`														// "signing", "verification", "cpsPublish" or "cpsRetrieve"
+	TraceID			string		`json:"traceID"`
+	Client			string		`json:"client,omitempty"`
+	Result			string		`json:"result"`													// "signed", "refused", "verified", "failed", "unverified", "published" or "retrieved"
+	ReasonCode	string		`json:"reasonCode,omitempty"`
+	Orig				string		`json:"orig,omitempty"`
+	Dest				[]string	`json:"dest,omitempty"`
+	Attest			string		`json:"attest,omitempty"`
+	OrigID			string		`json:"origid,omitempty"`
+	X5u					string		`json:"x5u,omitempty"`
+	SPC					string		`json:"spc,omitempty"`
+	Latency			float64		`json:"latency"`												// in milliseconds
+}
+
+// Sink - destination of events
+type Sink interface {
+	// Write writes a batch of events. The batch is not used after Write returns
+	Write(batch []Event) error
+	Close() error
+}
+
+// SinkStats - counts of events of a sink
+type SinkStats struct {
+	Published		int64		`json:"published"`
+	Dropped			int64		`json:"dropped"`			// buffer full
+	Delivered		int64		`json:"delivered"`
+	Failed			int64		`json:"failed"`				// the sink failed to write them
+}
+
+type queue struct {
+	name					string
+	sink					Sink
+	events				chan Event
+	batchSize			int
+	flush					time.Duration
+	onError				func(string, error)
+	published			int64
+	dropped				int64
+	delivered			int64
+	failed				int64
+	done					chan struct{}
+}
+
+// Pipeline - fans events out to sinks
+type Pipeline struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	bufferSize		int
+	batchSize			int
+	flush					time.Duration
+	onError				func(string, error)
+	queues				[]*queue
+	closed				bool
+}
+
+// Initialize object
+// Each sink buffers up to bufferSize events, and is written batches of up to
+// batchSize events, at least every flush. onError is called (from the goroutine
+// of the sink) with the name of a sink that failed to write a batch
+func InitObject(bufferSize, batchSize int, flush time.Duration, onError func(string, error)) (*Pipeline, error) {
+	if bufferSize < 1 || batchSize < 1 || flush <= 0 {
+		return nil, fmt.Errorf("events buffer size, batch size and flush interval MUST be > 0")
+	}
+	return &Pipeline{bufferSize: bufferSize, batchSize: batchSize, flush: flush, onError: onError}, nil
+}
+
+// AddSink starts delivering events to sink s, named name
+func (p *Pipeline) AddSink(name string, s Sink) {
+	q := &queue{
+		name: name,
+		sink: s,
+		events: make(chan Event, p.bufferSize),
+		batchSize: p.batchSize,
+		flush: p.flush,
+		onError: p.onError,
+		done: make(chan struct{}),
+	}
+	p.Lock()
+	p.queues = append(p.queues, q)
+	p.Unlock()
+	go q.run()
+}
+
+// Publish queues an event for all sinks. It never blocks - the event is dropped
+// for a sink whose buffer is full
+func (p *Pipeline) Publish(e Event) {
+	p.RLock()
+	defer p.RUnlock()
+	if p.closed {
+		return
+	}
+	for _, q := range p.queues {
+		select {
+		case q.events <- e:
+			atomic.AddInt64(&q.published, 1)
+		default:
+			atomic.AddInt64(&q.dropped, 1)
+		}
+	}
+}
+
+// Stats returns the counts of events of each sink, by name
+func (p *Pipeline) Stats() map[string]SinkStats {
+	p.RLock()
+	defer p.RUnlock()
+	m := make(map[string]SinkStats)
+	for _, q := range p.queues {
+		m[q.name] = SinkStats{
+			Published: atomic.LoadInt64(&q.published),
+			Dropped: atomic.LoadInt64(&q.dropped),
+			Delivered: atomic.LoadInt64(&q.delivered),
+			Failed: atomic.LoadInt64(&q.failed),
+		}
+	}
+	return m
+}
+
+// Close writes the buffered events and closes the sinks. Events published
+// afterwards are discarded
+func (p *Pipeline) Close() {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q.events)
+	}
+	p.Unlock()
+	for _, q := range p.queues {
+		<- q.done
+		q.sink.Close()
+	}
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+	t := time.NewTicker(q.flush)
+	defer t.Stop()
+	batch := make([]Event, 0, q.batchSize)
+	for {
+		select {
+		case e, ok := <- q.events:
+			if !ok {
+				q.write(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= q.batchSize {
+				q.write(batch)
+				batch = batch[:0]
+			}
+		case <- t.C:
+			q.write(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (q *queue) write(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := q.sink.Write(batch); err != nil {
+		atomic.AddInt64(&q.failed, int64(len(batch)))
+		if q.onError != nil {
+			q.onError(q.name, err)
+		}
+		return
+	}
+	atomic.AddInt64(&q.delivered, int64(len(batch)))
+}
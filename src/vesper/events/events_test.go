@@ -0,0 +1,147 @@
+package events
+
+import (
+	"os"
+	"sync"
+	"time"
+	"strconv"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"encoding/json"
+	"net/http/httptest"
+)
+
+type memorySink struct {
+	sync.Mutex
+	batches		[][]Event
+	block			chan struct{}
+}
+
+func (s *memorySink) Write(batch []Event) error {
+	if s.block != nil {
+		<- s.block
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.batches = append(s.batches, append([]Event(nil), batch...))
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestPipeline(t *testing.T) {
+	p, err := InitObject(10, 3, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &memorySink{}
+	p.AddSink("memory", s)
+	for i := 0; i < 8; i++ {
+		p.Publish(Event{Type: "signing", TraceID: strconv.Itoa(i)})
+	}
+	p.Close()
+	p.Publish(Event{Type: "signing"})
+	if st := p.Stats()["memory"]; st.Published != 8 || st.Delivered != 8 || st.Dropped != 0 {
+		t.Errorf("Stats() = %+v", st)
+	}
+	if len(s.batches) != 3 || len(s.batches[0]) != 3 || len(s.batches[2]) != 2 || s.batches[0][0].TraceID != "0" || s.batches[2][1].TraceID != "7" {
+		t.Errorf("batches = %+v", s.batches)
+	}
+}
+
+func TestPipelineDrops(t *testing.T) {
+	p, _ := InitObject(10, 3, time.Hour, nil)
+	s := &memorySink{block: make(chan struct{})}
+	p.AddSink("slow", s)
+	for i := 0; i < 3; i++ {
+		p.Publish(Event{Type: "verification"})
+	}
+	time.Sleep(50 * time.Millisecond)		// the first batch is being written
+	for i := 0; i < 17; i++ {
+		p.Publish(Event{Type: "verification"})
+	}
+	close(s.block)
+	p.Close()
+	// 3 in the batch being written, 10 buffered
+	if st := p.Stats()["slow"]; st.Published != 13 || st.Delivered != 13 || st.Dropped != 7 {
+		t.Errorf("Stats() = %+v", st)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "events", "events.log")
+	s, err := NewFileSink(f, 1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write([]Event{{Type: "signing", TraceID: "1"}, {Type: "verification", TraceID: "2", Dest: []string{"12155551213"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write([]Event{{Type: "signing", TraceID: "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%v = %q - want 3 lines", f, b)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil || e.TraceID != "2" || e.Dest[0] != "12155551213" {
+		t.Errorf("line 2 = %v (%v)", lines[1], err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	calls := 0
+	var got struct {
+		Events	[]Event	`json:"events"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	s, err := NewWebhookSink(srv.URL, "token1", time.Second, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.backoff = time.Millisecond
+	if err := s.Write([]Event{{Type: "verification", TraceID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || len(got.Events) != 1 || got.Events[0].TraceID != "1" {
+		t.Errorf("calls = %v, events = %+v - want a retry, then 1 event", calls, got.Events)
+	}
+
+	s.token = "token2"
+	calls = 1
+	if err := s.Write([]Event{{Type: "verification"}}); err == nil || calls != 2 {
+		t.Errorf("Write() = %v, calls = %v - want 401 error, without retry", err, calls)
+	}
+
+	if _, err := NewWebhookSink("ftp://events.example.com", "", time.Second, 0); err == nil {
+		t.Errorf("NewWebhookSink(ftp://...) - want error")
+	}
+}
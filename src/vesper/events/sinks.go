@@ -0,0 +1,123 @@
+package events
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"bytes"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+	"github.com/comcast/irislogger"
+)
+
+// FileSink - writes events to a file, one JSON object per line (NDJSON). The
+// file is rotated (and compressed) when it reaches its maximum size
+type FileSink struct {
+	w			*irislogger.Logger
+}
+
+// NewFileSink - sink of events to file f, rotated at maxSize bytes
+func NewFileSink(f string, maxSize int64) (*FileSink, error) {
+	if len(f) == 0 {
+		return nil, fmt.Errorf("events file MUST be specified")
+	}
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		return nil, err
+	}
+	return &FileSink{w: irislogger.New(f, maxSize)}, nil
+}
+
+// Write appends a batch of events
+func (s *FileSink) Write(batch []Event) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range batch {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	_, err := s.w.Write(b.Bytes())
+	return err
+}
+
+// Close - the file is closed at exit
+func (s *FileSink) Close() error {
+	return nil
+}
+
+// WebhookSink - POSTs batches of events, as {"events": [...]}, to a URL.
+// Failed batches are retried on network errors, 429 and 5xx responses
+type WebhookSink struct {
+	url				string
+	token			string
+	client		*http.Client
+	retries		int
+	backoff		time.Duration		// doubled on each retry
+}
+
+// NewWebhookSink - sink of events to webhook u. token, if not empty, is sent as
+// a bearer token. Each POST times out after timeout, and a failed batch is
+// retried up to retries times
+func NewWebhookSink(u, token string, timeout time.Duration, retries int) (*WebhookSink, error) {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || len(p.Host) == 0 {
+		return nil, fmt.Errorf("events webhook URL %v MUST be an http or https URL", u)
+	}
+	if retries < 0 {
+		return nil, fmt.Errorf("events webhook retries MUST be >= 0")
+	}
+	return &WebhookSink{url: u, token: token, client: &http.Client{Timeout: timeout}, retries: retries, backoff: time.Second}, nil
+}
+
+// Write POSTs a batch of events, with retries
+func (s *WebhookSink) Write(batch []Event) error {
+	body, err := json.Marshal(map[string]interface{}{"events": batch})
+	if err != nil {
+		return err
+	}
+	d := s.backoff
+	for i := 0; ; i++ {
+		retry, err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || i >= s.retries {
+			return err
+		}
+		time.Sleep(d)
+		d *= 2
+	}
+}
+
+// post returns whether a failed POST may be retried
+func (s *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.token) > 0 {
+		req.Header.Set("Authorization", "Bearer " + s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("%v - POST %v failed", err, s.url)
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("POST %v response status - %v", s.url, resp.Status)
+	}
+	return false, fmt.Errorf("POST %v response status - %v", s.url, resp.Status)
+}
+
+// Close - nothing to release
+func (s *WebhookSink) Close() error {
+	return nil
+}
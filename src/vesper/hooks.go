@@ -0,0 +1,90 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"net/http"
+	"vesper/hooks"
+	"vesper/attestpolicy"
+	"vesper/publickeys"
+	"vesper/configuration"
+)
+
+// initHooks creates the pre-sign and post-verify hooks, if configured
+func initHooks() (pre, post *hooks.Hook, err error) {
+	c := configuration.ConfigurationInstance()
+	if u := strings.TrimSpace(c.PreSignHookUrl); len(u) > 0 {
+		if pre, err = hooks.InitObject(u, c.PreSignHookToken, time.Duration(c.PreSignHookTimeout)*time.Millisecond, c.PreSignHookPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
+	if u := strings.TrimSpace(c.PostVerifyHookUrl); len(u) > 0 {
+		if post, err = hooks.InitObject(u, c.PostVerifyHookToken, time.Duration(c.PostVerifyHookTimeout)*time.Millisecond, c.PostVerifyHookPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pre, post, nil
+}
+
+// applyPreSignHook asks the pre-sign hook, if configured, whether to sign the
+// claims in orderedMap. attest in orderedMap is set to the attest decided by
+// the hook, if any. With an attestation policy decision, the hook may lower
+// attest, and decision is updated to match, but not raise it above decision.
+// Returns the response of the hook, nil if it was not called or failed open
+func applyPreSignHook(traceID, client string, orderedMap map[string]interface{}, origTN string, destTNs []string, iat int64, origID string, decision *attestpolicy.Decision) (*hooks.PreSignResponse, int, string, error) {
+	if preSignHook == nil {
+		return nil, http.StatusOK, "", nil
+	}
+	attest, _ := orderedMap["attest"].(string)
+	resp, err := preSignHook.PreSign(hooks.PreSignRequest{TraceID: traceID, Client: client, Orig: origTN, Dest: destTNs, Attest: attest, OrigID: origID, Iat: iat})
+	if err != nil {
+		logError("type", "preSignHook", "traceID", traceID, "message", fmt.Sprintf("%v - pre-sign hook failed", err))
+		if preSignHook.FailOpen() {
+			return nil, http.StatusOK, "", nil
+		}
+		return nil, http.StatusServiceUnavailable, "VESPER-5070", fmt.Errorf("pre-sign hook failed - signing is not possible")
+	}
+	if resp.Action == "deny" {
+		return &resp, http.StatusForbidden, "VESPER-4046", fmt.Errorf("signing denied by pre-sign hook - %v", resp.Reason)
+	}
+	if len(resp.Attest) > 0 && decision != nil {
+		// A is the highest attest, C the lowest
+		if resp.Attest < decision.Attest {
+			logInfo("type", "preSignHook", "traceID", traceID, "message", fmt.Sprintf("attest %v of pre-sign hook is above attest %v of attestation policy - %v kept", resp.Attest, decision.Attest, decision.Attest))
+			resp.Attest = decision.Attest
+		} else if resp.Attest > decision.Attest {
+			decision.Attest, decision.Reason = resp.Attest, "lowered by pre-sign hook"
+			if len(resp.Reason) > 0 {
+				decision.Reason += " - " + resp.Reason
+			}
+		}
+	}
+	if len(resp.Attest) > 0 {
+		orderedMap["attest"] = resp.Attest
+	}
+	return &resp, http.StatusOK, "", nil
+}
+
+// applyPostVerifyHook calls the post-verify hook, if configured, for a
+// verified call, and adds its response to vr (verificationResponse), as
+// "postVerifyHook"
+func applyPostVerifyHook(traceID, client string, vr map[string]interface{}, origTN string, destTNs []string, iat int64, attest, origID, x5u string) (string, error) {
+	if postVerifyHook == nil {
+		return "", nil
+	}
+	m, err := postVerifyHook.PostVerify(hooks.PostVerifyRequest{TraceID: traceID, Client: client, Orig: origTN, Dest: destTNs, Attest: attest, OrigID: origID, Iat: iat, X5u: x5u, SPC: publickeys.SPC(x5u)})
+	if err != nil {
+		logError("type", "postVerifyHook", "traceID", traceID, "message", fmt.Sprintf("%v - post-verify hook failed", err))
+		if postVerifyHook.FailOpen() {
+			return "", nil
+		}
+		return "VESPER-5071", fmt.Errorf("post-verify hook failed - verification is not possible")
+	}
+	if len(m) > 0 {
+		vr["postVerifyHook"] = m
+	}
+	return "", nil
+}
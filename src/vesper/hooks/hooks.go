@@ -0,0 +1,141 @@
+// Package hooks calls out synchronously to an external decision service (e.g.
+// a fraud engine) - before signing, to allow or deny signing, or change
+// attest, and after verification, to add to the verification response.
+//
+// A hook is an HTTP POST of a JSON object, answered with a JSON object, within
+// a strict timeout. When a hook fails (network error, timeout, non-2xx status or
+// invalid response), its policy decides - "open" carries on as if there was no
+// hook, "closed" fails the request.
+package hooks
+
+import (
+	"io"
+	"fmt"
+	"time"
+	"bytes"
+	"net/url"
+	"net/http"
+	"encoding/json"
+)
+
+// maximum size of a hook response body
+const maxResponseSize = 1 << 20
+
+// Hook - a synchronous HTTP callout
+type Hook struct {
+	url				string
+	token			string
+	client		*http.Client
+	failOpen	bool
+}
+
+// PreSignRequest - body of a pre-sign hook request
+type PreSignRequest struct {
+	TraceID		string		`json:"traceID"`
+	Client		string		`json:"client,omitempty"`
+	Orig			string		`json:"orig"`
+	Dest			[]string	`json:"dest"`
+	Attest		string		`json:"attest"`
+	OrigID		string		`json:"origid"`
+	Iat				int64			`json:"iat"`
+}
+
+// PreSignResponse - body of a pre-sign hook response. Action is "allow" or
+// "deny". With "allow", Attest, if not empty, is the attest to sign with
+type PreSignResponse struct {
+	Action		string		`json:"action"`
+	Attest		string		`json:"attest,omitempty"`
+	Reason		string		`json:"reason,omitempty"`
+}
+
+// PostVerifyRequest - body of a post-verify hook request
+type PostVerifyRequest struct {
+	TraceID		string		`json:"traceID"`
+	Client		string		`json:"client,omitempty"`
+	Orig			string		`json:"orig"`
+	Dest			[]string	`json:"dest"`
+	Attest		string		`json:"attest"`
+	OrigID		string		`json:"origid"`
+	Iat				int64			`json:"iat"`
+	X5u				string		`json:"x5u"`
+	SPC				string		`json:"spc,omitempty"`
+}
+
+// Initialize object
+// u is the URL POSTed to, token (if not empty) is sent as a bearer token, and
+// policy is "open" or "closed"
+func InitObject(u, token string, timeout time.Duration, policy string) (*Hook, error) {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || len(p.Host) == 0 {
+		return nil, fmt.Errorf("hook URL %v MUST be an http or https URL", u)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("hook timeout MUST be > 0")
+	}
+	if policy != "open" && policy != "closed" {
+		return nil, fmt.Errorf("hook policy %v MUST be \"open\" or \"closed\"", policy)
+	}
+	return &Hook{url: u, token: token, client: &http.Client{Timeout: timeout}, failOpen: policy == "open"}, nil
+}
+
+// FailOpen returns true if a failed hook is ignored
+func (h *Hook) FailOpen() bool {
+	return h.failOpen
+}
+
+// PreSign calls a pre-sign hook
+func (h *Hook) PreSign(req PreSignRequest) (PreSignResponse, error) {
+	var resp PreSignResponse
+	if err := h.call(req, &resp); err != nil {
+		return resp, err
+	}
+	switch resp.Action {
+	case "allow":
+		switch resp.Attest {
+		case "", "A", "B", "C":
+		default:
+			return resp, fmt.Errorf("attest %v in response of hook %v MUST be A, B or C", resp.Attest, h.url)
+		}
+	case "deny":
+	default:
+		return resp, fmt.Errorf("action %v in response of hook %v MUST be \"allow\" or \"deny\"", resp.Action, h.url)
+	}
+	return resp, nil
+}
+
+// PostVerify calls a post-verify hook, and returns the JSON object it responds
+// with
+func (h *Hook) PostVerify(req PostVerifyRequest) (map[string]interface{}, error) {
+	var resp map[string]interface{}
+	if err := h.call(req, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (h *Hook) call(req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", h.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if len(h.token) > 0 {
+		r.Header.Set("Authorization", "Bearer " + h.token)
+	}
+	res, err := h.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("%v - POST %v failed", err, h.url)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("POST %v response status - %v", h.url, res.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(resp); err != nil {
+		return fmt.Errorf("POST %v response status - %v; unable to parse JSON object in response body - %v", h.url, res.StatusCode, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"time"
+	"testing"
+	"net/http"
+	"encoding/json"
+	"net/http/httptest"
+)
+
+func TestPreSign(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PreSignRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Orig {
+		case "12155551212":
+			w.Write([]byte(`{"action":"allow","attest":"B","reason":"new customer"}`))
+		case "12155551213":
+			w.Write([]byte(`{"action":"deny","reason":"fraud"}`))
+		case "12155551214":
+			w.Write([]byte(`{"action":"allow","attest":"D"}`))
+		case "12155551215":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"action":"allow"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	h, err := InitObject(srv.URL, "", 100 * time.Millisecond, "closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := h.PreSign(PreSignRequest{Orig: "12155551212", Attest: "A"}); err != nil || resp.Action != "allow" || resp.Attest != "B" {
+		t.Errorf("PreSign() = %+v, %v - want allow, attest B", resp, err)
+	}
+	if resp, err := h.PreSign(PreSignRequest{Orig: "12155551213"}); err != nil || resp.Action != "deny" || resp.Reason != "fraud" {
+		t.Errorf("PreSign() = %+v, %v - want deny", resp, err)
+	}
+	for _, orig := range []string{"12155551214", "12155551215", "12155551216"} {
+		if resp, err := h.PreSign(PreSignRequest{Orig: orig}); err == nil {
+			t.Errorf("PreSign(%v) = %+v - want error", orig, resp)
+		}
+	}
+}
+
+func TestPostVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"reputationScore":87}`))
+	}))
+	defer srv.Close()
+
+	h, _ := InitObject(srv.URL, "token1", time.Second, "open")
+	if m, err := h.PostVerify(PostVerifyRequest{Orig: "12155551212"}); err != nil || m["reputationScore"] != float64(87) {
+		t.Errorf("PostVerify() = %v, %v", m, err)
+	}
+	if !h.FailOpen() {
+		t.Errorf("FailOpen() = false")
+	}
+}
+
+func TestInitObject(t *testing.T) {
+	for _, c := range []struct {
+		u				string
+		timeout	time.Duration
+		policy	string
+	}{
+		{"ftp://hooks.example.com", time.Second, "open"},
+		{"https://hooks.example.com", 0, "open"},
+		{"https://hooks.example.com", time.Second, "ignore"},
+	} {
+		if _, err := InitObject(c.u, "", c.timeout, c.policy); err == nil {
+			t.Errorf("InitObject(%v, %v, %v) - want error", c.u, c.timeout, c.policy)
+		}
+	}
+}
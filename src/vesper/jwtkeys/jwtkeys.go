@@ -0,0 +1,138 @@
+// Package jwtkeys verifies the ES256 signatures of bearer JWTs with the public
+// keys of their app_key, retrieved from <url>/<app_key>.pub.
+//
+// An app_key MUST match a strict pattern and, if a list of app keys is
+// configured, be one of them - before any key is retrieved. Only PEM encoded
+// ECDSA public keys are cached. Failed retrievals are not cached, so that a key
+// provisioned later is picked up.
+//
+// This data structure is thread safe.
+package jwtkeys
+
+import (
+	"io"
+	"fmt"
+	"sync"
+	"regexp"
+	"strings"
+	"math/big"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/sha256"
+	"encoding/pem"
+	"encoding/base64"
+)
+
+// maximum size of a public key response body
+const maxKeySize = 16 << 10
+
+// appKeyPattern - app keys are used in the URL of their public key
+var appKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Keys - public keys of app keys
+type Keys struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	url				string
+	allowed		map[string]bool
+	client		*http.Client
+	keys			map[string]*ecdsa.PublicKey
+}
+
+// Initialize object
+// u is the URL public keys are retrieved from, with client. allowed, if not
+// empty, are the only app keys accepted
+func InitObject(u string, allowed []string, client *http.Client) (*Keys, error) {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || len(p.Host) == 0 {
+		return nil, fmt.Errorf("public key URL %v MUST be an http or https URL", u)
+	}
+	k := &Keys{url: strings.TrimRight(u, "/"), client: client, keys: make(map[string]*ecdsa.PublicKey)}
+	if len(allowed) > 0 {
+		k.allowed = make(map[string]bool, len(allowed))
+		for _, a := range allowed {
+			if !appKeyPattern.MatchString(a) {
+				return nil, fmt.Errorf("app key %v MUST match %v", a, appKeyPattern)
+			}
+			k.allowed[a] = true
+		}
+	}
+	return k, nil
+}
+
+// Verify verifies the ES256 signature of token with the public key of appKey
+func (k *Keys) Verify(token, appKey string) error {
+	if !appKeyPattern.MatchString(appKey) {
+		return fmt.Errorf("app_key does not match %v", appKeyPattern)
+	}
+	if k.allowed != nil && !k.allowed[appKey] {
+		return fmt.Errorf("app_key %v is not allowed", appKey)
+	}
+	pub, err := k.key(appKey)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("token contains an invalid number of segments")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil || len(sig) != 64 {
+		return fmt.Errorf("invalid ES256 signature")
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pub, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return fmt.Errorf("unable to verify ES256 signature")
+	}
+	return nil
+}
+
+// Clear removes all cached public keys
+func (k *Keys) Clear() {
+	k.Lock()
+	defer k.Unlock()
+	k.keys = make(map[string]*ecdsa.PublicKey)
+}
+
+// key returns the cached public key of appKey, else retrieves it
+func (k *Keys) key(appKey string) (*ecdsa.PublicKey, error) {
+	k.RLock()
+	pub, ok := k.keys[appKey]
+	k.RUnlock()
+	if ok {
+		return pub, nil
+	}
+	u := k.url + "/" + appKey + ".pub"
+	resp, err := k.client.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("%v - GET %v failed", err, u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v response status - %v", u, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxKeySize))
+	if err != nil {
+		return nil, fmt.Errorf("%v - GET %v failed", err, u)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in response of GET %v", u)
+	}
+	p, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%v - public key in response of GET %v", err, u)
+	}
+	pub, ok = p.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in response of GET %v is not an ECDSA public key", u)
+	}
+	k.Lock()
+	k.keys[appKey] = pub
+	k.Unlock()
+	return pub, nil
+}
@@ -0,0 +1,106 @@
+package jwtkeys
+
+import (
+	"time"
+	"testing"
+	"net/http"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/sha256"
+	"encoding/pem"
+	"crypto/elliptic"
+	"encoding/base64"
+	"net/http/httptest"
+)
+
+// sign returns an ES256 JWT with claims c, signed with k
+func sign(t *testing.T, k *ecdsa.PrivateKey, c string) string {
+	s := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(c))
+	h := sha256.Sum256([]byte(s))
+	r, v, err := ecdsa.Sign(rand.Reader, k, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	rb, vb := r.Bytes(), v.Bytes()
+	copy(sig[32 - len(rb):32], rb)
+	copy(sig[64 - len(vb):], vb)
+	return s + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	provisioned := false
+	gets := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		switch {
+		case r.URL.Path == "/app1.pub":
+			w.Write(pub)
+		case r.URL.Path == "/app2.pub" && provisioned:
+			w.Write(pub)
+		case r.URL.Path == "/app3.pub":
+			w.Write([]byte("not a key"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	keys, err := InitObject(srv.URL + "/", nil, &http.Client{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, k, `{"app_key":"app1"}`)
+	for i := 0; i < 2; i++ {
+		if err := keys.Verify(token, "app1"); err != nil {
+			t.Errorf("Verify() = %v", err)
+		}
+	}
+	if gets != 1 {
+		t.Errorf("%v GETs - want public key cached", gets)
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := keys.Verify(sign(t, other, `{"app_key":"app1"}`), "app1"); err == nil {
+		t.Errorf("Verify() - want error for signature of another key")
+	}
+	if err := keys.Verify(token[:len(token) - 4], "app1"); err == nil {
+		t.Errorf("Verify() - want error for truncated signature")
+	}
+	for _, a := range []string{"../admin", "app1/x", "", "app 1"} {
+		if err := keys.Verify(token, a); err == nil {
+			t.Errorf("Verify(%q) - want error for invalid app_key", a)
+		}
+	}
+	if err := keys.Verify(token, "app3"); err == nil {
+		t.Errorf("Verify() - want error for response without PEM key")
+	}
+
+	// failed retrievals are not cached
+	if err := keys.Verify(token, "app2"); err == nil {
+		t.Errorf("Verify() - want error before key is provisioned")
+	}
+	provisioned = true
+	if err := keys.Verify(token, "app2"); err != nil {
+		t.Errorf("Verify() = %v after key is provisioned", err)
+	}
+
+	// only allowed app keys are retrieved
+	keys, _ = InitObject(srv.URL, []string{"app2"}, &http.Client{Timeout: time.Second})
+	gets = 0
+	if err := keys.Verify(token, "app1"); err == nil || gets != 0 {
+		t.Errorf("Verify() = %v, %v GETs - want error, no GET for app key not allowed", err, gets)
+	}
+}
+
+func TestInitObject(t *testing.T) {
+	if _, err := InitObject("ftp://keys.example.com", nil, http.DefaultClient); err == nil {
+		t.Errorf("InitObject() - want error for ftp URL")
+	}
+	if _, err := InitObject("https://keys.example.com", []string{"../x"}, http.DefaultClient); err == nil {
+		t.Errorf("InitObject() - want error for invalid app key")
+	}
+}
@@ -0,0 +1,330 @@
+// Package ledger is the append-only signing ledger - a record of every PASSporT
+// signed, for traceback (who originated a call with a given origid or orig TN,
+// at a given time).
+//
+// Records are appended to one file per UTC day, ledger-YYYY-MM-DD.ndjson, one
+// JSON object per line. Files older than the retention period are removed.
+// Only indexes are held in memory - for each day, the location (offset and
+// length) in its file of each record, by origid and orig TN. Records are read
+// from the day files on query.
+//
+// This data structure is thread safe.
+package ledger
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"bufio"
+	"io"
+	"strings"
+	"path/filepath"
+	"encoding/json"
+)
+
+// Record - a signed PASSporT
+type Record struct {
+	Time			int64			`json:"time"`			// time of signing, in seconds
+	TraceID		string		`json:"traceID"`
+	OrigID		string		`json:"origid"`
+	Orig			string		`json:"orig"`
+	Dest			[]string	`json:"dest"`
+	Attest		string		`json:"attest"`
+	Iat				int64			`json:"iat"`
+	X5u				string		`json:"x5u"`
+	Client		string		`json:"client"`		// client the PASSporT was signed for
+}
+
+// Query - records matching all set fields are returned. From and To are times
+// in seconds, both included
+type Query struct {
+	OrigID	string
+	Orig		string
+	From		int64
+	To			int64
+	Limit		int
+}
+
+// location - of a record in its day file
+type location struct {
+	offset	int64
+	length	int
+}
+
+// day - index of the records of a day
+type day struct {
+	records			[]location
+	byOrigID		map[string][]location
+	byOrig			map[string][]location
+	size				int64				// of the day file
+	terminated	bool				// the day file ends with a new line
+}
+
+// Ledger - signing ledger
+type Ledger struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	dir				string
+	retention	int		// days
+	days			map[string]*day
+	file			*os.File
+	fileDay		string
+}
+
+const layout = "2006-01-02"
+
+// Initialize object
+// Records of the last retention days, in dir, are loaded
+func InitObject(dir string, retention int) (*Ledger, error) {
+	if len(strings.TrimSpace(dir)) == 0 {
+		return nil, fmt.Errorf("signing ledger directory is an empty string")
+	}
+	if retention < 1 {
+		return nil, fmt.Errorf("signing ledger retention %v MUST be > 0 days", retention)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("%v - signing ledger directory", err)
+	}
+	l := &Ledger{dir: dir, retention: retention, days: make(map[string]*day)}
+	l.RemoveExpired(time.Now())
+	files, err := filepath.Glob(filepath.Join(dir, "ledger-*.ndjson"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		d, ok := dayOf(f)
+		if !ok {
+			continue
+		}
+		if err := l.load(f, d); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Append records a signed PASSporT. The record is written to the file of the
+// day of r.Time before it is indexed
+func (l *Ledger) Append(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	k := time.Unix(r.Time, 0).UTC().Format(layout)
+	l.Lock()
+	defer l.Unlock()
+	d := l.day(k)
+	if l.file == nil || l.fileDay != k {
+		if l.file != nil {
+			l.file.Close()
+			l.file = nil
+		}
+		f, err := os.OpenFile(l.fileName(k), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return fmt.Errorf("%v - signing ledger file", err)
+		}
+		l.file, l.fileDay = f, k
+	}
+	if d.size > 0 && !d.terminated {
+		// a torn last line (e.g. after a crash) is terminated, so that the record
+		// starts a line of its own
+		if _, err := l.file.Write([]byte{'\n'}); err != nil {
+			return fmt.Errorf("%v - signing ledger file", err)
+		}
+		d.size++
+		d.terminated = true
+	}
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%v - signing ledger file", err)
+	}
+	d.add(location{offset: d.size, length: len(b)}, r)
+	d.size += int64(len(b)) + 1
+	return nil
+}
+
+// Find returns the records matching q, oldest first. Records are read from the
+// day files
+func (l *Ledger) Find(q Query) ([]Record, error) {
+	l.RLock()
+	defer l.RUnlock()
+	keys := make([]string, 0, len(l.days))
+	for k := range l.days {
+		if q.From > 0 && k < time.Unix(q.From, 0).UTC().Format(layout) {
+			continue
+		}
+		if q.To > 0 && k > time.Unix(q.To, 0).UTC().Format(layout) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := []Record{}
+	for _, k := range keys {
+		d := l.days[k]
+		locs := d.records
+		switch {
+		case len(q.OrigID) > 0:
+			locs = d.byOrigID[q.OrigID]
+		case len(q.Orig) > 0:
+			locs = d.byOrig[q.Orig]
+		}
+		if len(locs) == 0 {
+			continue
+		}
+		done, err := l.read(k, locs, func(r Record) bool {
+			if (len(q.Orig) > 0 && r.Orig != q.Orig) || (q.From > 0 && r.Time < q.From) || (q.To > 0 && r.Time > q.To) {
+				return false
+			}
+			res = append(res, r)
+			return q.Limit > 0 && len(res) == q.Limit
+		})
+		if err != nil || done {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// read reads the records at locs of the file of day k, in order, and calls f
+// with each until f returns true. Returns true if f did - caller holds the lock
+func (l *Ledger) read(k string, locs []location, f func(Record) bool) (bool, error) {
+	fd, err := os.Open(l.fileName(k))
+	if err != nil {
+		return false, fmt.Errorf("%v - signing ledger file", err)
+	}
+	defer fd.Close()
+	var b []byte
+	for _, loc := range locs {
+		if cap(b) < loc.length {
+			b = make([]byte, loc.length)
+		}
+		b = b[:loc.length]
+		if _, err := fd.ReadAt(b, loc.offset); err != nil {
+			return false, fmt.Errorf("%v - signing ledger file of %v", err, k)
+		}
+		var r Record
+		if err := json.Unmarshal(b, &r); err != nil {
+			return false, fmt.Errorf("%v - signing ledger file of %v at offset %v", err, k, loc.offset)
+		}
+		if f(r) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RemoveExpired removes the records and files of days older than the retention
+// period
+func (l *Ledger) RemoveExpired(now time.Time) {
+	oldest := now.UTC().AddDate(0, 0, -l.retention + 1).Format(layout)
+	l.Lock()
+	defer l.Unlock()
+	for k := range l.days {
+		if k < oldest {
+			delete(l.days, k)
+		}
+	}
+	if l.file != nil && l.fileDay < oldest {
+		l.file.Close()
+		l.file = nil
+	}
+	files, _ := filepath.Glob(filepath.Join(l.dir, "ledger-*.ndjson"))
+	for _, f := range files {
+		if d, ok := dayOf(f); ok && d < oldest {
+			os.Remove(f)
+		}
+	}
+}
+
+// Size returns the number of records indexed
+func (l *Ledger) Size() int {
+	l.RLock()
+	defer l.RUnlock()
+	n := 0
+	for _, d := range l.days {
+		n += len(d.records)
+	}
+	return n
+}
+
+// Close closes the file of the current day
+func (l *Ledger) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// load indexes the records of a day file. A truncated last line (e.g. after a
+// crash) is skipped
+func (l *Ledger) load(f, k string) error {
+	fd, err := os.Open(f)
+	if err != nil {
+		return fmt.Errorf("%v - signing ledger file", err)
+	}
+	defer fd.Close()
+	d := l.day(k)
+	br := bufio.NewReader(fd)
+	for {
+		line, err := br.ReadBytes('\n')
+		n := len(line)
+		if n > 0 && line[n-1] == '\n' {
+			line = line[:n-1]
+			d.terminated = true
+		} else {
+			d.terminated = false
+		}
+		var r Record
+		if len(line) > 0 && json.Unmarshal(line, &r) == nil {
+			d.add(location{offset: d.size, length: len(line)}, r)
+		}
+		d.size += int64(n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v - signing ledger file", err)
+		}
+	}
+}
+
+// day returns the index of day k, created if there is none - caller holds the
+// lock
+func (l *Ledger) day(k string) *day {
+	d, ok := l.days[k]
+	if !ok {
+		d = &day{byOrigID: make(map[string][]location), byOrig: make(map[string][]location), terminated: true}
+		l.days[k] = d
+	}
+	return d
+}
+
+// add indexes record r at loc
+func (d *day) add(loc location, r Record) {
+	d.records = append(d.records, loc)
+	if len(r.OrigID) > 0 {
+		d.byOrigID[r.OrigID] = append(d.byOrigID[r.OrigID], loc)
+	}
+	d.byOrig[r.Orig] = append(d.byOrig[r.Orig], loc)
+}
+
+func (l *Ledger) fileName(d string) string {
+	return filepath.Join(l.dir, "ledger-" + d + ".ndjson")
+}
+
+// dayOf returns the day of a ledger file
+func dayOf(f string) (string, bool) {
+	b := filepath.Base(f)
+	d := strings.TrimSuffix(strings.TrimPrefix(b, "ledger-"), ".ndjson")
+	if _, err := time.Parse(layout, d); err != nil {
+		return "", false
+	}
+	return d, true
+}
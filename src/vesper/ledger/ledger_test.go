@@ -0,0 +1,97 @@
+package ledger
+
+import (
+	"os"
+	"time"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now().Unix()
+	l, err := InitObject(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []Record{
+		{Time: now - 86400, OrigID: "a", Orig: "12155551212", Dest: []string{"12155551213"}, Attest: "A", Iat: now - 86400},
+		{Time: now - 10, OrigID: "b", Orig: "12155551212", Dest: []string{"12155551214"}, Attest: "B", Iat: now - 10},
+		{Time: now, OrigID: "c", Orig: "12155551299", Dest: []string{"12155551214"}, Attest: "A", Iat: now},
+	}
+	for _, r := range records {
+		if err := l.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+	// records are reloaded from the day files
+	l, err = InitObject(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if n := l.Size(); n != 3 {
+		t.Fatalf("Size() = %v - want 3", n)
+	}
+	for _, c := range []struct {
+		q			Query
+		want	[]string
+	}{
+		{Query{OrigID: "b"}, []string{"b"}},
+		{Query{Orig: "12155551212"}, []string{"a", "b"}},
+		{Query{Orig: "12155551212", From: now - 100}, []string{"b"}},
+		{Query{OrigID: "a", Orig: "12155551299"}, []string{}},
+		{Query{From: now - 100, To: now}, []string{"b", "c"}},
+		{Query{Limit: 1}, []string{"a"}},
+	} {
+		got, err := l.Find(c.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("Find(%+v) = %v records - want %v", c.q, len(got), len(c.want))
+			continue
+		}
+		for i, r := range got {
+			if r.OrigID != c.want[i] {
+				t.Errorf("Find(%+v)[%v] = %v - want %v", c.q, i, r.OrigID, c.want[i])
+			}
+		}
+	}
+	// a torn last line is skipped, and the next record starts a line of its own
+	f := filepath.Join(dir, "ledger-" + time.Unix(now, 0).UTC().Format(layout) + ".ndjson")
+	fd, err := os.OpenFile(f, os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Write([]byte(`{"time":`))
+	fd.Close()
+	l.Close()
+	if l, err = InitObject(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Record{Time: now, OrigID: "d", Orig: "12155551299", Dest: []string{"12155551214"}, Attest: "A", Iat: now}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if l, err = InitObject(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := l.Find(Query{Orig: "12155551299"}); err != nil || len(got) != 2 || got[1].OrigID != "d" {
+		t.Errorf("Find() after a torn line = %+v, %v - want c, d", got, err)
+	}
+	// retention
+	l.RemoveExpired(time.Now().AddDate(0, 0, 2))
+	if n := l.Size(); n != 0 {
+		t.Errorf("Size() after RemoveExpired = %v - want 0", n)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.ndjson")); len(files) != 0 {
+		t.Errorf("%v ledger files after RemoveExpired - want 0", len(files))
+	}
+}
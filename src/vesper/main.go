@@ -10,6 +10,9 @@ import (
 	"os/signal"
 	"syscall"
 	"context"
+	"io/ioutil"
+	"crypto/tls"
+	"crypto/x509"
 	"time"
 	"strings"
 	"regexp"
@@ -20,8 +23,26 @@ import (
 	"vesper/eks"
 	"vesper/sticr"
 	"vesper/signcredentials"
+	"vesper/delegatecredentials"
+	"vesper/attestpolicy"
 	"vesper/replayattack"
 	"vesper/publickeys"
+	"vesper/sip"
+	"vesper/cps"
+	"vesper/tninventory"
+	"vesper/dno"
+	"vesper/numbering"
+	"vesper/ledger"
+	"vesper/audit"
+	"vesper/origids"
+	"vesper/clientauth"
+	"vesper/jwtkeys"
+	"vesper/ratelimit"
+	"vesper/trustedproxy"
+	"vesper/acl"
+	"vesper/analytics"
+	"vesper/events"
+	"vesper/hooks"
 	kitlog "github.com/go-kit/kit/log"
 )
 
@@ -29,13 +50,33 @@ var (
 	glogger											kitlog.Logger
 	rootCerts										*rootcerts.RootCerts
 	signingCredentials					*signcredentials.SigningCredentials
+	delegateCredentials					*delegatecredentials.DelegateCredentials
+	rphSigner										*rphCredential
+	attestPolicy								*attestpolicy.Policy
 	eksCredentials							*eks.EksCredentials
 	x5u													*sticr.SticrHost
 	httpClient									*http.Client
-	regexInfo										*regexp.Regexp
-	regexAlg										*regexp.Regexp
-	regexPpt										*regexp.Regexp
+	regexInfo										= regexp.MustCompile(`^info=<..*>$`)
+	regexAlg										= regexp.MustCompile(`^alg=ES256$`)
+	regexPpt										= regexp.MustCompile(`^ppt=shaken$`)
 	replayAttackCache						*replayattack.Cache
+	cpsStore										*cps.Store
+	tnInventory									*tninventory.Inventory
+	dnoList											*dno.List
+	numberingPlan								*numbering.Plan
+	signingLedger								*ledger.Ledger
+	auditLog										*audit.Log
+	origIDRegistry							*origids.Registry
+	clientIdentities						*clientauth.Identities
+	jwtKeys											*jwtkeys.Keys
+	tlsConfig										*tls.Config
+	rateLimiters								= make(map[string]*ratelimit.Limiter)
+	trustedProxies							*trustedproxy.Proxies
+	accessControlLists					*acl.ACL
+	analyticsStore							*analytics.Store
+	eventPipeline								*events.Pipeline
+	preSignHook									*hooks.Hook
+	postVerifyHook							*hooks.Hook
 )
 
 // ErrorBlob -- This is a standard error object
@@ -46,7 +87,12 @@ type ErrorBlob struct {
 
 // Read config file
 // Instantiate logging
-func init() {
+// Called by main, not from init, so that the package can be tested
+func initialize() {
+	// vesper audit ... - audit log tools, run without a config file
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(auditCommand(os.Args[2:]))
+	}
 	if (len(os.Args) != 2) {
 		log.Fatal("The config file (ABSOLUTE PATH + FILE NAME) must be the only command line arguement")
 	}
@@ -64,7 +110,7 @@ func init() {
 	}
 
 	// create http client object once - to be reused
-	httpClient = &http.Client{Timeout: time.Duration(2 * time.Second)}
+	httpClient = &http.Client{Timeout: time.Duration(2 * time.Second), Transport: outboundTransport{http.DefaultTransport}}
 	
 	// initiatlize sks credentials object
 	eksCredentials, err = eks.InitObject(configuration.ConfigurationInstance().EksCredentialsFile)
@@ -72,6 +118,7 @@ func init() {
 		logCritical("type", "eksConfig", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
 		os.Exit(1)
 	}
+	markRefreshed("eks")
 
 	// initiatlize sticr object
 	x5u, err = sticr.InitObject(configuration.ConfigurationInstance().SticrHostFile)
@@ -80,12 +127,213 @@ func init() {
 		os.Exit(2)
 	}	
 	
+	// forwarding headers are honored only from trusted proxies
+	trustedProxies, err = trustedproxy.InitObject(configuration.ConfigurationInstance().TrustedProxies, configuration.ConfigurationInstance().TrustedProxyHeader)
+	if err != nil {
+		logCritical("type", "trustedProxies", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+		os.Exit(17)
+	}
+
+	// requests to each endpoint are allowed only from the networks in its ACL,
+	// if acl_file is configured
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().AclFile)) > 0 {
+		accessControlLists, err = acl.InitObject(configuration.ConfigurationInstance().AclFile)
+		if err != nil {
+			logCritical("type", "acl", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(18)
+		}
+	}
+
+	// verification outcomes are aggregated by signer and attest, if enabled
+	if configuration.ConfigurationInstance().AnalyticsEnabled {
+		analyticsStore, err = analytics.InitObject(int(configuration.ConfigurationInstance().AnalyticsRetention))
+		if err != nil {
+			logCritical("type", "analytics", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(19)
+		}
+	}
+
+	// signing and verification decisions are delivered as events to an NDJSON file
+	// and/or a webhook, if configured
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().EventsFile)) > 0 || len(strings.TrimSpace(configuration.ConfigurationInstance().EventsWebhookUrl)) > 0 {
+		eventPipeline, err = initEvents()
+		if err != nil {
+			logCritical("type", "events", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(20)
+		}
+	}
+
+	// the decision service is called out to before signing and after verification,
+	// if configured
+	preSignHook, postVerifyHook, err = initHooks()
+	if err != nil {
+		logCritical("type", "hooks", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+		os.Exit(21)
+	}
+
+	// clients are authenticated with TLS client certificates, if client_ca_file is
+	// configured, and authorized by client identity
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().ClientCAFile)) > 0 {
+		if len(strings.TrimSpace(configuration.ConfigurationInstance().SslCertFile)) == 0 || len(strings.TrimSpace(configuration.ConfigurationInstance().SslKeyFile)) == 0 {
+			logCritical("type", "clientAuthentication", "message", "client_ca_file requires ssl_cert_file and ssl_key_file.... cannot start Vesper Service .... ")
+			os.Exit(14)
+		}
+		b, err := ioutil.ReadFile(configuration.ConfigurationInstance().ClientCAFile)
+		if err != nil {
+			logCritical("type", "clientAuthentication", "message", fmt.Sprintf("%v - client CA file.... cannot start Vesper Service .... ", err))
+			os.Exit(14)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			logCritical("type", "clientAuthentication", "message", "no PEM certificates in client CA file.... cannot start Vesper Service .... ")
+			os.Exit(14)
+		}
+		// requests without a certificate are rejected (and logged) by authorize
+		tlsConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+		clientIdentities, err = clientauth.InitObject(configuration.ConfigurationInstance().ClientIdentitiesFile)
+		if err != nil {
+			logCritical("type", "clientAuthentication", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(14)
+		}
+	}
+
+	// SIP clients are authenticated with TLS client certificates, if client_ca_file
+	// is configured - SIP listeners are then TLS only. Otherwise SIP signing
+	// requests are accepted only from the networks allowed by the ACL of
+	// /sip/signing - an ACL file reloaded without an allow list for /sip/signing
+	// is rejected
+	if clientIdentities != nil {
+		for _, t := range append(configuration.ConfigurationInstance().SipSigningTransports, configuration.ConfigurationInstance().SipVerificationTransports...) {
+			if !strings.EqualFold(t, "tls") {
+				logCritical("type", "sipSigning", "message", fmt.Sprintf("SIP transport %v does not authenticate clients - client_ca_file requires tls only in sip_signing_transports and sip_verification_transports.... cannot start Vesper Service .... ", t))
+				os.Exit(22)
+			}
+		}
+	} else if len(configuration.ConfigurationInstance().SipSigningTransports) > 0 && (accessControlLists == nil || !accessControlLists.Require("/sip/signing")) {
+		logCritical("type", "sipSigning", "message", "sip_signing_transports requires acl_file with an allow list for /sip/signing, or client_ca_file.... cannot start Vesper Service .... ")
+		os.Exit(22)
+	}
+
+	// clients are authenticated with bearer JWTs, if jwt_auth_enabled is
+	// configured, and authorized by scope. Public keys of JWTs are retrieved from
+	// jwt_public_key_url, for the app keys of jwt_app_keys if configured
+	if configuration.ConfigurationInstance().JwtAuthEnabled {
+		if len(strings.TrimSpace(configuration.ConfigurationInstance().JwtPublicKeyUrl)) == 0 {
+			logCritical("type", "jwtAuthentication", "message", "jwt_auth_enabled requires jwt_public_key_url.... cannot start Vesper Service .... ")
+			os.Exit(15)
+		}
+		jwtKeys, err = jwtkeys.InitObject(configuration.ConfigurationInstance().JwtPublicKeyUrl, configuration.ConfigurationInstance().JwtAppKeys, httpClient)
+		if err != nil {
+			logCritical("type", "jwtAuthentication", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(15)
+		}
+	}
+
+	// signing and verification requests of each client are rate limited, if
+	// configured. Clients are identified by authenticated identity, else by IP
+	for p, l := range map[string]ratelimit.Limit{
+		clientauth.Signing			: {Rate: configuration.ConfigurationInstance().SigningRateLimit, Burst: configuration.ConfigurationInstance().SigningRateBurst, Quota: configuration.ConfigurationInstance().SigningDailyQuota},
+		clientauth.Verification	: {Rate: configuration.ConfigurationInstance().VerificationRateLimit, Burst: configuration.ConfigurationInstance().VerificationRateBurst, Quota: configuration.ConfigurationInstance().VerificationDailyQuota},
+	} {
+		if l.Rate == 0 && l.Quota == 0 {
+			continue
+		}
+		rateLimiters[p], err = ratelimit.InitObject(l)
+		if err != nil {
+			logCritical("type", "rateLimit", "message", fmt.Sprintf("%v - %v.... cannot start Vesper Service .... ", err, p))
+			os.Exit(16)
+		}
+	}
+
+	// origids are issued and managed by vesper, if the origid registry is enabled
+	if configuration.ConfigurationInstance().OrigIDRegistryEnabled {
+		origIDRegistry, err = origids.InitObject(configuration.ConfigurationInstance().OrigIDRegistryFile)
+		if err != nil {
+			logCritical("type", "origIDRegistry", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(13)
+		}
+	}
+
+	// calls from TNs on the Do-Not-Originate list are refused at signing and
+	// flagged (or failed) at verification, if a DNO list is configured
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().DnoFile)) > 0 {
+		dnoList, err = dno.InitObject(configuration.ConfigurationInstance().DnoFile)
+		if err != nil {
+			logCritical("type", "dnoList", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(9)
+		}
+	}
+	switch configuration.ConfigurationInstance().DnoVerificationPolicy {
+	case "flag", "fail":
+	default:
+		logCritical("type", "dnoList", "message", fmt.Sprintf("dno_verification_policy %v MUST be \"flag\" or \"fail\".... cannot start Vesper Service .... ", configuration.ConfigurationInstance().DnoVerificationPolicy))
+		os.Exit(9)
+	}
+
+	// TNs are validated against the numbering plan, if numbering data is configured
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().NumberingFile)) > 0 {
+		numberingPlan, err = numbering.InitObject(configuration.ConfigurationInstance().NumberingFile)
+		if err != nil {
+			logCritical("type", "numberingPlan", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(10)
+		}
+	}
+
 	// After sks credentials object is successfully initialized, initiatlize rootcerts object
 	signingCredentials, err = signcredentials.InitObject(glogger, softwareVersion, httpClient, eksCredentials, x5u)
 	if err != nil {
 		logCritical("type", "signingCredentials", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
 		os.Exit(3)
 	}
+	markRefreshed("signing_credentials")
+
+	// delegate certificates are used to sign PASSporTs for the TNs they are scoped to
+	switch configuration.ConfigurationInstance().SigningMode {
+	case "spc":
+	case "delegate":
+		delegateCredentials, err = delegatecredentials.InitObject(configuration.ConfigurationInstance().DelegateCredentialsFile)
+		if err != nil {
+			logCritical("type", "delegateCredentials", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(6)
+		}
+		for _, m := range delegateCredentials.NotValid(time.Now()) {
+			logError("type", "delegateCredentials", "message", m + " - skipped")
+		}
+	default:
+		logCritical("type", "signingMode", "message", fmt.Sprintf("signing_mode %v MUST be \"spc\" or \"delegate\".... cannot start Vesper Service .... ", configuration.ConfigurationInstance().SigningMode))
+		os.Exit(6)
+	}
+
+	// rph PASSporTs (RFC 8443) are signed with their own credential, if configured
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().RphCertFile)) > 0 || len(strings.TrimSpace(configuration.ConfigurationInstance().RphKeyFile)) > 0 {
+		rphSigner, err = loadRphCredential(configuration.ConfigurationInstance().RphX5u, configuration.ConfigurationInstance().RphCertFile, configuration.ConfigurationInstance().RphKeyFile)
+		if err != nil {
+			logCritical("type", "rphCredential", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(23)
+		}
+	}
+
+	// attest is decided by policy, if an attestation policy is configured
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().AttestPolicyFile)) > 0 {
+		attestPolicy, err = attestpolicy.InitObject(configuration.ConfigurationInstance().AttestPolicyFile)
+		if err != nil {
+			logCritical("type", "attestPolicy", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(7)
+		}
+	}
+
+	// instantiate TN inventory, if enabled. TNs in the inventory are assigned to
+	// their customers in attestation policy decisions
+	if configuration.ConfigurationInstance().TnInventoryEnabled {
+		tnInventory, err = tninventory.InitObject(configuration.ConfigurationInstance().TnInventoryFile)
+		if err != nil {
+			logCritical("type", "tnInventory", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(8)
+		}
+		if attestPolicy != nil {
+			attestPolicy.SetOwnership(tnInventory.Owner)
+		}
+	}
 
 	// After sks credentials object is successfully initialized, initiatlize rootcerts object
 	rootCerts, err = rootcerts.InitObject(glogger, softwareVersion, httpClient, eksCredentials)
@@ -93,18 +341,47 @@ func init() {
 		logCritical("type", "rootCerts", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
 		os.Exit(4)
 	}
+	markRefreshed("root_certs")
 	
 	// instantiate cache to hold stringified claims from identity header in request payload, during verification
 	replayAttackCache = replayattack.InitObject()
 	
-	// Compile the expression once
-	regexInfo = regexp.MustCompile(`^info=<..*>$`)
-	regexAlg = regexp.MustCompile(`^alg=ES256$`)
-	regexPpt = regexp.MustCompile(`^ppt=shaken$`)
+	// instantiate PASSporT store of the call placement service, if enabled
+	if configuration.ConfigurationInstance().CpsEnabled {
+		cpsStore, err = cps.InitObject(configuration.ConfigurationInstance().CpsPassportTTL, configuration.ConfigurationInstance().CpsPersistenceFile, configuration.ConfigurationInstance().CpsMaxPassportsPerCall, configuration.ConfigurationInstance().CpsMaxStoreSize)
+		if err != nil {
+			logCritical("type", "cpsStore", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(5)
+		}
+	}
+
+	// every signed PASSporT is recorded in the signing ledger, if enabled
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().LedgerDir)) > 0 {
+		signingLedger, err = ledger.InitObject(configuration.ConfigurationInstance().LedgerDir, int(configuration.ConfigurationInstance().LedgerRetention))
+		if err != nil {
+			logCritical("type", "signingLedger", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(11)
+		}
+	}
+
+	// signing and verification decisions are recorded in the audit log, if enabled.
+	// Segments are sealed with the SPC signing key
+	if len(strings.TrimSpace(configuration.ConfigurationInstance().AuditDir)) > 0 {
+		var signer audit.Signer
+		if configuration.ConfigurationInstance().AuditSeal {
+			signer = signingCredentials.Signing
+		}
+		auditLog, err = audit.InitObject(configuration.ConfigurationInstance().AuditDir, signer)
+		if err != nil {
+			logCritical("type", "auditLog", "message", fmt.Sprintf("%v.... cannot start Vesper Service .... ", err))
+			os.Exit(12)
+		}
+	}
 }
 
 //
 func main() {
+	initialize()
 	logInfo("type", "start", "message", "Starting vesper .... ")
 	stop := make(chan os.Signal, 1)
 	signal.Ignore(syscall.SIGPIPE)
@@ -112,20 +389,53 @@ func main() {
 
 	router := httprouter.New()
 	router.GET("/v1/version", version)
-	router.GET("/stir/v1/stats", getStats)
-	router.POST("/stir/v1/signing", signRequest)
-	router.POST("/stir/v1/verification", verifyRequest)
-	router.POST("/stir/v1/resetstats", resetStats)
+	router.GET("/stir/v1/stats", authorize(clientauth.Stats, getStats))
+	router.GET("/stir/v1/stats/windows", authorize(clientauth.Stats, getStatsWindows))
+	router.GET("/metrics", authorize(clientauth.Stats, getMetrics))
+	router.POST("/stir/v1/signing", authorize(clientauth.Signing, signRequest))
+	router.POST("/stir/v1/signing/invite", authorize(clientauth.Signing, signInvite))
+	if rphSigner != nil {
+		router.POST("/stir/v1/signing/rph", authorize(clientauth.Rph, signRph))
+	}
+	router.POST("/stir/v1/messaging/signing", authorize(clientauth.Signing, signMessage))
+	router.POST("/stir/v1/messaging/verification", authorize(clientauth.Verification, verifyMessage))
+	router.POST("/stir/v1/verification", authorize(clientauth.Verification, verifyRequest))
+	router.POST("/stir/v1/resetstats", authorize(clientauth.Stats, resetStats))
+	if cpsStore != nil {
+		router.POST("/stir/v1/cps/passports/:dest/:orig", authorize(clientauth.Signing, publishPassports))
+		router.GET("/stir/v1/cps/passports/:dest/:orig", authorize(clientauth.Verification, retrievePassports))
+	}
+	if tnInventory != nil {
+		router.GET("/stir/v1/admin/tns", authorize(clientauth.Admin, listTns))
+		router.POST("/stir/v1/admin/tns", authorize(clientauth.Admin, createTn))
+		router.POST("/stir/v1/admin/tns/import", authorize(clientauth.Admin, importTns))
+		router.GET("/stir/v1/admin/tns/:id", authorize(clientauth.Admin, getTn))
+		router.PUT("/stir/v1/admin/tns/:id", authorize(clientauth.Admin, updateTn))
+		router.DELETE("/stir/v1/admin/tns/:id", authorize(clientauth.Admin, deleteTn))
+	}
+	if origIDRegistry != nil {
+		router.GET("/stir/v1/admin/origids", authorize(clientauth.Admin, listOrigIDs))
+		router.POST("/stir/v1/admin/origids", authorize(clientauth.Admin, createOrigID))
+		router.GET("/stir/v1/admin/origids/:origid", authorize(clientauth.Admin, getOrigID))
+		router.PUT("/stir/v1/admin/origids/:origid", authorize(clientauth.Admin, updateOrigID))
+		router.DELETE("/stir/v1/admin/origids/:origid", authorize(clientauth.Admin, deleteOrigID))
+	}
+	if signingLedger != nil {
+		router.GET("/stir/v1/traceback", authorize(clientauth.Admin, traceback))
+	}
+	if analyticsStore != nil {
+		router.GET("/stir/v1/analytics/verification", authorize(clientauth.Admin, getVerificationAnalytics))
+	}
 
 	// Start the service.
 	// Note: netstats -plnt shows a IPv6 TCP socket listening on localhost:9000
 	//       but no IPv4 TCP socket. This is not an issue
 	c := cors.New(cors.Options{
-		AllowedMethods: []string{"GET", "POST"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
 		AllowedHeaders: []string{"accept", "Content-Type", "Authorization"},
 		AllowCredentials: true,
 	})
-	handler := c.Handler(router)
+	handler := instrument(router, accessControl(c.Handler(router)))
 	errs := make(chan error)
 
 	// start periodic tickers - each in a separate goroutine
@@ -142,9 +452,13 @@ func main() {
 			select {
 			case <- eksCredentialsRefreshTicker.C:
 				// check for eks config changes
+				start := time.Now()
 				err := eksCredentials.UpdateEksCredentials()
+				outboundDuration.Observe(time.Since(start).Seconds(), "eks_auth")
 				if err != nil {
 					logInfo("type", "refreshEksCredentials", "message", fmt.Sprintf("%v", err))
+				} else {
+					markRefreshed("eks")
 				}
 			case <- stopEksCredentialsRefreshTicker:
 				logInfo("type", "timerStop", "message", "stopped eks credentials refresh ticker")
@@ -171,7 +485,198 @@ func main() {
 			}
 		}
 	}()
-	
+	stopDelegateCredentialsRefreshTicker := make(chan struct{})
+	if delegateCredentials != nil {
+		go func() {
+			// start periodic ticker to check on changes to delegate credentials
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			delegateCredentialsRefreshTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().DelegateCredentialsFileCheckInterval)*time.Minute)
+			defer delegateCredentialsRefreshTicker.Stop()
+			for {
+				select {
+				case <- delegateCredentialsRefreshTicker.C:
+					reloaded, err := delegateCredentials.UpdateDelegateCredentials()
+					if err != nil {
+						logError("type", "refreshDelegateCredentials", "message", fmt.Sprintf("%v", err))
+					}
+					if reloaded {
+						for _, m := range delegateCredentials.NotValid(time.Now()) {
+							logError("type", "refreshDelegateCredentials", "message", m + " - skipped")
+						}
+					}
+				case <- stopDelegateCredentialsRefreshTicker:
+					logInfo("type", "timerStop", "message", "stopped delegate credentials refresh ticker")
+					return
+				}
+			}
+		}()
+	}
+	stopAttestPolicyRefreshTicker := make(chan struct{})
+	if attestPolicy != nil {
+		go func() {
+			// start periodic ticker to check on changes to attestation policy
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			attestPolicyRefreshTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().AttestPolicyFileCheckInterval)*time.Minute)
+			defer attestPolicyRefreshTicker.Stop()
+			for {
+				select {
+				case <- attestPolicyRefreshTicker.C:
+					if err := attestPolicy.UpdatePolicy(); err != nil {
+						logError("type", "refreshAttestPolicy", "message", fmt.Sprintf("%v", err))
+					}
+				case <- stopAttestPolicyRefreshTicker:
+					logInfo("type", "timerStop", "message", "stopped attestation policy refresh ticker")
+					return
+				}
+			}
+		}()
+	}
+	stopDnoListRefreshTicker := make(chan struct{})
+	if dnoList != nil {
+		go func() {
+			// start periodic ticker to check on changes to the DNO list
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			dnoListRefreshTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().DnoFileCheckInterval)*time.Minute)
+			defer dnoListRefreshTicker.Stop()
+			for {
+				select {
+				case <- dnoListRefreshTicker.C:
+					if err := dnoList.UpdateList(); err != nil {
+						logError("type", "refreshDnoList", "message", fmt.Sprintf("%v", err))
+					}
+				case <- stopDnoListRefreshTicker:
+					logInfo("type", "timerStop", "message", "stopped DNO list refresh ticker")
+					return
+				}
+			}
+		}()
+	}
+	stopNumberingPlanRefreshTicker := make(chan struct{})
+	if numberingPlan != nil {
+		go func() {
+			// start periodic ticker to check on changes to numbering data
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			numberingPlanRefreshTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().NumberingFileCheckInterval)*time.Minute)
+			defer numberingPlanRefreshTicker.Stop()
+			for {
+				select {
+				case <- numberingPlanRefreshTicker.C:
+					if err := numberingPlan.UpdatePlan(); err != nil {
+						logError("type", "refreshNumberingPlan", "message", fmt.Sprintf("%v", err))
+					}
+				case <- stopNumberingPlanRefreshTicker:
+					logInfo("type", "timerStop", "message", "stopped numbering data refresh ticker")
+					return
+				}
+			}
+		}()
+	}
+
+	stopClientIdentitiesRefreshTicker := make(chan struct{})
+	if clientIdentities != nil {
+		go func() {
+			// start periodic ticker to check on changes to client identities
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			clientIdentitiesRefreshTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().ClientIdentitiesFileCheckInterval)*time.Minute)
+			defer clientIdentitiesRefreshTicker.Stop()
+			for {
+				select {
+				case <- clientIdentitiesRefreshTicker.C:
+					if err := clientIdentities.UpdateIdentities(); err != nil {
+						logError("type", "refreshClientIdentities", "message", fmt.Sprintf("%v", err))
+					}
+				case <- stopClientIdentitiesRefreshTicker:
+					logInfo("type", "timerStop", "message", "stopped client identities refresh ticker")
+					return
+				}
+			}
+		}()
+	}
+
+	stopAclRefreshTicker := make(chan struct{})
+	if accessControlLists != nil {
+		go func() {
+			// start periodic ticker to check on changes to ACLs
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			aclRefreshTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().AclFileCheckInterval)*time.Minute)
+			defer aclRefreshTicker.Stop()
+			for {
+				select {
+				case <- aclRefreshTicker.C:
+					if err := accessControlLists.UpdateACL(); err != nil {
+						logError("type", "refreshAcl", "message", fmt.Sprintf("%v", err))
+					}
+				case <- stopAclRefreshTicker:
+					logInfo("type", "timerStop", "message", "stopped ACL refresh ticker")
+					return
+				}
+			}
+		}()
+	}
+
+	stopRateLimitTicker := make(chan struct{})
+	if len(rateLimiters) > 0 {
+		go func() {
+			// start periodic ticker to remove idle clients from rate limiters
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			rateLimitTicker := time.NewTicker(time.Hour)
+			defer rateLimitTicker.Stop()
+			for {
+				select {
+				case t := <- rateLimitTicker.C:
+					for _, l := range rateLimiters {
+						l.RemoveIdle(t)
+					}
+				case <- stopRateLimitTicker:
+					logInfo("type", "timerStop", "message", "stopped rate limit ticker")
+					return
+				}
+			}
+		}()
+	}
+
+	stopAnalyticsTicker := make(chan struct{})
+	if analyticsStore != nil {
+		go func() {
+			// start periodic ticker to remove verification outcome aggregates older than the retention period
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			analyticsTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().AnalyticsRetentionCheckInterval)*time.Minute)
+			defer analyticsTicker.Stop()
+			for {
+				select {
+				case t := <- analyticsTicker.C:
+					analyticsStore.RemoveExpired(t)
+				case <- stopAnalyticsTicker:
+					logInfo("type", "timerStop", "message", "stopped analytics ticker")
+					return
+				}
+			}
+		}()
+	}
 
 	stopRootCertsRefreshTicker := make(chan struct{})
 	go func() {
@@ -186,7 +691,9 @@ func main() {
 			select {
 			case <- rootCertsRefreshTicker.C:
 				// fetch root certs from EKS and replace cached ones
-				rootCerts.FetchRootCertsFromEks()
+				if rootCerts.FetchRootCertsFromEks() == nil {
+					markRefreshed("root_certs")
+				}
 			case <- stopRootCertsRefreshTicker:
 				logInfo("type", "timerStop", "message", "stopped root certs refresh ticker")
 				return
@@ -206,7 +713,9 @@ func main() {
 			select {
 			case <- signingCredentialsRefreshTicker.C:
 				// fetch current x5u and privatekey for signing. This will replace cached credentials
-				signingCredentials.FetchSigningCredentialsFromEks()
+				if signingCredentials.FetchSigningCredentialsFromEks() == nil {
+					markRefreshed("signing_credentials")
+				}
 			case <- stopSigningCredentialsRefreshTicker:
 				logInfo("type", "timerStop", "message", "stopped signing credentials refresh ticker")
 				return
@@ -254,6 +763,74 @@ func main() {
 			}
 		}
 	}()
+	stopCpsStoreTicker := make(chan struct{})
+	if cpsStore != nil {
+		go func() {
+			// start periodic ticker to remove expired PASSporTs and persist the CPS store
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			cpsStoreTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().CpsPersistenceInterval)*time.Second)
+			defer cpsStoreTicker.Stop()
+			for {
+				select {
+				case <- cpsStoreTicker.C:
+					cpsStore.RemoveExpired()
+					if err := cpsStore.Save(); err != nil {
+						logError("type", "cpsStore", "message", fmt.Sprintf("%v - unable to persist CPS store", err))
+					}
+				case <- stopCpsStoreTicker:
+					logInfo("type", "timerStop", "message", "stopped CPS store ticker")
+					return
+				}
+			}
+		}()
+	}
+	stopSigningLedgerTicker := make(chan struct{})
+	if signingLedger != nil {
+		go func() {
+			// start periodic ticker to remove signing ledger records older than the retention period
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			signingLedgerTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().LedgerRetentionCheckInterval)*time.Minute)
+			defer signingLedgerTicker.Stop()
+			for {
+				select {
+				case t := <- signingLedgerTicker.C:
+					signingLedger.RemoveExpired(t)
+				case <- stopSigningLedgerTicker:
+					logInfo("type", "timerStop", "message", "stopped signing ledger ticker")
+					return
+				}
+			}
+		}()
+	}
+	stopAuditLogTicker := make(chan struct{})
+	if auditLog != nil {
+		go func() {
+			// start periodic ticker to seal the current audit log segment and start a new one
+			// NewTicker returns a new Ticker containing a channel that will send the time with
+			// a period specified by the duration argument. It adjusts the intervals or drops
+			// ticks to make up for slow receiver.
+			// https://golang.org/pkg/time/#NewTicker
+			auditLogTicker := time.NewTicker(time.Duration(configuration.ConfigurationInstance().AuditSegmentInterval)*time.Minute)
+			defer auditLogTicker.Stop()
+			for {
+				select {
+				case <- auditLogTicker.C:
+					if err := auditLog.Rotate(); err != nil {
+						logError("type", "auditLog", "message", fmt.Sprintf("%v - unable to rotate audit log segment", err))
+					}
+				case <- stopAuditLogTicker:
+					logInfo("type", "timerStop", "message", "stopped audit log ticker")
+					return
+				}
+			}
+		}()
+	}
 	
 	var srv http.Server
 	// Start HTTPS server only if cert and key file exist
@@ -266,7 +843,7 @@ func main() {
 			logInfo("type", "httpsServiceStart", "message", fmt.Sprintf("Staring HTTPS service on port %v ...", httpPort))
 			// Note: netstats -plnt shows a IPv6 TCP socket listening on ":443"
 			//       but no IPv4 TCP socket. This is not an issue
-			srv := &http.Server{Addr: httpPort, Handler: handler}
+			srv := &http.Server{Addr: httpPort, Handler: handler, TLSConfig: tlsConfig}
 			if err := srv.ListenAndServeTLS(configuration.ConfigurationInstance().SslCertFile, configuration.ConfigurationInstance().SslKeyFile); err != nil {
 				logError("type", "httpServiceFailure", "message", fmt.Sprintf("%v - could not start serving service", err))
 				errs <- err
@@ -296,6 +873,17 @@ func main() {
 		 }()
 	}
 
+	// Start SIP redirect server for signing (STI-AS), if enabled
+	var sipSigningServer *sip.Server
+	if len(configuration.ConfigurationInstance().SipSigningTransports) > 0 {
+		sipSigningServer = startSipService("signing", configuration.ConfigurationInstance().SipSigningTransports, configuration.ConfigurationInstance().SipSigningPort, configuration.ConfigurationInstance().SipSigningTlsPort, instrumentSip("/sip/signing", guardSip("/sip/signing", clientauth.Signing, sipSigningHandler)), errs)
+	}
+	// Start SIP redirect server for verification (STI-VS), if enabled
+	var sipVerificationServer *sip.Server
+	if len(configuration.ConfigurationInstance().SipVerificationTransports) > 0 {
+		sipVerificationServer = startSipService("verification", configuration.ConfigurationInstance().SipVerificationTransports, configuration.ConfigurationInstance().SipVerificationPort, configuration.ConfigurationInstance().SipVerificationTlsPort, instrumentSip("/sip/verification", guardSip("/sip/verification", clientauth.Verification, sipVerificationHandler)), errs)
+	}
+
 	// This will run forever until channel receives error
 	select {
 	case err := <-errs:
@@ -303,6 +891,31 @@ func main() {
 		logInfo("type", "shutdown", "message", "shutting down vesper .... ")
 	case <-stop:
 		logInfo("type", "shutdown", "message", "shutting down vesper .... ")
+		if sipSigningServer != nil {
+			sipSigningServer.Close()
+		}
+		if sipVerificationServer != nil {
+			sipVerificationServer.Close()
+		}
+		if cpsStore != nil {
+			close(stopCpsStoreTicker)
+			if err := cpsStore.Save(); err != nil {
+				logError("type", "cpsStore", "message", fmt.Sprintf("%v - unable to persist CPS store", err))
+			}
+		}
+		if signingLedger != nil {
+			close(stopSigningLedgerTicker)
+			signingLedger.Close()
+		}
+		if auditLog != nil {
+			close(stopAuditLogTicker)
+			if err := auditLog.Close(); err != nil {
+				logError("type", "auditLog", "message", fmt.Sprintf("%v - unable to seal audit log segment", err))
+			}
+		}
+		if eventPipeline != nil {
+			eventPipeline.Close()
+		}
 		// Pass a context with a timeout to tell a blocking function that it
 		// should abandon its work after the timeout elapses.
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"vesper/sip"
+	"vesper/publickeys"
+	"vesper/replayattack"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// the service objects are initialized by main - tests set up only the ones
+// they use
+func TestMain(m *testing.M) {
+	glogger = kitlog.NewNopLogger()
+	replayAttackCache = replayattack.InitObject()
+	os.Exit(m.Run())
+}
+
+// testSigner - a signing key, whose public key is cached for x5u so that
+// PASSporTs it signs are verified without fetching a certificate
+type testSigner struct {
+	x5u	string
+	key	*ecdsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T, x5u string) testSigner {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publickeys.Add(x5u, &k.PublicKey)
+	return testSigner{x5u: x5u, key: k}
+}
+
+// sign returns the identity header value of claims signed as a PASSporT of
+// type ppt
+func (s testSigner) sign(t *testing.T, ppt string, claims map[string]interface{}) string {
+	identity, _, _, err := signClaimsWith(ppt, claims, Credential{Type: "spc", X5u: s.x5u}, s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+// testClaims - orig, dest and iat claims of a PASSporT, with extra claims
+// (e.g. attest and origid)
+func testClaims(orig string, dest []string, iat int64, extra map[string]interface{}) map[string]interface{} {
+	d := make([]interface{}, 0, len(dest))
+	for _, v := range dest {
+		d = append(d, v)
+	}
+	c := map[string]interface{}{
+		"orig": map[string]interface{}{"tn": orig},
+		"dest": map[string]interface{}{"tn": d},
+		"iat": float64(iat),
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+// testInvite parses an INVITE to requestURI, with header lines headers
+func testInvite(t *testing.T, requestURI string, headers ...string) *sip.Message {
+	s := "INVITE " + requestURI + " SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds\r\n" +
+		"Call-ID: a84b4c76e66710@10.0.0.1\r\n" +
+		"CSeq: 314159 INVITE\r\n"
+	if len(headers) > 0 {
+		s += strings.Join(headers, "\r\n") + "\r\n"
+	}
+	m, err := sip.Parse([]byte(s + "Content-Length: 0\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
@@ -0,0 +1,255 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the
+// Prometheus text exposition format (version 0.0.4).
+//
+// Metrics are registered once, at startup, and are thread safe.
+package metrics
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"sync"
+	"math"
+	"strings"
+	"strconv"
+)
+
+// ContentType - content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	mtx = &sync.RWMutex{}
+	registered = make(map[string]metric)
+	hooks []func()
+)
+
+func register(m metric) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if _, ok := registered[m.name()]; ok {
+		panic(fmt.Sprintf("metric %v is already registered", m.name()))
+	}
+	registered[m.name()] = m
+}
+
+// BeforeWrite registers f to be called before metrics are written - e.g. to set
+// gauges of sizes that are only known on demand
+func BeforeWrite(f func()) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	hooks = append(hooks, f)
+}
+
+// Write writes all metrics, ordered by name
+func Write(w io.Writer) {
+	mtx.RLock()
+	fs := append([]func(){}, hooks...)
+	ms := make([]metric, 0, len(registered))
+	for _, m := range registered {
+		ms = append(ms, m)
+	}
+	mtx.RUnlock()
+	for _, f := range fs {
+		f()
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name() < ms[j].name() })
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// vec - series of a metric by label values
+type vec struct {
+	sync.Mutex		// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	n				string
+	help		string
+	typ			string
+	labels	[]string
+}
+
+func (v *vec) name() string {
+	return v.n
+}
+
+// key of label values
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %v has %v labels, not %v", v.n, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", v.n, strings.Replace(v.help, "\n", " ", -1), v.n, v.typ)
+}
+
+// labelPairs formats the label pairs of a series key, and extra pairs
+func (v *vec) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(v.labels) > 0 {
+		for i, value := range strings.Split(key, "\x00") {
+			pairs = append(pairs, v.labels[i] + "=\"" + escape(value) + "\"")
+		}
+	}
+	for i := 0; i + 1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i] + "=\"" + escape(extra[i+1]) + "\"")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter - counters by label values
+type Counter struct {
+	vec
+	values	map[string]float64
+}
+
+// NewCounter registers a counter
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: vec{n: name, help: help, typ: "counter", labels: labels}, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc increments the counter of label values
+func (c *Counter) Inc(values ...string) {
+	k := c.key(values)
+	c.Lock()
+	defer c.Unlock()
+	c.values[k]++
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.header(w)
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%v%v %v\n", c.n, c.labelPairs(k), format(c.values[k]))
+	}
+}
+
+// Gauge - gauges by label values
+type Gauge struct {
+	vec
+	values	map[string]float64
+}
+
+// NewGauge registers a gauge
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: vec{n: name, help: help, typ: "gauge", labels: labels}, values: make(map[string]float64)}
+	register(g)
+	return g
+}
+
+// Set sets the gauge of label values
+func (g *Gauge) Set(v float64, values ...string) {
+	k := g.key(values)
+	g.Lock()
+	defer g.Unlock()
+	g.values[k] = v
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.Lock()
+	defer g.Unlock()
+	g.header(w)
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%v%v %v\n", g.n, g.labelPairs(k), format(g.values[k]))
+	}
+}
+
+type histogramSeries struct {
+	counts	[]uint64		// by bucket, not cumulative
+	count		uint64
+	sum			float64
+}
+
+// Histogram - histograms by label values
+type Histogram struct {
+	vec
+	buckets	[]float64		// upper bounds, ascending
+	series	map[string]*histogramSeries
+}
+
+// DefaultBuckets - latency buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.15, 0.3, 0.6, 1, 2.5, 5}
+
+// NewHistogram registers a histogram with buckets (upper bounds)
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &Histogram{vec: vec{n: name, help: help, typ: "histogram", labels: labels}, buckets: b, series: make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.Lock()
+	defer h.Unlock()
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	h.header(w)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.n, h.labelPairs(k, "le", format(b)), cumulative)
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", h.n, h.labelPairs(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.n, h.labelPairs(k), format(s.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.n, h.labelPairs(k), s.count)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escape(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests.", "endpoint", "reason_code")
+	c.Inc("/a", "none")
+	c.Inc("/a", "none")
+	c.Inc("/b", "VESPER-\"1\"")
+	g := NewGauge("test_entries", "Entries.")
+	BeforeWrite(func() { g.Set(7) })
+	h := NewHistogram("test_duration_seconds", "Duration.", []float64{0.1, 0.5}, "endpoint")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a")
+	h.Observe(0.3, "/a")
+	h.Observe(2, "/a")
+	var b bytes.Buffer
+	Write(&b)
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		"test_requests_total{endpoint=\"/a\",reason_code=\"none\"} 2\n",
+		"test_requests_total{endpoint=\"/b\",reason_code=\"VESPER-\\\"1\\\"\"} 1\n",
+		"# TYPE test_entries gauge\ntest_entries 7\n",
+		"test_duration_seconds_bucket{endpoint=\"/a\",le=\"0.1\"} 2\n",
+		"test_duration_seconds_bucket{endpoint=\"/a\",le=\"0.5\"} 3\n",
+		"test_duration_seconds_bucket{endpoint=\"/a\",le=\"+Inf\"} 4\n",
+		"test_duration_seconds_sum{endpoint=\"/a\"} 2.45\n",
+		"test_duration_seconds_count{endpoint=\"/a\"} 4\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Write() - missing %q in\n%v", want, b.String())
+		}
+	}
+	if strings.Index(b.String(), "test_duration_seconds") > strings.Index(b.String(), "test_entries") {
+		t.Errorf("Write() - metrics not ordered by name")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"regexp"
+	"strings"
+	"reflect"
+	"net/http"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/base64"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	"vesper/audit"
+	"vesper/configuration"
+	"vesper/stats"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// msgi claim - digest of the message body, "sha256-" followed by the base64
+// encoded SHA-256 digest
+var regexMsgi = regexp.MustCompile(`^sha256-[A-Za-z0-9+/]{43}=$`)
+
+// messageDigest returns the msgi claim value of a message body
+func messageDigest(message string) string {
+	d := sha256.Sum256([]byte(message))
+	return "sha256-" + base64.StdEncoding.EncodeToString(d[:])
+}
+
+// msgiFromRequest - msgi is either computed from the message in the request
+// payload or supplied as is (for message bodies that are not text, e.g. MMS).
+// Exactly one of the two MUST be present
+func msgiFromRequest(r map[string]interface{}) (string, string, error) {
+	m, hasMessage := r["message"]
+	d, hasMsgi := r["msgi"]
+	switch {
+	case hasMessage == hasMsgi:
+		return "", "VESPER-4082", fmt.Errorf("exactly one of message and msgi fields MUST be present in request payload")
+	case hasMessage:
+		s, ok := m.(string)
+		if !ok {
+			return "", "VESPER-4083", fmt.Errorf("message field in request payload MUST be a string")
+		}
+		return messageDigest(s), "", nil
+	}
+	s, ok := d.(string)
+	if !ok || !regexMsgi.MatchString(s) {
+		return "", "VESPER-4084", fmt.Errorf("msgi field in request payload MUST be a SHA-256 digest (sha256-<base64 digest>)")
+	}
+	return s, "", nil
+}
+
+// validateMsgPayload - validates the claims of a msg PASSporT - dest, iat, msgi
+// and orig
+func validateMsgPayload(r map[string]interface{}, traceID, clientIP string) (map[string]interface{}, string, int64, []string, string, error) {
+	orderedMap := make(map[string]interface{})
+	if !reflect.ValueOf(r["dest"]).IsValid() || !reflect.ValueOf(r["iat"]).IsValid() || !reflect.ValueOf(r["orig"]).IsValid() || !reflect.ValueOf(r["msgi"]).IsValid() {
+		return orderedMap, "", 0, nil, "VESPER-4080", fmt.Errorf("one or more of the require fields missing in JWT claims")
+	}
+	if len(r) != 4 {
+		return orderedMap, "", 0, nil, "VESPER-4081", fmt.Errorf("JWT claims has more than expected fields")
+	}
+	origTN, iat, destTNs, errCode, err := validateTNsAndIat(r, orderedMap, traceID, clientIP)
+	if err != nil {
+		return orderedMap, origTN, iat, destTNs, errCode, err
+	}
+	if s, ok := r["msgi"].(string); !ok || !regexMsgi.MatchString(s) {
+		return orderedMap, origTN, iat, destTNs, "VESPER-4084", fmt.Errorf("msgi field MUST be a SHA-256 digest (sha256-<base64 digest>)")
+	}
+	orderedMap["msgi"] = r["msgi"]
+	return orderedMap, origTN, iat, destTNs, "", nil
+}
+
+// signMessage - signs a messaging PASSporT (ppt "msg") for SMS/MMS
+func signMessage(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	stats.IncrSigningRequestCount()
+	// every terminal outcome is recorded
+	outcome := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "refused"}
+	refuse := func(reasonCode string) {
+		outcome.ReasonCode = reasonCode
+		recordDecision(response, "signing", start, outcome)
+	}
+	lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signMessage")
+	var r map[string]interface{}
+	err := json.NewDecoder(request.Body).Decode(&r)
+	switch {
+	case err == io.EOF:
+		refuse("VESPER-4001")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4001", "empty request body", nil)
+		return
+	case err != nil :
+		refuse("VESPER-4002")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4002", "unable to parse request body", nil)
+		return
+	}
+	if !reflect.ValueOf(r["dest"]).IsValid() || !reflect.ValueOf(r["iat"]).IsValid() || !reflect.ValueOf(r["orig"]).IsValid() {
+		refuse("VESPER-4080")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4080", "one or more of the require fields missing in request payload", nil)
+		return
+	}
+	if len(r) != 4 {
+		refuse("VESPER-4081")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4081", "request payload has more than expected fields", nil)
+		return
+	}
+	msgi, errCode, err := msgiFromRequest(r)
+	if err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	// the message body is not part of the claims
+	claims := map[string]interface{}{"dest": r["dest"], "iat": r["iat"], "orig": r["orig"], "msgi": msgi}
+	orderedMap, origTN, iat, destTNs, errCode, err := validateMsgPayload(claims, traceID, clientIP)
+	if err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	outcome.Orig, outcome.Dest, outcome.Iat = origTN, destTNs, iat
+	if errCode, err := validateNumbering(origTN, destTNs, signingOrigNumbering, signingDestNumbering); err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	logInfo("type", "signMessage", "traceID", traceID, "client", client, "clientIP", clientIP, "module", "signMessage", "claims", orderedMap)
+	identity, credential, errCode, err := signClaims("msg", orderedMap, origTN)
+	if err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	outcome.Result, outcome.X5u = "signed", credential.X5u
+	recordDecision(response, "signing", start, outcome)
+	resp := make(map[string]interface{})
+	resp["signingResponse"] = make(map[string]interface{})
+	resp["signingResponse"].(map[string]interface{})["identity"] = identity + ";ppt=msg"
+	resp["signingResponse"].(map[string]interface{})["msgi"] = msgi
+	resp["signingResponse"].(map[string]interface{})["credential"] = credential
+	lg = kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "signMessage", "resp", resp)
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
+}
+
+// verifyMessage - verifies a messaging PASSporT (ppt "msg") against the sender,
+// recipients and body of a message
+func verifyMessage(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	stats.IncrVerificationRequestCount()
+	// every terminal outcome is recorded
+	decision := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "failed"}
+	failed := func(reasonCode string) {
+		decision.ReasonCode = reasonCode
+		recordDecision(response, "verification", start, decision)
+	}
+	lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyMessage")
+	var r map[string]interface{}
+	err := json.NewDecoder(request.Body).Decode(&r)
+	switch {
+	case err == io.EOF:
+		failed("VESPER-4100")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4100", "empty request body", nil)
+		return
+	case err != nil :
+		failed("VESPER-4102")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4102", "unable to parse request body", nil)
+		return
+	}
+	if !reflect.ValueOf(r["dest"]).IsValid() || !reflect.ValueOf(r["iat"]).IsValid() || !reflect.ValueOf(r["orig"]).IsValid() || !reflect.ValueOf(r["identity"]).IsValid() {
+		failed("VESPER-4103")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4103", "one or more of the require fields missing in request payload", nil)
+		return
+	}
+	if len(r) != 5 {
+		failed("VESPER-4104")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4104", "request payload has more than expected fields", nil)
+		return
+	}
+	identity, ok := r["identity"].(string)
+	if !ok || len(strings.TrimSpace(identity)) == 0 {
+		failed("VESPER-4200")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4200", "identity field in request payload MUST be a non-empty string", nil)
+		return
+	}
+	msgi, errCode, err := msgiFromRequest(r)
+	if err != nil {
+		failed(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	// sender and recipients are in the same form as in the claims
+	origTN, iat, destTNs, errCode, err := validateTNsAndIat(r, make(map[string]interface{}), traceID, clientIP)
+	if err != nil {
+		failed(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	decision.Orig, decision.Dest, decision.Iat = origTN, destTNs, iat
+	if errCode, err := validateNumbering(origTN, destTNs, verificationOrigNumbering, verificationDestNumbering); err != nil {
+		failed(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	logInfo("type", "verifyMessage", "traceID", traceID, "client", client, "module", "verifyMessage", "requestPayload", r)
+
+	pp, errCode, err := validateMsgIdentity(identity, msgi, origTN, destTNs, iat, start.Unix(), traceID, clientIP)
+	if err != nil {
+		failed(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	resp := make(map[string]interface{})
+	resp["verificationResponse"] = make(map[string]interface{})
+	code, httpCode, err := verifySignature(pp.x5u, pp.token, configuration.ConfigurationInstance().VerifyRootCA)
+	if err != nil {
+		failed(code)
+		lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "verifyMessage", "message", fmt.Sprintf("%v - error in verifying signature", err), "resp", resp)
+		resp["verificationResponse"].(map[string]interface{})["reasonCode"] = code
+		resp["verificationResponse"].(map[string]interface{})["reasonString"] = err.Error()
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, "", "", resp)
+		return
+	}
+	// cache claims in identity header to validate replay attacks in future
+	replayAttackCache.Add(pp.iat, pp.claimsString)
+	// the signer is known only once the signature is verified
+	decision.Result, decision.X5u = "verified", pp.x5u
+	recordDecision(response, "verification", start, decision)
+	lg = kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "verifyMessage")
+	resp["verificationResponse"].(map[string]interface{})["dest"] = r["dest"]
+	resp["verificationResponse"].(map[string]interface{})["iat"] = r["iat"]
+	resp["verificationResponse"].(map[string]interface{})["orig"] = r["orig"]
+	resp["verificationResponse"].(map[string]interface{})["jwt"] = map[string]interface{}{"header": pp.header, "claims": pp.claims}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
+}
+
+// validateMsgIdentity - validates a msg identity against the message. Everything
+// but the signature is validated
+func validateMsgIdentity(identity, msgi, origTN string, destTNs []string, iat, t int64, traceID, clientIP string) (*passport, string, error) {
+	token := strings.Split(identity, ";")
+	if len(token) < 2 {
+		return nil, "VESPER-4201", fmt.Errorf("Identity field does not contain all the relevant parameters in request payload")
+	}
+	jwt := strings.Split(token[0], ".")
+	if len(jwt) != 3 {
+		return nil, "VESPER-4202", fmt.Errorf("Invalid JWT format in identity field in request payload")
+	}
+	if !regexInfo.MatchString(token[1]) {
+		return nil, "VESPER-4203", fmt.Errorf("Invalid info parameter in identity field in request payload")
+	}
+	info := token[1][6:len(token[1])-1]
+	x5u, hh, errCode, err := validateHeader(token[0], "msg")
+	if err != nil {
+		return nil, errCode, err
+	}
+	if x5u != info {
+		return nil, "VESPER-4204", fmt.Errorf("x5u value in JWT header does not match info parameter in identity field in request payload")
+	}
+	c, err := base64Decode(jwt[1])
+	if err != nil {
+		return nil, "VESPER-4152", fmt.Errorf("%v - unable to base64 url decode claims part of JWT", err)
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(c, &m); err != nil {
+		return nil, "VESPER-4153", fmt.Errorf("%v - unable to unmarshal decoded claims to map[string]interface{}", err)
+	}
+	orderedMap, origTNInClaims, iatInClaims, destTNsInClaims, errCode, err := validateMsgPayload(m, traceID, clientIP)
+	if err != nil {
+		return nil, errCode, err
+	}
+	if errCode, err := matchClaims(m, origTNInClaims, destTNsInClaims, iatInClaims, origTN, destTNs, iat, t); err != nil {
+		return nil, errCode, err
+	}
+	if orderedMap["msgi"] != msgi {
+		return nil, "VESPER-4205", fmt.Errorf("message digest %v does not match msgi in JWT claims (%+v)", msgi, m)
+	}
+	claimsString, err := json.Marshal(orderedMap)
+	if err != nil {
+		return nil, "VESPER-4168", fmt.Errorf("%v - unable to validate replay attack", err)
+	}
+	if ok := replayAttackCache.IsPresent(iatInClaims, string(claimsString)); ok {
+		return nil, "VESPER-4169", fmt.Errorf("possible replay attack - identity header repeated - JWT claims (%+v) is cached", string(claimsString))
+	}
+	return &passport{token: token[0], x5u: x5u, header: hh, claims: orderedMap, iat: iatInClaims, claimsString: string(claimsString)}, "", nil
+}
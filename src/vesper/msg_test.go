@@ -0,0 +1,63 @@
+package main
+
+import (
+	"time"
+	"testing"
+)
+
+func TestMsgiFromRequest(t *testing.T) {
+	// SHA-256 digest of the empty string
+	empty := "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	if d := messageDigest(""); d != empty {
+		t.Errorf("messageDigest(\"\") = %v - want %v", d, empty)
+	}
+	for _, tc := range []struct {
+		name		string
+		r				map[string]interface{}
+		msgi		string
+		errCode	string
+	}{
+		{"message", map[string]interface{}{"message": ""}, empty, ""},
+		{"msgi", map[string]interface{}{"msgi": empty}, empty, ""},
+		{"message and msgi", map[string]interface{}{"message": "", "msgi": empty}, "", "VESPER-4082"},
+		{"neither message nor msgi", map[string]interface{}{}, "", "VESPER-4082"},
+		{"message not a string", map[string]interface{}{"message": 1.0}, "", "VESPER-4083"},
+		{"msgi not a SHA-256 digest", map[string]interface{}{"msgi": "sha1-2jmj7l5rSw0yVb/vlWAYkK/YBwk="}, "", "VESPER-4084"},
+	} {
+		msgi, errCode, err := msgiFromRequest(tc.r)
+		if msgi != tc.msgi || errCode != tc.errCode {
+			t.Errorf("%v: msgiFromRequest() = %v, %v (%v) - want %v, %v", tc.name, msgi, errCode, err, tc.msgi, tc.errCode)
+		}
+	}
+}
+
+func TestValidateMsgIdentity(t *testing.T) {
+	s := newTestSigner(t, "https://cert.example.com/msg.pem")
+	now := time.Now().Unix()
+	orig, dest := "12155551212", []string{"12155551213"}
+	identity := s.sign(t, "msg", testClaims(orig, dest, now, map[string]interface{}{"msgi": messageDigest("hello")}))
+	for _, tc := range []struct {
+		name		string
+		message	string
+		orig		string
+		errCode	string
+	}{
+		{"message matches msgi", "hello", orig, ""},
+		{"message does not match msgi", "hello!", orig, "VESPER-4205"},
+		{"orig", "hello", "12155551299", "VESPER-4154"},
+	} {
+		pp, errCode, err := validateMsgIdentity(identity, messageDigest(tc.message), tc.orig, dest, now, now, "trace", "127.0.0.1")
+		if errCode != tc.errCode {
+			t.Errorf("%v: reason code = %v (%v) - want %v", tc.name, errCode, err, tc.errCode)
+			continue
+		}
+		if len(tc.errCode) == 0 && (pp.x5u != s.x5u || pp.claims["msgi"] != messageDigest("hello")) {
+			t.Errorf("%v: passport = %+v", tc.name, pp)
+		}
+	}
+	// a SHAKEN PASSporT is not a msg PASSporT
+	identity = s.sign(t, "shaken", testClaims(orig, dest, now, map[string]interface{}{"attest": "A", "origid": "x"}))
+	if _, errCode, _ := validateMsgIdentity(identity, messageDigest("hello"), orig, dest, now, now, "trace", "127.0.0.1"); errCode != "VESPER-4136" {
+		t.Errorf("shaken identity: reason code = %v - want VESPER-4136", errCode)
+	}
+}
@@ -0,0 +1,185 @@
+// Package numbering validates TNs against numbering plans.
+//
+// A TN is in E.164 form, digits only, with the country code. TNs with country
+// code 1 are in the North American Numbering Plan (NANP) - 1 NPA NXX XXXX,
+// where NPA (area code) and NXX (central office code) are NXX, N being 2 - 9,
+// and neither is an N11 (service) code. The NPA MUST be an assigned area code.
+// Other TNs are checked by the length of the national number for their
+// country code.
+//
+// The numbering data is read from a file
+//
+//	{
+//	  "npas": ["201", "202", "203"],
+//	  "countryCodes": {
+//	    "44": {"min": 9, "max": 10},
+//	    "49": {"min": 6, "max": 13}
+//	  }
+//	}
+//
+// This data structure is thread safe.
+package numbering
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+// Length - range of the length of national numbers of a country code
+type Length struct {
+	Min	int	`json:"min"`
+	Max	int	`json:"max"`
+}
+
+// Plan - numbering data
+type Plan struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file					string
+	modifiedTime	int64
+	npas					map[string]struct{}
+	countryCodes	map[string]Length
+}
+
+// Initialize object
+// Saves file modified time for future use
+func InitObject(f string) (*Plan, error) {
+	if len(strings.TrimSpace(f)) == 0 {
+		return nil, fmt.Errorf("file name (with numbering data) is an empty string")
+	}
+	p := &Plan{file: f}
+	if err := p.UpdatePlan(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdatePlan reads the numbering data file only if its modified time has
+// changed. The current data is kept on failure
+func (p *Plan) UpdatePlan() error {
+	fi, err := os.Stat(p.file)
+	if err != nil {
+		return fmt.Errorf("%v - numbering data file", err)
+	}
+	m := fi.ModTime().Unix()
+	p.RLock()
+	same := p.modifiedTime == m
+	p.RUnlock()
+	if same {
+		return nil
+	}
+	b, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		return fmt.Errorf("%v - numbering data file", err)
+	}
+	npas, countryCodes, err := parse(b)
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.npas = npas
+	p.countryCodes = countryCodes
+	p.modifiedTime = m
+	return nil
+}
+
+// Validate returns an error describing why tn violates the numbering plan, nil
+// if it does not
+func (p *Plan) Validate(tn string) error {
+	if !digits(tn) {
+		return fmt.Errorf("TN %v MUST be digits only", tn)
+	}
+	if tn[0] == '1' {
+		return p.nanp(tn)
+	}
+	p.RLock()
+	defer p.RUnlock()
+	// country codes are 1 to 3 digits and prefix free
+	for i := 1; i <= 3 && i < len(tn); i++ {
+		if l, ok := p.countryCodes[tn[:i]]; ok {
+			if n := len(tn) - i; n < l.Min || n > l.Max {
+				return fmt.Errorf("TN %v - national number of country code %v MUST be %v to %v digits", tn, tn[:i], l.Min, l.Max)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("TN %v - unknown country code", tn)
+}
+
+// nanp validates a TN with country code 1
+func (p *Plan) nanp(tn string) error {
+	if len(tn) != 11 {
+		return fmt.Errorf("NANP TN %v MUST be 11 digits", tn)
+	}
+	npa, nxx := tn[1:4], tn[4:7]
+	switch {
+	case npa[0] < '2':
+		return fmt.Errorf("NANP TN %v - NPA %v MUST start with 2 - 9", tn, npa)
+	case npa[1:] == "11":
+		return fmt.Errorf("NANP TN %v - NPA %v is an N11 code", tn, npa)
+	case nxx[0] < '2':
+		return fmt.Errorf("NANP TN %v - NXX %v MUST start with 2 - 9", tn, nxx)
+	case nxx[1:] == "11":
+		return fmt.Errorf("NANP TN %v - NXX %v is an N11 code", tn, nxx)
+	}
+	p.RLock()
+	defer p.RUnlock()
+	if _, ok := p.npas[npa]; !ok {
+		return fmt.Errorf("NANP TN %v - NPA %v is not an assigned area code", tn, npa)
+	}
+	return nil
+}
+
+// Size returns the number of assigned NPAs and country codes
+func (p *Plan) Size() (int, int) {
+	p.RLock()
+	defer p.RUnlock()
+	return len(p.npas), len(p.countryCodes)
+}
+
+func parse(b []byte) (map[string]struct{}, map[string]Length, error) {
+	var c struct {
+		NPAs					[]string					`json:"npas"`
+		CountryCodes	map[string]Length	`json:"countryCodes"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("%v - decode JSON object in numbering data file", err)
+	}
+	npas := make(map[string]struct{}, len(c.NPAs))
+	for _, v := range c.NPAs {
+		if len(v) != 3 || !digits(v) {
+			return nil, nil, fmt.Errorf("npa %v in numbering data file MUST be 3 digits", v)
+		}
+		npas[v] = struct{}{}
+	}
+	for k, v := range c.CountryCodes {
+		if len(k) > 3 || !digits(k) || k[0] == '0' || k[0] == '1' {
+			return nil, nil, fmt.Errorf("country code %v in numbering data file MUST be 1 to 3 digits, other than 1", k)
+		}
+		if v.Min < 1 || v.Max < v.Min || len(k) + v.Max > 15 {
+			return nil, nil, fmt.Errorf("country code %v in numbering data file - min %v and max %v MUST be 1 <= min <= max <= %v", k, v.Min, v.Max, 15 - len(k))
+		}
+	}
+	if c.CountryCodes == nil {
+		c.CountryCodes = make(map[string]Length)
+	}
+	return npas, c.CountryCodes, nil
+}
+
+func digits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package numbering
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	npas, countryCodes, err := parse([]byte(`{
+		"npas": ["215", "800"],
+		"countryCodes": {"44": {"min": 9, "max": 10}, "353": {"min": 7, "max": 9}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Plan{npas: npas, countryCodes: countryCodes}
+	for tn, valid := range map[string]bool{
+		"12155551212": true,
+		"18005551212": true,
+		"12155551": false,		// length
+		"121555512120": false,	// length
+		"12165551212": false,	// unassigned NPA
+		"11155551212": false,	// NPA starts with 1
+		"14115551212": false,	// N11 NPA
+		"12151551212": false,	// NXX starts with 1
+		"12154111212": false,	// N11 NXX
+		"442071838750": true,
+		"4420718387": false,	// national number too short
+		"3531234567": true,
+		"33123456789": false,	// unknown country code
+		"dwdw": false,
+		"": false,
+	} {
+		if err := p.Validate(tn); (err == nil) != valid {
+			t.Errorf("Validate(%v) = %v - want valid %v", tn, err, valid)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, b := range []string{
+		`{"npas": ["21"]}`,
+		`{"countryCodes": {"1": {"min": 10, "max": 10}}}`,
+		`{"countryCodes": {"44": {"min": 10, "max": 9}}}`,
+		`{"countryCodes": {"44": {"min": 9, "max": 14}}}`,
+	} {
+		if _, _, err := parse([]byte(b)); err == nil {
+			t.Errorf("parse(%v) - want error", b)
+		}
+	}
+}
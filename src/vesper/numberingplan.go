@@ -0,0 +1,29 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+// Reason codes of numbering plan violations
+const (
+	signingOrigNumbering				= "VESPER-4060"
+	signingDestNumbering				= "VESPER-4061"
+	verificationOrigNumbering		= "VESPER-4220"
+	verificationDestNumbering		= "VESPER-4221"
+)
+
+// validateNumbering validates orig TN and dest TNs against the numbering plan,
+// if numbering data is configured. origCode or destCode is returned for the TN
+// that violates it
+func validateNumbering(origTN string, destTNs []string, origCode, destCode string) (string, error) {
+	if numberingPlan == nil {
+		return "", nil
+	}
+	if err := numberingPlan.Validate(origTN); err != nil {
+		return origCode, err
+	}
+	for _, tn := range destTNs {
+		if err := numberingPlan.Validate(tn); err != nil {
+			return destCode, err
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"io"
+	"fmt"
+	"net/http"
+	"encoding/json"
+	"github.com/httprouter"
+	"vesper/origids"
+)
+
+// decodeOrigIDEntry - an origid registry entry in a request body
+func decodeOrigIDEntry(request *http.Request) (origids.Entry, string, error) {
+	var e origids.Entry
+	err := json.NewDecoder(request.Body).Decode(&e)
+	switch {
+	case err == io.EOF:
+		return e, "VESPER-4511", fmt.Errorf("empty request body")
+	case err != nil:
+		return e, "VESPER-4512", fmt.Errorf("%v - unable to parse request body", err)
+	}
+	if err := origids.Validate(e); err != nil {
+		return e, "VESPER-4513", err
+	}
+	return e, "", nil
+}
+
+// listOrigIDs - all registered origids, the origids of a customer (query
+// customer), or the origid a trunk of a customer gets (query customer and trunk)
+func listOrigIDs(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "listOrigIDs")
+	if !ok {
+		return
+	}
+	customer := request.URL.Query().Get("customer")
+	if trunk := request.URL.Query().Get("trunk"); len(trunk) > 0 {
+		e, ok := origIDRegistry.Lookup(customer, trunk)
+		if !ok {
+			serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4514", "no origid registered for customer and trunk", nil)
+			return
+		}
+		serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", e)
+		return
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{"origids": origIDRegistry.List(customer)})
+}
+
+// getOrigID - the owner of an origid
+func getOrigID(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "getOrigID")
+	if !ok {
+		return
+	}
+	e, ok := origIDRegistry.Get(ps.ByName("origid"))
+	if !ok {
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4514", "origid not found", nil)
+		return
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", e)
+}
+
+// createOrigID - registers an origid for a customer (and trunk)
+func createOrigID(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "createOrigID")
+	if !ok {
+		return
+	}
+	e, errCode, err := decodeOrigIDEntry(request)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	e, err = origIDRegistry.Add(e)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusConflict, "error", traceID, "VESPER-4515", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "createOrigID", "entry", e)
+	serveHttpResponse(start, response, lg, http.StatusCreated, "info", traceID, "", "", e)
+}
+
+// updateOrigID - changes the owner of an origid
+func updateOrigID(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "updateOrigID")
+	if !ok {
+		return
+	}
+	e, errCode, err := decodeOrigIDEntry(request)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	e, err = origIDRegistry.Update(ps.ByName("origid"), e)
+	switch {
+	case err == origids.ErrNotFound:
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4514", "origid not found", nil)
+		return
+	case err != nil:
+		serveHttpResponse(start, response, lg, http.StatusConflict, "error", traceID, "VESPER-4515", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "updateOrigID", "entry", e)
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", e)
+}
+
+// deleteOrigID - removes an origid from the registry
+func deleteOrigID(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "deleteOrigID")
+	if !ok {
+		return
+	}
+	err := origIDRegistry.Delete(ps.ByName("origid"))
+	switch {
+	case err == origids.ErrNotFound:
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4514", "origid not found", nil)
+		return
+	case err != nil:
+		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, "VESPER-5061", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "deleteOrigID", "origid", ps.ByName("origid"))
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{})
+}
+
+// origIDOwner resolves an origid issued by the origid registry to its owner, for
+// a PASSporT signed by vesper - x5u is one of its signing or delegate x5u's.
+// Returns nil for other origids, and for PASSporTs of other signers, as they can
+// use any origid
+func origIDOwner(x5u string, claims map[string]interface{}) *origids.Entry {
+	if origIDRegistry == nil || !ownX5u(x5u) {
+		return nil
+	}
+	id, _ := claims["origid"].(string)
+	e, ok := origIDRegistry.Get(id)
+	if !ok {
+		return nil
+	}
+	return &e
+}
+
+// ownX5u returns true if x5u is the x5u of a signing credential of vesper
+func ownX5u(x5u string) bool {
+	if x, _ := signingCredentials.Signing(); len(x) > 0 && x == x5u {
+		return true
+	}
+	return delegateCredentials != nil && delegateCredentials.Has(x5u)
+}
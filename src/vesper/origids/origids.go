@@ -0,0 +1,231 @@
+// Package origids is the origination identifier (origid) registry - stable
+// origids (UUIDs) issued to customers, or to trunks of customers, so that
+// calls signed for them carry the same origid and can be traced back to them.
+//
+// An entry of a customer, without a trunk, applies to all trunks of the
+// customer that have no entry of their own.
+//
+// The registry can optionally be persisted to a file.
+//
+// This data structure is thread safe.
+package origids
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+)
+
+// Entry - an origid and its owner
+type Entry struct {
+	OrigID				string	`json:"origid"`
+	Customer			string	`json:"customer"`
+	Trunk					string	`json:"trunk,omitempty"`
+	Description		string	`json:"description,omitempty"`
+}
+
+// Registry - origid registry
+type Registry struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file			string
+	entries		map[string]Entry		// by origid
+	keys			map[string]string		// origid by customer/trunk
+}
+
+// ErrNotFound - no entry with the origid
+var ErrNotFound = fmt.Errorf("origid not found")
+
+// Initialize object
+// If f is not empty, entries persisted in f are loaded
+func InitObject(f string) (*Registry, error) {
+	reg := &Registry{file: strings.TrimSpace(f), entries: make(map[string]Entry), keys: make(map[string]string)}
+	if len(reg.file) == 0 {
+		return reg, nil
+	}
+	b, err := ioutil.ReadFile(reg.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reg, nil
+		}
+		return nil, fmt.Errorf("%v - origid registry file", err)
+	}
+	if len(b) == 0 {
+		return reg, nil
+	}
+	var entries []Entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%v - decode JSON object in origid registry file", err)
+	}
+	for _, e := range entries {
+		if err := reg.add(e); err != nil {
+			return nil, fmt.Errorf("%v - origid registry file", err)
+		}
+	}
+	return reg, nil
+}
+
+// Validate checks an entry
+func Validate(e Entry) error {
+	if len(strings.TrimSpace(e.Customer)) == 0 {
+		return fmt.Errorf("customer MUST be a non-empty string")
+	}
+	if len(e.OrigID) > 0 {
+		if _, err := uuid.FromString(e.OrigID); err != nil {
+			return fmt.Errorf("origid %v MUST be a UUID", e.OrigID)
+		}
+	}
+	return nil
+}
+
+// Add registers an entry. An origid is issued if the entry has none
+func (reg *Registry) Add(e Entry) (Entry, error) {
+	if len(e.OrigID) == 0 {
+		e.OrigID = uuid.NewV4().String()
+	}
+	reg.Lock()
+	defer reg.Unlock()
+	if err := reg.add(e); err != nil {
+		return e, err
+	}
+	return e, reg.save()
+}
+
+// Update replaces the owner of an origid
+func (reg *Registry) Update(origID string, e Entry) (Entry, error) {
+	e.OrigID = origID
+	reg.Lock()
+	defer reg.Unlock()
+	old, ok := reg.entries[origID]
+	if !ok {
+		return e, ErrNotFound
+	}
+	reg.remove(old)
+	if err := reg.add(e); err != nil {
+		// restore the entry being replaced
+		reg.add(old)
+		return e, err
+	}
+	return e, reg.save()
+}
+
+// Delete removes an origid
+func (reg *Registry) Delete(origID string) error {
+	reg.Lock()
+	defer reg.Unlock()
+	e, ok := reg.entries[origID]
+	if !ok {
+		return ErrNotFound
+	}
+	reg.remove(e)
+	return reg.save()
+}
+
+// Get returns the entry of an origid
+func (reg *Registry) Get(origID string) (Entry, bool) {
+	reg.RLock()
+	defer reg.RUnlock()
+	e, ok := reg.entries[origID]
+	return e, ok
+}
+
+// List returns all entries, or the entries of a customer, ordered by customer
+// and trunk
+func (reg *Registry) List(customer string) []Entry {
+	reg.RLock()
+	defer reg.RUnlock()
+	l := make([]Entry, 0, len(reg.entries))
+	for _, e := range reg.entries {
+		if len(customer) == 0 || e.Customer == customer {
+			l = append(l, e)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return key(l[i].Customer, l[i].Trunk) < key(l[j].Customer, l[j].Trunk) })
+	return l
+}
+
+// Lookup returns the entry of a trunk of a customer - the entry of the customer
+// if the trunk has none
+func (reg *Registry) Lookup(customer, trunk string) (Entry, bool) {
+	reg.RLock()
+	defer reg.RUnlock()
+	id, ok := reg.keys[key(customer, trunk)]
+	if !ok && len(trunk) > 0 {
+		id, ok = reg.keys[key(customer, "")]
+	}
+	if !ok {
+		return Entry{}, false
+	}
+	return reg.entries[id], true
+}
+
+// Size returns the number of entries
+func (reg *Registry) Size() int {
+	reg.RLock()
+	defer reg.RUnlock()
+	return len(reg.entries)
+}
+
+// add - caller holds the lock
+func (reg *Registry) add(e Entry) error {
+	if err := Validate(e); err != nil {
+		return err
+	}
+	if _, ok := reg.entries[e.OrigID]; ok {
+		return fmt.Errorf("origid %v already exists", e.OrigID)
+	}
+	k := key(e.Customer, e.Trunk)
+	if id, ok := reg.keys[k]; ok {
+		return fmt.Errorf("customer %v trunk %v already has origid %v", e.Customer, e.Trunk, id)
+	}
+	reg.entries[e.OrigID] = e
+	reg.keys[k] = e.OrigID
+	return nil
+}
+
+// remove - caller holds the lock
+func (reg *Registry) remove(e Entry) {
+	delete(reg.keys, key(e.Customer, e.Trunk))
+	delete(reg.entries, e.OrigID)
+}
+
+// save persists all entries - caller holds the lock. The file is replaced atomically
+func (reg *Registry) save() error {
+	if len(reg.file) == 0 {
+		return nil
+	}
+	l := make([]Entry, 0, len(reg.entries))
+	for _, e := range reg.entries {
+		l = append(l, e)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].OrigID < l[j].OrigID })
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(reg.file), filepath.Base(reg.file))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), reg.file)
+}
+
+func key(customer, trunk string) string {
+	return customer + "\x00" + trunk
+}
@@ -0,0 +1,68 @@
+package origids
+
+import (
+	"os"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "origids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "origids.json")
+	reg, err := InitObject(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme, err := reg.Add(Entry{Customer: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trunk, err := reg.Add(Entry{Customer: "acme", Trunk: "acme-trunk-1", OrigID: "1db966a6-8f30-11e7-bc77-fa163e70349d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Add(Entry{Customer: "acme", Trunk: "acme-trunk-1"}); err == nil {
+		t.Errorf("Add() of a registered customer and trunk - want error")
+	}
+	if _, err := reg.Add(Entry{Customer: "other", OrigID: "not-a-uuid"}); err == nil {
+		t.Errorf("Add() with an invalid origid - want error")
+	}
+	// entries are reloaded from the file
+	if reg, err = InitObject(f); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		customer, trunk, want string
+	}{
+		{"acme", "acme-trunk-1", trunk.OrigID},
+		{"acme", "acme-trunk-2", acme.OrigID},
+		{"acme", "", acme.OrigID},
+		{"other", "acme-trunk-1", ""},
+	} {
+		e, ok := reg.Lookup(c.customer, c.trunk)
+		if ok != (len(c.want) > 0) || e.OrigID != c.want {
+			t.Errorf("Lookup(%v, %v) = %v, %v - want %v", c.customer, c.trunk, e.OrigID, ok, c.want)
+		}
+	}
+	// an update that conflicts leaves the entry unchanged
+	if _, err := reg.Update(trunk.OrigID, Entry{Customer: "acme"}); err == nil {
+		t.Errorf("Update() to a registered customer - want error")
+	}
+	if e, ok := reg.Lookup("acme", "acme-trunk-1"); !ok || e.OrigID != trunk.OrigID {
+		t.Errorf("Lookup() after failed Update() = %v, %v - want %v", e.OrigID, ok, trunk.OrigID)
+	}
+	if err := reg.Delete(trunk.OrigID); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Delete(trunk.OrigID); err != ErrNotFound {
+		t.Errorf("Delete() of a removed origid = %v - want ErrNotFound", err)
+	}
+	if n := reg.Size(); n != 1 {
+		t.Errorf("Size() = %v - want 1", n)
+	}
+}
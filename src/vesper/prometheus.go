@@ -0,0 +1,184 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"sync"
+	"time"
+	"strings"
+	"net/http"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	"vesper/stats"
+	"vesper/metrics"
+	"vesper/publickeys"
+	"vesper/configuration"
+)
+
+var (
+	requestDuration = metrics.NewHistogram("vesper_http_request_duration_seconds", "Latency of HTTP requests by endpoint.", metrics.DefaultBuckets, "endpoint")
+	signingResults = metrics.NewCounter("vesper_signing_requests_total", "Signing requests by endpoint, result reasonCode and attest.", "endpoint", "reason_code", "attest")
+	verificationResults = metrics.NewCounter("vesper_verification_requests_total", "Verification requests by endpoint, result reasonCode and attest.", "endpoint", "reason_code", "attest")
+	cacheEntries = metrics.NewGauge("vesper_cache_entries", "Entries in caches and stores.", "cache")
+	refreshAge = metrics.NewGauge("vesper_last_refresh_age_seconds", "Seconds since the last successful refresh.", "source")
+	outboundDuration = metrics.NewHistogram("vesper_outbound_request_duration_seconds", "Latency of outbound HTTP requests by target.", metrics.DefaultBuckets, "target")
+)
+
+// endpoints counted as signing or verification requests
+var endpointTypes = map[string]string{
+	"/stir/v1/signing"								: "signing",
+	"/stir/v1/signing/invite"					: "signing",
+	"/stir/v1/signing/rph"						: "signing",
+	"/stir/v1/messaging/signing"			: "signing",
+	"/stir/v1/verification"						: "verification",
+	"/stir/v1/messaging/verification"	: "verification",
+	"/sip/signing"										: "signing",
+	"/sip/verification"								: "verification",
+}
+
+// time of the last successful refresh, by source
+var (
+	refreshMtx = &sync.Mutex{}
+	refreshed = make(map[string]time.Time)
+)
+
+func init() {
+	metrics.BeforeWrite(func() {
+		cacheEntries.Set(float64(publickeys.Size()), "public_keys")
+		if replayAttackCache != nil {
+			cacheEntries.Set(float64(replayAttackCache.Size()), "replay_attack")
+		}
+		if cpsStore != nil {
+			cacheEntries.Set(float64(cpsStore.Size()), "cps_passports")
+		}
+		if tnInventory != nil {
+			cacheEntries.Set(float64(tnInventory.Size()), "tn_inventory")
+		}
+		if origIDRegistry != nil {
+			cacheEntries.Set(float64(origIDRegistry.Size()), "origids")
+		}
+		refreshMtx.Lock()
+		defer refreshMtx.Unlock()
+		for s, t := range refreshed {
+			refreshAge.Set(time.Since(t).Seconds(), s)
+		}
+	})
+}
+
+// markRefreshed records a successful refresh of source ("eks", "root_certs" or
+// "signing_credentials")
+func markRefreshed(source string) {
+	refreshMtx.Lock()
+	defer refreshMtx.Unlock()
+	refreshed[source] = time.Now()
+}
+
+// metricsWriter captures the outcome of a request for metrics
+type metricsWriter struct {
+	http.ResponseWriter
+	status			int
+	reasonCode	string
+	attest			string
+}
+
+func (m *metricsWriter) WriteHeader(code int) {
+	m.status = code
+	m.ResponseWriter.WriteHeader(code)
+}
+
+// observeOutcome sets the reasonCode and attest of the outcome of a request, if
+// not set yet
+func observeOutcome(response http.ResponseWriter, reasonCode, attest string) {
+	m, ok := response.(*metricsWriter)
+	if !ok {
+		return
+	}
+	if len(m.reasonCode) == 0 {
+		m.reasonCode = reasonCode
+	}
+	if len(m.attest) == 0 {
+		m.attest = attest
+	}
+}
+
+// instrument wraps the HTTP handler of all endpoints. The latency and outcome
+// of each request is observed by endpoint (route pattern) - in metrics, and in
+// the windowed stats
+func instrument(router *httprouter.Router, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		m := &metricsWriter{ResponseWriter: response, status: http.StatusOK}
+		h.ServeHTTP(m, request)
+		observeRequest(routePattern(router, request), m.status, m.reasonCode, m.attest, time.Since(start))
+	})
+}
+
+// observeRequest observes the latency d and the outcome of a request to
+// endpoint - in metrics, and in the windowed stats
+func observeRequest(endpoint string, status int, reasonCode, attest string, d time.Duration) {
+	requestDuration.Observe(d.Seconds(), endpoint)
+	stats.ObserveRequest(endpoint, status, reasonCode, d)
+	if len(reasonCode) == 0 {
+		reasonCode = "none"
+	}
+	if len(attest) == 0 {
+		attest = "none"
+	}
+	switch endpointTypes[endpoint] {
+	case "signing":
+		signingResults.Inc(endpoint, reasonCode, attest)
+	case "verification":
+		verificationResults.Inc(endpoint, reasonCode, attest)
+	}
+}
+
+// routePattern returns the route of a request, with parameter names in place of
+// their values (e.g. /stir/v1/admin/tns/:tn), "other" if no route matches
+func routePattern(router *httprouter.Router, request *http.Request) string {
+	h, ps, _ := router.Lookup(request.Method, request.URL.Path)
+	if h == nil {
+		return "other"
+	}
+	segments := strings.Split(request.URL.Path, "/")
+	i := 0
+	for _, p := range ps {
+		for ; i < len(segments); i++ {
+			if segments[i] == p.Value {
+				segments[i] = ":" + p.Key
+				i++
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// outboundTransport observes the latency of outbound requests of httpClient
+type outboundTransport struct {
+	http.RoundTripper
+}
+
+func (t outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := "other"
+	if u, _ := eksCredentials.GetEksCredentials(); len(u) > 0 && strings.HasPrefix(req.URL.String(), u) {
+		target = "eks"
+	} else if u := configuration.ConfigurationInstance().CpsUrl; len(u) > 0 && strings.HasPrefix(req.URL.String(), u) {
+		target = "cps"
+	}
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	outboundDuration.Observe(time.Since(start).Seconds(), target)
+	return resp, err
+}
+
+// getMetrics writes all metrics in the Prometheus text exposition format
+func getMetrics(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	response.Header().Set("Content-Type", metrics.ContentType)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	response.WriteHeader(http.StatusOK)
+	metrics.Write(response)
+}
@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"sync"
 	"crypto/ecdsa"
+	"vesper/claimconstraints"
 )
 
 var (
 	mtx = &sync.RWMutex{}
 	publicKeys = make(map[string]*ecdsa.PublicKey)
+	spcs = make(map[string]string)
+	constraints = make(map[string]*claimconstraints.Constraints)
 )
 
 // returns cached public key if present
@@ -29,13 +32,54 @@ func Add(x5u string, pk *ecdsa.PublicKey) {
 	publicKeys[x5u] = pk
 }
 
-// clears all cached public keys
+// caches the SPC (OCN) in the TNAuthList of the certificate of x5u
+func AddSPC(x5u, spc string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	spcs[x5u] = spc
+}
+
+// returns the cached SPC of x5u, empty if not known
+func SPC(x5u string) string {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	return spcs[x5u]
+}
+
+// caches the JWT Claim Constraints of the certificate of x5u
+func AddClaimConstraints(x5u string, c *claimconstraints.Constraints) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	constraints[x5u] = c
+}
+
+// returns the cached JWT Claim Constraints of x5u, nil if it has none
+func ClaimConstraints(x5u string) *claimconstraints.Constraints {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	return constraints[x5u]
+}
+
+// clears all cached public keys, SPCs and JWT Claim Constraints
 func FlushCache() {
 	mtx.Lock()
 	defer mtx.Unlock()
 	for k, _ := range publicKeys {
 		delete(publicKeys, k)
 	}
+	for k, _ := range spcs {
+		delete(spcs, k)
+	}
+	for k, _ := range constraints {
+		delete(constraints, k)
+	}
+}
+
+// returns the number of cached public keys
+func Size() int {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	return len(publicKeys)
 }
 
 // prints all entries in cache
@@ -0,0 +1,133 @@
+// Package ratelimit limits the requests of each client - a token bucket (rate
+// and burst) and a daily quota (UTC days). Clients are identified by their
+// authenticated identity, or by their IP address.
+//
+// This data structure is thread safe.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit - rate limit and daily quota of each client. Zero Rate or Quota means no limit
+type Limit struct {
+	Rate		float64		// requests per second
+	Burst		int				// bucket size
+	Quota		int64			// requests per day
+}
+
+// Usage - current usage of a client
+type Usage struct {
+	Requests		int64			`json:"requests"`							// admitted today
+	Rejected		int64			`json:"rejected"`							// rejected today
+	Quota				int64			`json:"quota,omitempty"`
+	Tokens			float64		`json:"tokens,omitempty"`			// left in the bucket
+}
+
+type client struct {
+	tokens		float64
+	last			time.Time
+	day				string
+	requests	int64
+	rejected	int64
+}
+
+// Limiter - per client rate limiter
+type Limiter struct {
+	sync.Mutex		// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	limit			Limit
+	clients		map[string]*client
+}
+
+// ErrRateLimited - the bucket of the client is empty
+var ErrRateLimited = fmt.Errorf("rate limit exceeded")
+
+// ErrQuotaExceeded - the client has used its daily quota
+var ErrQuotaExceeded = fmt.Errorf("daily quota exceeded")
+
+// Initialize object
+func InitObject(l Limit) (*Limiter, error) {
+	if l.Rate < 0 || l.Quota < 0 {
+		return nil, fmt.Errorf("rate limit and quota MUST NOT be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		// at least one request can be admitted
+		l.Burst = int(math.Max(1, math.Ceil(l.Rate)))
+	}
+	return &Limiter{limit: l, clients: make(map[string]*client)}, nil
+}
+
+// Allow admits a request of client c at t. If it is not admitted,
+// ErrRateLimited or ErrQuotaExceeded is returned with the time to wait before
+// retrying
+func (l *Limiter) Allow(c string, t time.Time) (time.Duration, error) {
+	l.Lock()
+	defer l.Unlock()
+	cl := l.client(c, t)
+	if l.limit.Quota > 0 && cl.requests >= l.limit.Quota {
+		cl.rejected++
+		y, m, d := t.UTC().Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC).Sub(t), ErrQuotaExceeded
+	}
+	if l.limit.Rate > 0 {
+		if cl.tokens < 1 {
+			cl.rejected++
+			return time.Duration((1 - cl.tokens) / l.limit.Rate * float64(time.Second)), ErrRateLimited
+		}
+		cl.tokens--
+	}
+	cl.requests++
+	return 0, nil
+}
+
+// Usage returns the current usage of all clients
+func (l *Limiter) Usage(t time.Time) map[string]Usage {
+	l.Lock()
+	defer l.Unlock()
+	u := make(map[string]Usage, len(l.clients))
+	for c := range l.clients {
+		cl := l.client(c, t)
+		v := Usage{Requests: cl.requests, Rejected: cl.rejected, Quota: l.limit.Quota}
+		if l.limit.Rate > 0 {
+			v.Tokens = math.Floor(cl.tokens*100) / 100
+		}
+		u[c] = v
+	}
+	return u
+}
+
+// RemoveIdle removes clients with a full bucket and no requests today, so that
+// clients that come and go do not pile up
+func (l *Limiter) RemoveIdle(t time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	for c := range l.clients {
+		cl := l.client(c, t)
+		if cl.requests == 0 && cl.rejected == 0 && (l.limit.Rate == 0 || cl.tokens >= float64(l.limit.Burst)) {
+			delete(l.clients, c)
+		}
+	}
+}
+
+// client returns the state of client c refilled up to t - caller holds the lock
+func (l *Limiter) client(c string, t time.Time) *client {
+	day := t.UTC().Format("2006-01-02")
+	cl, ok := l.clients[c]
+	if !ok {
+		cl = &client{tokens: float64(l.limit.Burst), last: t, day: day}
+		l.clients[c] = cl
+	}
+	if d := t.Sub(cl.last); d > 0 {
+		cl.tokens = math.Min(float64(l.limit.Burst), cl.tokens + d.Seconds()*l.limit.Rate)
+		cl.last = t
+	}
+	if cl.day != day {
+		cl.day, cl.requests, cl.rejected = day, 0, 0
+	}
+	return cl
+}
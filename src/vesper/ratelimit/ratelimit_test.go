@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"time"
+	"testing"
+)
+
+func TestRate(t *testing.T) {
+	l, err := InitObject(Limit{Rate: 2, Burst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if _, err := l.Allow("a", now); err != nil {
+			t.Fatalf("request %v - %v", i, err)
+		}
+	}
+	d, err := l.Allow("a", now)
+	if err != ErrRateLimited || d != 500*time.Millisecond {
+		t.Errorf("Allow() = %v, %v - want 500ms, %v", d, err, ErrRateLimited)
+	}
+	// other clients have their own bucket
+	if _, err := l.Allow("b", now); err != nil {
+		t.Errorf("Allow(b) - %v", err)
+	}
+	if _, err := l.Allow("a", now.Add(500*time.Millisecond)); err != nil {
+		t.Errorf("Allow() after refill - %v", err)
+	}
+	if u := l.Usage(now.Add(500*time.Millisecond))["a"]; u.Requests != 3 || u.Rejected != 1 {
+		t.Errorf("Usage() = %+v - want 3 requests, 1 rejected", u)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	l, _ := InitObject(Limit{Quota: 2})
+	now := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+	l.Allow("a", now)
+	l.Allow("a", now)
+	d, err := l.Allow("a", now)
+	if err != ErrQuotaExceeded || d != time.Hour {
+		t.Errorf("Allow() = %v, %v - want 1h, %v", d, err, ErrQuotaExceeded)
+	}
+	if _, err := l.Allow("a", now.Add(time.Hour)); err != nil {
+		t.Errorf("Allow() next day - %v", err)
+	}
+	l.RemoveIdle(now.Add(25*time.Hour))
+	if len(l.Usage(now.Add(25*time.Hour))) != 0 {
+		t.Errorf("RemoveIdle() - want no clients")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"strconv"
+	"net/http"
+	"vesper/ratelimit"
+	"vesper/clientauth"
+)
+
+// rph signing is rate limited as signing
+var rateLimitedAs = map[string]string{clientauth.Rph: clientauth.Signing}
+
+// admit checks the rate limit and daily quota of permission p, if configured,
+// for the client of a request - its authenticated identity, else clientIP.
+// Requests over the limit are answered with 429 and Retry-After
+func admit(p string, response http.ResponseWriter, request *http.Request, clientIP string) bool {
+	if q, ok := rateLimitedAs[p]; ok {
+		p = q
+	}
+	l, ok := rateLimiters[p]
+	if !ok {
+		return true
+	}
+	client := requestClient(request, clientIP)
+	d, err := l.Allow(client, time.Now())
+	if err == nil {
+		return true
+	}
+	eCode := "VESPER-4310"
+	if err == ratelimit.ErrQuotaExceeded {
+		eCode = "VESPER-4311"
+	}
+	response.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10))
+	rejectClient(response, request, clientIP, client, http.StatusTooManyRequests, eCode, fmt.Sprintf("%v - %v requests", err, p))
+	return false
+}
+
+// rateLimitUsage returns the current usage of each client, by permission
+func rateLimitUsage() map[string]map[string]ratelimit.Usage {
+	now := time.Now()
+	u := make(map[string]map[string]ratelimit.Usage, len(rateLimiters))
+	for p, l := range rateLimiters {
+		u[p] = l.Usage(now)
+	}
+	return u
+}
@@ -73,6 +73,13 @@ func (c *Cache) Clear() {
 	c.cache = make(map[interface{}]Set)
 }
 
+// Size returns the number of keys in cache
+func (c *Cache) Size() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.cache)
+}
+
 // get all entries in cache
 func (c *Cache) Entries() {
 	c.RLock()
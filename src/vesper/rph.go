@@ -0,0 +1,285 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"regexp"
+	"strings"
+	"reflect"
+	"net/http"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/ecdsa"
+	"encoding/json"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	"vesper/audit"
+	"vesper/configuration"
+	"vesper/stats"
+	"vesper/publickeys"
+	"vesper/claimconstraints"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// r-value of a Resource-Priority header field (RFC 4412) - namespace.priority
+var regexRValue = regexp.MustCompile(`^[A-Za-z0-9-]+\.[A-Za-z0-9-]+$`)
+
+// rphCredential - rph PASSporTs are signed only with a certificate that is
+// authorized, by its JWT Claim Constraints (RFC 8226), for the rph claim
+type rphCredential struct {
+	x5u						string
+	privateKey		*ecdsa.PrivateKey
+	constraints		*claimconstraints.Constraints
+}
+
+// loadRphCredential - loads the rph certificate and private key and checks the
+// certificate is authorized for the rph claim
+func loadRphCredential(x5u, certFile, keyFile string) (*rphCredential, error) {
+	if len(strings.TrimSpace(x5u)) == 0 {
+		return nil, fmt.Errorf("rph_x5u MUST be configured with rph_cert_file and rph_key_file")
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%v - rph certificate %v or private key %v", err, certFile, keyFile)
+	}
+	p, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("rph private key in %v is not an EC key", keyFile)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("%v - rph certificate %v", err, certFile)
+	}
+	c, err := claimconstraints.FromCertificate(cert)
+	if err != nil {
+		return nil, fmt.Errorf("%v - rph certificate %v", err, certFile)
+	}
+	if c == nil || !c.Authorizes("rph", nil) {
+		return nil, fmt.Errorf("rph certificate %v has no JWT Claim Constraints for the rph claim", certFile)
+	}
+	return &rphCredential{x5u: x5u, privateKey: p, constraints: c}, nil
+}
+
+// signRph - signs a Resource Priority PASSporT (RFC 8443) for GETS/WPS calls
+func signRph(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	stats.IncrSigningRequestCount()
+	// every terminal outcome is recorded
+	outcome := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "refused"}
+	refuse := func(reasonCode string) {
+		outcome.ReasonCode = reasonCode
+		recordDecision(response, "signing", start, outcome)
+	}
+	lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRph")
+	var r map[string]interface{}
+	err := json.NewDecoder(request.Body).Decode(&r)
+	switch {
+	case err == io.EOF:
+		refuse("VESPER-4001")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4001", "empty request body", nil)
+		return
+	case err != nil :
+		refuse("VESPER-4002")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4002", "unable to parse request body", nil)
+		return
+	}
+	orderedMap, origTN, iat, destTNs, errCode, err := validateRphPayload(r, traceID, clientIP)
+	if err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	outcome.Orig, outcome.Dest, outcome.Iat = origTN, destTNs, iat
+	// RFC 8443 section 6 - the signer MUST be authorized for the asserted r-values
+	auth, _, _ := validateRph(orderedMap["rph"])
+	if !rphSigner.constraints.Authorizes("rph", auth) {
+		refuse("VESPER-4075")
+		serveHttpResponse(start, response, lg, http.StatusForbidden, "error", traceID, "VESPER-4075", fmt.Sprintf("rph certificate is not authorized for rph auth values %v", auth), nil)
+		return
+	}
+	if errCode, err := validateNumbering(origTN, destTNs, signingOrigNumbering, signingDestNumbering); err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	logInfo("type", "signRph", "traceID", traceID, "client", client, "clientIP", clientIP, "module", "signRph", "requestPayload", r)
+	identity, credential, errCode, err := signClaimsWith("rph", orderedMap, Credential{Type: "rph", X5u: rphSigner.x5u}, rphSigner.privateKey)
+	if err != nil {
+		refuse(errCode)
+		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	outcome.Result, outcome.X5u = "signed", credential.X5u
+	recordDecision(response, "signing", start, outcome)
+	resp := make(map[string]interface{})
+	resp["signingResponse"] = make(map[string]interface{})
+	// RFC 8443 - ppt parameter is required for rph PASSporTs
+	resp["signingResponse"].(map[string]interface{})["identity"] = identity + ";ppt=rph"
+	resp["signingResponse"].(map[string]interface{})["credential"] = credential
+	lg = kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "signRph", "resp", resp)
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
+}
+
+// validateRphPayload - validates the claims of an rph PASSporT - dest, iat, orig
+// and rph
+func validateRphPayload(r map[string]interface{}, traceID, clientIP string) (map[string]interface{}, string, int64, []string, string, error) {
+	orderedMap := make(map[string]interface{})
+	if !reflect.ValueOf(r["dest"]).IsValid() || !reflect.ValueOf(r["iat"]).IsValid() || !reflect.ValueOf(r["orig"]).IsValid() || !reflect.ValueOf(r["rph"]).IsValid() {
+		return orderedMap, "", 0, nil, "VESPER-4070", fmt.Errorf("one or more of the require fields missing in request payload")
+	}
+	if len(r) != 4 {
+		return orderedMap, "", 0, nil, "VESPER-4071", fmt.Errorf("request payload has more than expected fields")
+	}
+	origTN, iat, destTNs, errCode, err := validateTNsAndIat(r, orderedMap, traceID, clientIP)
+	if err != nil {
+		return orderedMap, origTN, iat, destTNs, errCode, err
+	}
+	if _, errCode, err := validateRph(r["rph"]); err != nil {
+		return orderedMap, origTN, iat, destTNs, errCode, err
+	}
+	orderedMap["rph"] = r["rph"]
+	return orderedMap, origTN, iat, destTNs, "", nil
+}
+
+// validateRph - the rph claim is an object with an "auth" array of
+// Resource-Priority r-values
+func validateRph(v interface{}) ([]string, string, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 || !reflect.ValueOf(m["auth"]).IsValid() {
+		return nil, "VESPER-4072", fmt.Errorf("rph field MUST be a JSON object with field \"auth\" only")
+	}
+	a, ok := m["auth"].([]interface{})
+	if !ok || len(a) == 0 {
+		return nil, "VESPER-4073", fmt.Errorf("rph auth field MUST be a non-empty array")
+	}
+	auth := make([]string, 0, len(a))
+	for _, e := range a {
+		s, ok := e.(string)
+		if !ok || !regexRValue.MatchString(s) {
+			return nil, "VESPER-4074", fmt.Errorf("rph auth value %v is not a Resource-Priority r-value (namespace.priority)", e)
+		}
+		auth = append(auth, s)
+	}
+	return auth, "", nil
+}
+
+// resourcePriorityValues - Resource-Priority header field values in a
+// verification request. A header field value may hold more than one r-value
+func resourcePriorityValues(v interface{}) ([]string, error) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) == 0 {
+		return nil, fmt.Errorf("resourcePriority field in request payload MUST be a non-empty array of strings")
+	}
+	var rp []string
+	for _, e := range a {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("resourcePriority field in request payload MUST be a non-empty array of strings")
+		}
+		for _, r := range strings.Split(s, ",") {
+			r = strings.TrimSpace(r)
+			if !regexRValue.MatchString(r) {
+				return nil, fmt.Errorf("%v in resourcePriority field in request payload is not a Resource-Priority r-value (namespace.priority)", r)
+			}
+			rp = append(rp, r)
+		}
+	}
+	return rp, nil
+}
+
+// verifyRph - verifies an rph identity header against the call and the
+// Resource-Priority values of the call. The result is returned as the "rph"
+// section of verificationResponse
+func verifyRph(identity string, resourcePriority []string, origTN string, destTNs []string, iat, t int64, traceID, clientIP string) map[string]interface{} {
+	res := make(map[string]interface{})
+	claims, errCode, err := validateRphIdentity(identity, resourcePriority, origTN, destTNs, iat, t, traceID, clientIP)
+	if err != nil {
+		res["verified"] = false
+		res["reasonCode"] = errCode
+		res["reasonString"] = err.Error()
+		return res
+	}
+	res["verified"] = true
+	res["rph"] = claims["rph"]
+	return res
+}
+
+func validateRphIdentity(identity string, resourcePriority []string, origTN string, destTNs []string, iat, t int64, traceID, clientIP string) (map[string]interface{}, string, error) {
+	token := strings.Split(identity, ";")
+	if len(token) < 2 {
+		return nil, "VESPER-4190", fmt.Errorf("rphIdentity field does not contain all the relevant parameters in request payload")
+	}
+	if len(strings.Split(token[0], ".")) != 3 {
+		return nil, "VESPER-4191", fmt.Errorf("Invalid JWT format in rphIdentity field in request payload")
+	}
+	if !regexInfo.MatchString(token[1]) {
+		return nil, "VESPER-4192", fmt.Errorf("Invalid info parameter in rphIdentity field in request payload")
+	}
+	info := token[1][6:len(token[1])-1]
+	x5u, _, errCode, err := validateHeader(token[0], "rph")
+	if err != nil {
+		return nil, errCode, err
+	}
+	if x5u != info {
+		return nil, "VESPER-4193", fmt.Errorf("x5u value in JWT header does not match info parameter in rphIdentity field in request payload")
+	}
+	c, err := base64Decode(strings.Split(token[0], ".")[1])
+	if err != nil {
+		return nil, "VESPER-4152", fmt.Errorf("%v - unable to base64 url decode claims part of JWT", err)
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(c, &m); err != nil {
+		return nil, "VESPER-4153", fmt.Errorf("%v - unable to unmarshal decoded claims to map[string]interface{}", err)
+	}
+	orderedMap, origTNInClaims, iatInClaims, destTNsInClaims, errCode, err := validateRphPayload(m, traceID, clientIP)
+	if err != nil {
+		return nil, errCode, err
+	}
+	if errCode, err := matchClaims(m, origTNInClaims, destTNsInClaims, iatInClaims, origTN, destTNs, iat, t); err != nil {
+		return nil, errCode, err
+	}
+	// RFC 8443 section 5.2 - each Resource-Priority value of the call MUST be
+	// asserted in the rph claim
+	auth, _, _ := validateRph(orderedMap["rph"])
+	for _, v := range resourcePriority {
+		found := false
+		for _, a := range auth {
+			if strings.EqualFold(v, a) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, "VESPER-4194", fmt.Errorf("Resource-Priority value %v is not asserted in rph claim in JWT claims (%+v)", v, m)
+		}
+	}
+	claimsString, err := json.Marshal(orderedMap)
+	if err != nil {
+		return nil, "VESPER-4168", fmt.Errorf("%v - unable to validate replay attack", err)
+	}
+	if ok := replayAttackCache.IsPresent(iatInClaims, string(claimsString)); ok {
+		return nil, "VESPER-4169", fmt.Errorf("possible replay attack - rph identity header repeated - JWT claims (%+v) is cached", string(claimsString))
+	}
+	code, _, err := verifySignature(x5u, token[0], configuration.ConfigurationInstance().VerifyRootCA)
+	if err != nil {
+		return nil, code, err
+	}
+	// RFC 8443 section 6 - the certificate MUST be authorized for the rph claim
+	if !publickeys.ClaimConstraints(x5u).Authorizes("rph", auth) {
+		return nil, "VESPER-4198", fmt.Errorf("certificate of x5u %v is not authorized for rph claim (%+v) by its JWT Claim Constraints", x5u, orderedMap["rph"])
+	}
+	replayAttackCache.Add(iatInClaims, string(claimsString))
+	return orderedMap, "", nil
+}
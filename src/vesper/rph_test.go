@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+	"testing"
+	"vesper/publickeys"
+	"vesper/replayattack"
+	"vesper/claimconstraints"
+)
+
+func TestValidateRphIdentity(t *testing.T) {
+	s := newTestSigner(t, "https://cert.example.com/rph.pem")
+	// the certificate is authorized for ets.0 and wps.1 only
+	publickeys.AddClaimConstraints(s.x5u, &claimconstraints.Constraints{Permitted: map[string][]string{"rph": {"ets.0", "wps.1"}}})
+	now := time.Now().Unix()
+	orig, dest := "12155551212", []string{"12155551213"}
+	for _, tc := range []struct {
+		name							string
+		auth							[]interface{}
+		resourcePriority	[]string
+		iat								int64
+		errCode						string
+	}{
+		{"r-value asserted", []interface{}{"ets.0"}, []string{"ets.0"}, now, ""},
+		{"r-values compared case-insensitively", []interface{}{"ets.0"}, []string{"ETS.0"}, now, ""},
+		{"all r-values asserted", []interface{}{"ets.0", "wps.1"}, []string{"wps.1", "ets.0"}, now, ""},
+		{"no Resource-Priority", []interface{}{"ets.0"}, nil, now, ""},
+		{"r-value not asserted", []interface{}{"ets.0"}, []string{"wps.1"}, now, "VESPER-4194"},
+		{"one r-value not asserted", []interface{}{"ets.0"}, []string{"ets.0", "wps.1"}, now, "VESPER-4194"},
+		{"namespace differs", []interface{}{"ets.0"}, []string{"wps.0"}, now, "VESPER-4194"},
+		{"rph not authorized by certificate", []interface{}{"ets.1"}, []string{"ets.1"}, now, "VESPER-4198"},
+		{"auth value not an r-value", []interface{}{"ets"}, []string{"ets.0"}, now, "VESPER-4074"},
+		{"Date differs from iat", []interface{}{"ets.0"}, []string{"ets.0"}, now - 3600, "VESPER-4170"},
+	} {
+		replayAttackCache = replayattack.InitObject()
+		identity := s.sign(t, "rph", testClaims(orig, dest, now, map[string]interface{}{"rph": map[string]interface{}{"auth": tc.auth}}))
+		claims, errCode, err := validateRphIdentity(identity, tc.resourcePriority, orig, dest, tc.iat, now, "trace", "127.0.0.1")
+		if errCode != tc.errCode {
+			t.Errorf("%v: reason code = %v (%v) - want %v", tc.name, errCode, err, tc.errCode)
+			continue
+		}
+		if len(tc.errCode) == 0 && claims["rph"] == nil {
+			t.Errorf("%v: claims = %+v - want rph", tc.name, claims)
+		}
+	}
+
+	// an rph identity is cached once verified
+	identity := s.sign(t, "rph", testClaims(orig, dest, now, map[string]interface{}{"rph": map[string]interface{}{"auth": []interface{}{"ets.0"}}}))
+	if _, errCode, err := validateRphIdentity(identity, []string{"ets.0"}, orig, dest, now, now, "trace", "127.0.0.1"); err != nil {
+		t.Fatalf("rph identity: reason code = %v (%v)", errCode, err)
+	}
+	if _, errCode, _ := validateRphIdentity(identity, []string{"ets.0"}, orig, dest, now, now, "trace", "127.0.0.1"); errCode != "VESPER-4169" {
+		t.Errorf("repeated rph identity: reason code = %v - want VESPER-4169", errCode)
+	}
+	// a SHAKEN PASSporT is not an rph PASSporT
+	identity = s.sign(t, "shaken", testClaims(orig, dest, now, map[string]interface{}{"attest": "A", "origid": "x"}))
+	if _, errCode, _ := validateRphIdentity(identity, []string{"ets.0"}, orig, dest, now, now, "trace", "127.0.0.1"); errCode != "VESPER-4136" {
+		t.Errorf("shaken identity: reason code = %v - want VESPER-4136", errCode)
+	}
+}
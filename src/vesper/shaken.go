@@ -16,6 +16,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"vesper/publickeys"
+	"vesper/tnauthlist"
+	"vesper/claimconstraints"
 )
 
 // ShakenHdr - structure that holds JWT header
@@ -140,7 +142,9 @@ func verifySignature(x5u, token string, verifyCA bool) (string, int, error) {
 	// Get the data each time
 	pk := publickeys.Fetch(x5u)
 	if pk == nil {
+		start := time.Now()
 		resp, err := http.Get(x5u)
+		outboundDuration.Observe(time.Since(start).Seconds(), "x5u")
 		if err != nil {
 			logError("%v", err)
 			return "VESPER-4156", http.StatusBadRequest, err
@@ -168,6 +172,14 @@ func verifySignature(x5u, token string, verifyCA bool) (string, int, error) {
 		if err != nil {
 			return "VESPER-4159", http.StatusBadRequest, err
 		}
+		// SPC of the signer, for analytics
+		if l, err := tnauthlist.FromCertificate(cert); err == nil && len(l.SPCs) > 0 {
+			publickeys.AddSPC(x5u, l.SPCs[0])
+		}
+		// claims the signer is authorized for (e.g. rph)
+		if c, err := claimconstraints.FromCertificate(cert); err == nil && c != nil {
+			publickeys.AddClaimConstraints(x5u, c)
+		}
 		now := time.Now()
 		opts := x509.VerifyOptions{CurrentTime: now,}
 		if verifyCA {
@@ -8,9 +8,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+	"crypto/ecdsa"
 	"github.com/httprouter"
 	"github.com/satori/go.uuid"
 	"vesper/stats"
+	"vesper/audit"
+	"vesper/configuration"
 	kitlog "github.com/go-kit/kit/log"
 )
 
@@ -19,18 +22,31 @@ type SResponse struct {
 	SigningResponse ErrorBlob `json:"signingResponse"`
 }
 
+// Credential - the signing credential used for a PASSporT
+type Credential struct {
+	Type	string	`json:"type"`		// "spc", "delegate" or "rph"
+	X5u		string	`json:"x5u"`
+}
+
 // -
 func signRequest(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
 	start := time.Now()
 	response.Header().Set("Access-Control-Allow-Origin", "*")
 	response.Header().Set("Content-Type", "application/json")
 	clientIP := getClientIP(request)
+	client := clientIdentity(request)
 	traceID := request.Header.Get("Trace-Id")
 	if traceID == "" {
 		traceID = "VESPER-" + uuid.NewV1().String()
 	}
 	response.Header().Set("Trace-Id", traceID)
 	stats.IncrSigningRequestCount()
+	// every terminal outcome is recorded
+	outcome := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "refused"}
+	refuse := func(reasonCode string) {
+		outcome.ReasonCode = reasonCode
+		recordDecision(response, "signing", start, outcome)
+	}
 	// verify no query is present
 	// verify the request body is correct
 	var r map[string]interface{}
@@ -38,47 +54,137 @@ func signRequest(response http.ResponseWriter, request *http.Request, _ httprout
 	switch {
 	case err == io.EOF:
 		// empty request body
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "signRequest")
+		refuse("VESPER-4001")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
 		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4001", "empty request body", nil)
 		return
 	case err != nil :
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "signRequest")
+		refuse("VESPER-4002")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
 		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4002", "unable to parse request body", nil)
 		return
 	default:
 		// err == nil. continue
 	}
-	orderedMap, _, _, _, _, errCode, err := validatePayload(r, traceID, clientIP)
+	// customer, trunk and gateway are used by the attestation policy and the
+	// origid registry, if configured
+	origin, httpCode, errCode, err := callOrigin(r, request)
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "signRequest")
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	if errCode, err := applyOrigIDRegistry(r, origin); err != nil {
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
 		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
 		return
 	}
-	logInfo("type", "signRequest", "traceID", traceID, "clientIP", clientIP, "module", "signRequest", "requestPayload", r)
-	x, p := signingCredentials.Signing()
-	// at this point, the input has been validated
-	hdr := ShakenHdr{	Alg: "ES256", Ppt: "shaken", Typ: "passport", X5u: x}
-	hdrBytes, err := json.Marshal(hdr)
+	// attest is decided by the attestation policy, if configured
+	decision, httpCode, errCode, err := applyAttestPolicy(r, origin)
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "signRequest")
-		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, "VESPER-5050", fmt.Sprintf("%v - error in converting header to byte array", err), nil)
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, errCode, err.Error(), nil)
 		return
 	}
-	claimsBytes, _ := json.Marshal(orderedMap)
+	orderedMap, origTN, iat, destTNs, origID, errCode, err := validatePayload(r, traceID, clientIP)
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "signRequest")
-		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, "VESPER-5051", fmt.Sprintf("%v - error in converting claims to byte array", err), nil)
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
 		return
 	}
-	canonicalString, sig, err := createSignature(hdrBytes, claimsBytes, p)
+	outcome.Orig, outcome.Dest, outcome.OrigID, outcome.Iat = origTN, destTNs, origID, iat
+	if errCode, err := validateNumbering(origTN, destTNs, signingOrigNumbering, signingDestNumbering); err != nil {
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	if httpCode, errCode, err := dnoSigning(origTN); err != nil {
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	// the pre-sign hook may deny signing or change attest, if configured
+	hookResp, httpCode, errCode, err := applyPreSignHook(traceID, requestClient(request, clientIP), orderedMap, origTN, destTNs, iat, origID, decision)
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "signRequest")
-		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, "VESPER-5052", fmt.Sprintf("%v - error in signing request for request payload", err), nil)
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, errCode, err.Error(), nil)
 		return
 	}
+	logInfo("type", "signRequest", "traceID", traceID, "client", client, "clientIP", clientIP, "module", "signRequest", "requestPayload", r)
+	identity, credential, errCode, err := signClaims("shaken", orderedMap, origTN)
+	if err != nil {
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signRequest")
+		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	recordSigning(traceID, requestClient(request, clientIP), orderedMap, origTN, iat, destTNs, origID, credential, start)
+	outcome.Result, outcome.X5u = "signed", credential.X5u
+	outcome.Attest, _ = orderedMap["attest"].(string)
+	recordDecision(response, "signing", start, outcome)
+	if len(configuration.ConfigurationInstance().CpsUrl) > 0 {
+		// CPS client mode - publish the PASSporT out-of-band
+		go publishToCps(traceID, identity, origTN, destTNs)
+	}
 	resp := make(map[string]interface{})
 	resp["signingResponse"] = make(map[string]interface{})
-	resp["signingResponse"].(map[string]interface{})["identity"] = canonicalString + "." + sig + ";info=<" + x + ">;alg=ES256"
-	lg := kitlog.With(glogger, "type", "requestResponseTime", "module", "signRequest", "resp", resp)
+	resp["signingResponse"].(map[string]interface{})["identity"] = identity
+	resp["signingResponse"].(map[string]interface{})["credential"] = credential
+	if decision != nil {
+		resp["signingResponse"].(map[string]interface{})["attestation"] = decision
+	}
+	if hookResp != nil && len(hookResp.Attest) > 0 {
+		resp["signingResponse"].(map[string]interface{})["preSignHook"] = hookResp
+	}
+	lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "signRequest", "resp", resp)
 	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
 }
+
+// signingCredential selects the credential to sign a PASSporT for origTN with. In
+// delegate signing mode, the delegate certificate whose TNAuthList covers origTN is
+// used. The SPC credential is used otherwise
+func signingCredential(origTN string) (Credential, *ecdsa.PrivateKey) {
+	if delegateCredentials != nil {
+		if x, p, ok := delegateCredentials.Signing(origTN); ok {
+			return Credential{Type: "delegate", X5u: x}, p
+		}
+	}
+	x, p := signingCredentials.Signing()
+	return Credential{Type: "spc", X5u: x}, p
+}
+
+// signClaims signs validated (ordered) claims of a PASSporT of type ppt for origTN
+// and returns the identity header value and the credential used.
+// On failure, the VESPER reason code is returned - all failures are internal errors
+func signClaims(ppt string, orderedMap map[string]interface{}, origTN string) (string, Credential, string, error) {
+	c, p := signingCredential(origTN)
+	return signClaimsWith(ppt, orderedMap, c, p)
+}
+
+// signClaimsWith signs validated (ordered) claims of a PASSporT of type ppt with
+// credential c, of private key p
+func signClaimsWith(ppt string, orderedMap map[string]interface{}, c Credential, p *ecdsa.PrivateKey) (string, Credential, string, error) {
+	x := c.X5u
+	// at this point, the input has been validated
+	hdr := ShakenHdr{	Alg: "ES256", Ppt: ppt, Typ: "passport", X5u: x}
+	hdrBytes, err := json.Marshal(hdr)
+	if err != nil {
+		return "", c, "VESPER-5050", fmt.Errorf("%v - error in converting header to byte array", err)
+	}
+	claimsBytes, err := json.Marshal(orderedMap)
+	if err != nil {
+		return "", c, "VESPER-5051", fmt.Errorf("%v - error in converting claims to byte array", err)
+	}
+	canonicalString, sig, err := createSignature(hdrBytes, claimsBytes, p)
+	if err != nil {
+		return "", c, "VESPER-5052", fmt.Errorf("%v - error in signing request for request payload", err)
+	}
+	return canonicalString + "." + sig + ";info=<" + x + ">;alg=ES256", c, "", nil
+}
@@ -0,0 +1,204 @@
+// Package sip implements the minimal SIP message handling vesper needs - parsing
+// requests and responses, reading and inserting header fields and extracting
+// telephone numbers from SIP/TEL URIs.
+//
+// This is NOT a SIP stack. There is no transaction or dialog handling.
+package sip
+
+import (
+	"fmt"
+	"bytes"
+	"strings"
+	"strconv"
+	"crypto/tls"
+)
+
+// compact forms of header field names (RFC 3261 section 7.3.3 and RFC 8224)
+var compactForms = map[string]string{
+	"c": "Content-Type",
+	"e": "Content-Encoding",
+	"f": "From",
+	"i": "Call-ID",
+	"k": "Supported",
+	"l": "Content-Length",
+	"m": "Contact",
+	"s": "Subject",
+	"t": "To",
+	"v": "Via",
+	"y": "Identity",
+}
+
+// header - a single header field, as it appeared in the message
+type header struct {
+	name	string
+	value	string
+}
+
+// Message - a parsed SIP request or response
+type Message struct {
+	// request line - only set for requests
+	Method			string
+	RequestURI	string
+	// status line - only set for responses
+	StatusCode	int
+	Reason			string
+
+	Version			string
+	headers			[]header
+	Body				[]byte
+	// TLS connection state - only set for requests received over TLS
+	TLS					*tls.ConnectionState
+}
+
+// canonicalName returns the long form of a header field name
+func canonicalName(n string) string {
+	n = strings.TrimSpace(n)
+	if l, ok := compactForms[strings.ToLower(n)]; ok {
+		return l
+	}
+	return n
+}
+
+// Parse parses a SIP message. Both CRLF and bare LF line endings are accepted.
+func Parse(b []byte) (*Message, error) {
+	// split header section and body
+	var head, body []byte
+	if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 {
+		head, body = b[:i], b[i+4:]
+	} else if i := bytes.Index(b, []byte("\n\n")); i >= 0 {
+		head, body = b[:i], b[i+2:]
+	} else {
+		head = b
+	}
+	lines := strings.Split(strings.Replace(string(head), "\r\n", "\n", -1), "\n")
+	// RFC 3261 section 7.5 - leading CRLFs should be ignored
+	for len(lines) > 0 && len(strings.TrimSpace(lines[0])) == 0 {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty SIP message")
+	}
+	m := new(Message)
+	start := strings.Fields(lines[0])
+	if len(start) < 2 {
+		return nil, fmt.Errorf("invalid start line \"%v\"", lines[0])
+	}
+	if strings.HasPrefix(start[0], "SIP/") {
+		// status line
+		m.Version = start[0]
+		c, err := strconv.Atoi(start[1])
+		if err != nil || c < 100 || c > 699 {
+			return nil, fmt.Errorf("invalid status code in status line \"%v\"", lines[0])
+		}
+		m.StatusCode = c
+		m.Reason = strings.Join(start[2:], " ")
+	} else {
+		// request line
+		if len(start) != 3 || !strings.HasPrefix(start[2], "SIP/") {
+			return nil, fmt.Errorf("invalid request line \"%v\"", lines[0])
+		}
+		m.Method = strings.ToUpper(start[0])
+		m.RequestURI = start[1]
+		m.Version = start[2]
+	}
+	for _, l := range lines[1:] {
+		if len(l) == 0 {
+			continue
+		}
+		// header field folding
+		if l[0] == ' ' || l[0] == '\t' {
+			if len(m.headers) == 0 {
+				return nil, fmt.Errorf("continuation line without header field")
+			}
+			m.headers[len(m.headers)-1].value += " " + strings.TrimSpace(l)
+			continue
+		}
+		i := strings.Index(l, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header field \"%v\"", l)
+		}
+		m.headers = append(m.headers, header{name: strings.TrimSpace(l[:i]), value: strings.TrimSpace(l[i+1:])})
+	}
+	// honor Content-Length when present; extra bytes are dropped
+	if cl := m.Header("Content-Length"); len(cl) > 0 {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid Content-Length \"%v\"", cl)
+		}
+		if n > len(body) {
+			return nil, fmt.Errorf("body is shorter (%v) than Content-Length (%v)", len(body), n)
+		}
+		body = body[:n]
+	}
+	m.Body = body
+	return m, nil
+}
+
+// IsRequest returns true if the message is a request
+func (m *Message) IsRequest() bool {
+	return len(m.Method) > 0
+}
+
+// Header returns the value of the first header field with the given name, or an
+// empty string. Compact forms are matched and names are case insensitive.
+func (m *Message) Header(n string) string {
+	n = canonicalName(n)
+	for _, h := range m.headers {
+		if strings.EqualFold(canonicalName(h.name), n) {
+			return h.value
+		}
+	}
+	return ""
+}
+
+// Headers returns the values of all header fields with the given name, in order
+func (m *Message) Headers(n string) []string {
+	var v []string
+	n = canonicalName(n)
+	for _, h := range m.headers {
+		if strings.EqualFold(canonicalName(h.name), n) {
+			v = append(v, h.value)
+		}
+	}
+	return v
+}
+
+// AddHeader appends a header field after all existing header fields
+func (m *Message) AddHeader(n, v string) {
+	m.headers = append(m.headers, header{name: n, value: v})
+}
+
+// SetHeader replaces all header fields with the given name by a single one
+func (m *Message) SetHeader(n, v string) {
+	m.RemoveHeader(n)
+	m.AddHeader(n, v)
+}
+
+// RemoveHeader removes all header fields with the given name
+func (m *Message) RemoveHeader(n string) {
+	n = canonicalName(n)
+	h := m.headers[:0]
+	for _, v := range m.headers {
+		if !strings.EqualFold(canonicalName(v.name), n) {
+			h = append(h, v)
+		}
+	}
+	m.headers = h
+}
+
+// Bytes serializes the message. Header fields are written in their original
+// order and form, using CRLF line endings.
+func (m *Message) Bytes() []byte {
+	var b bytes.Buffer
+	if m.IsRequest() {
+		fmt.Fprintf(&b, "%s %s %s\r\n", m.Method, m.RequestURI, m.Version)
+	} else {
+		fmt.Fprintf(&b, "%s %d %s\r\n", m.Version, m.StatusCode, m.Reason)
+	}
+	for _, h := range m.headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", h.name, h.value)
+	}
+	b.WriteString("\r\n")
+	b.Write(m.Body)
+	return b.Bytes()
+}
@@ -0,0 +1,85 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+)
+
+const invite = "INVITE sip:+12155551213@example.com;user=phone SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds\r\n" +
+	"f: \"Alice\" <sip:+1-215-555-1212@example.com;user=phone>;tag=1928301774\r\n" +
+	"To: <tel:+12155551213>\r\n" +
+	"Call-ID: a84b4c76e66710@10.0.0.1\r\n" +
+	"CSeq: 314159 INVITE\r\n" +
+	"P-Asserted-Identity: <tel:+12155551214>\r\n" +
+	"Date: Sat, 13 Nov 2010 23:29:00 GMT\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: 4\r\n" +
+	"\r\n" +
+	"v=0\n"
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(invite))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !m.IsRequest() || m.Method != "INVITE" || m.RequestURI != "sip:+12155551213@example.com;user=phone" {
+		t.Errorf("unexpected request line - %v %v", m.Method, m.RequestURI)
+	}
+	if v := m.Header("From"); !strings.HasPrefix(v, "\"Alice\"") {
+		t.Errorf("compact form not matched - %v", v)
+	}
+	if v := m.Header("p-asserted-identity"); v != "<tel:+12155551214>" {
+		t.Errorf("case insensitive match failed - %v", v)
+	}
+	if string(m.Body) != "v=0\n" {
+		t.Errorf("unexpected body %q", m.Body)
+	}
+	if _, err := Parse([]byte("INVITE sip:x@y\r\n\r\n")); err == nil {
+		t.Errorf("invalid request line accepted")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	m, err := Parse([]byte(invite))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m.AddHeader("Identity", "a.b.c;info=<https://x.example.com/c.pem>;alg=ES256;ppt=shaken")
+	b := string(m.Bytes())
+	if !strings.Contains(b, "Content-Length: 4\r\nIdentity: a.b.c;") || !strings.HasSuffix(b, "\r\n\r\nv=0\n") {
+		t.Errorf("unexpected serialization %q", b)
+	}
+	m2, err := Parse([]byte(b))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if v := m2.Header("y"); !strings.HasPrefix(v, "a.b.c") {
+		t.Errorf("Identity header not found - %v", v)
+	}
+}
+
+func TestTelephoneNumber(t *testing.T) {
+	tests := map[string]string{
+		"sip:+1-215-555-1212@example.com;user=phone": "12155551212",
+		"sips:12155551212;npdi@example.com":          "12155551212",
+		"tel:+12155551212;rn=+12155550000":           "12155551212",
+	}
+	for u, tn := range tests {
+		n, err := TelephoneNumber(u)
+		if err != nil || n != tn {
+			t.Errorf("%v - got %v (%v), expected %v", u, n, err, tn)
+		}
+	}
+	for _, u := range []string{"sip:alice@example.com", "mailto:a@b", "tel:"} {
+		if _, err := TelephoneNumber(u); err == nil {
+			t.Errorf("%v - expected an error", u)
+		}
+	}
+	if u := URI("\"Alice\" <sip:alice@example.com>;tag=1"); u != "sip:alice@example.com" {
+		t.Errorf("unexpected URI %v", u)
+	}
+	if u := AddUserParameter("sip:+12155551212@example.com;user=phone", "verstat=TN-Validation-Passed"); u != "sip:+12155551212;verstat=TN-Validation-Passed@example.com;user=phone" {
+		t.Errorf("unexpected URI %v", u)
+	}
+}
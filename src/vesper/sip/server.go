@@ -0,0 +1,324 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"bufio"
+	"bytes"
+	"strings"
+	"strconv"
+	"crypto/tls"
+	"io"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// maximum size of a SIP message accepted by the server
+const maxMessageSize = 65535
+
+// number of UDP requests served at once
+const udpWorkers = 64
+
+// number of TCP and TLS connections served at once - connections over the limit
+// are closed when accepted
+const maxConnections = 1024
+
+// time allowed for a TLS handshake
+const handshakeTimeout = 10 * time.Second
+
+// time allowed to receive the next message on a TCP or TLS connection, and to
+// send a response. Idle connections are closed
+const idleTimeout = 2 * time.Minute
+
+// Handler is called for each request received by the server. The response
+// returned is sent back on the same transport; nil means no response (ACK).
+type Handler func(req *Message, transport string, remote net.Addr) *Message
+
+// Server - stateless SIP server (e.g. a redirect server) over UDP, TCP and TLS
+type Server struct {
+	sync.Mutex
+	handler		Handler
+	closed		bool
+	udp				[]net.PacketConn
+	listeners	[]net.Listener
+	conns			chan struct{}
+	idle			time.Duration
+}
+
+// Initialize object
+func NewServer(h Handler) *Server {
+	return &Server{handler: h, conns: make(chan struct{}, maxConnections), idle: idleTimeout}
+}
+
+// ListenAndServeUDP serves requests received over UDP. It blocks until the
+// server is closed
+func (s *Server) ListenAndServeUDP(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeUDP(pc)
+}
+
+// ServeUDP serves requests received on pc by a fixed pool of udpWorkers. While
+// all workers are busy, datagrams wait in the socket buffer - and are dropped
+// when it is full (SIP over UDP retransmits). It blocks until the server is
+// closed
+func (s *Server) ServeUDP(pc net.PacketConn) error {
+	s.Lock()
+	s.udp = append(s.udp, pc)
+	s.Unlock()
+	type packet struct {
+		b			[]byte
+		raddr	net.Addr
+	}
+	packets := make(chan packet)
+	defer close(packets)
+	for i := 0; i < udpWorkers; i++ {
+		go func() {
+			for p := range packets {
+				if resp := s.serve(p.b, "udp", p.raddr, nil); resp != nil {
+					pc.WriteTo(resp, p.raddr)
+				}
+			}
+		}()
+	}
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, raddr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		b := make([]byte, n)
+		copy(b, buf[:n])
+		packets <- packet{b: b, raddr: raddr}
+	}
+}
+
+// ListenAndServeTCP serves requests received over TCP. It blocks until the
+// server is closed
+func (s *Server) ListenAndServeTCP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l, "tcp")
+}
+
+// ListenAndServeTLS serves requests received over TLS. config, if not nil, is
+// used with the certificate of certFile and keyFile (e.g. to request client
+// certificates). It blocks until the server is closed
+func (s *Server) ListenAndServeTLS(addr, certFile, keyFile string, config *tls.Config) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.Certificates = []tls.Certificate{cert}
+	l, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l, "tls")
+}
+
+// Close stops all listeners
+func (s *Server) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	for _, pc := range s.udp {
+		pc.Close()
+	}
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.closed
+}
+
+// Serve serves requests received on connections accepted by l, over transport
+// ("tcp" or "tls"). It blocks until the server is closed
+func (s *Server) Serve(l net.Listener, transport string) error {
+	s.Lock()
+	s.listeners = append(s.listeners, l)
+	s.Unlock()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		select {
+		case s.conns <- struct{}{}:
+		default:
+			// too many connections
+			c.Close()
+			continue
+		}
+		go func() {
+			defer func() { <- s.conns }()
+			s.serveConn(c, transport)
+		}()
+	}
+}
+
+// serveConn reads messages framed by Content-Length from a stream connection.
+// Requests received over TLS carry the connection state, with the client
+// certificates, if any
+func (s *Server) serveConn(c net.Conn, transport string) {
+	defer c.Close()
+	var state *tls.ConnectionState
+	if tc, ok := c.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+		cs := tc.ConnectionState()
+		state = &cs
+	}
+	r := bufio.NewReader(c)
+	for {
+		c.SetDeadline(time.Now().Add(s.idle))
+		b, err := readStreamMessage(r)
+		if err != nil {
+			return
+		}
+		if b == nil {
+			// keep-alive (RFC 5626)
+			continue
+		}
+		if resp := s.serve(b, transport, c.RemoteAddr(), state); resp != nil {
+			if _, err := c.Write(resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readStreamMessage reads one message of at most maxMessageSize bytes from a
+// stream. A nil message is returned for keep-alive CRLFs
+func readStreamMessage(r *bufio.Reader) ([]byte, error) {
+	var head bytes.Buffer
+	cl := 0
+	for {
+		l, err := readLine(r, maxMessageSize - head.Len())
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(l)) == 0 {
+			if head.Len() == 0 {
+				return nil, nil
+			}
+			head.WriteString("\r\n")
+			break
+		}
+		head.WriteString(l)
+		if i := strings.Index(l, ":"); i > 0 && strings.EqualFold(canonicalName(l[:i]), "Content-Length") {
+			cl, err = strconv.Atoi(strings.TrimSpace(l[i+1:]))
+			if err != nil || cl < 0 || cl > maxMessageSize - head.Len() {
+				return nil, fmt.Errorf("invalid Content-Length")
+			}
+		}
+	}
+	if cl > maxMessageSize - head.Len() {
+		return nil, fmt.Errorf("message too large")
+	}
+	body := make([]byte, cl)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	head.Write(body)
+	return head.Bytes(), nil
+}
+
+// readLine reads a line of at most limit bytes - a longer line is an error,
+// without buffering it
+func readLine(r *bufio.Reader, limit int) (string, error) {
+	var l []byte
+	for {
+		b, err := r.ReadSlice('\n')
+		if len(l) + len(b) > limit {
+			return "", fmt.Errorf("message too large")
+		}
+		l = append(l, b...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(l), nil
+	}
+}
+
+// serve parses a message and invokes the handler. Responses received and
+// messages that cannot be parsed are dropped
+func (s *Server) serve(b []byte, transport string, remote net.Addr, state *tls.ConnectionState) []byte {
+	m, err := Parse(b)
+	if err != nil || !m.IsRequest() {
+		return nil
+	}
+	m.TLS = state
+	resp := s.handler(m, transport, remote)
+	if resp == nil {
+		return nil
+	}
+	// Content-Length is mandatory over stream transports
+	resp.SetHeader("Content-Length", strconv.Itoa(len(resp.Body)))
+	return resp.Bytes()
+}
+
+// NewResponse creates a response to a request, copying the header fields
+// required by RFC 3261 section 8.2.6.2. A To tag is added if missing
+func NewResponse(req *Message, code int, reason string) *Message {
+	m := &Message{StatusCode: code, Reason: reason, Version: "SIP/2.0"}
+	for _, v := range req.Headers("Via") {
+		m.AddHeader("Via", v)
+	}
+	m.AddHeader("From", req.Header("From"))
+	to := req.Header("To")
+	if code > 100 && !strings.Contains(strings.ToLower(to), ";tag=") {
+		t := make([]byte, 8)
+		rand.Read(t)
+		to += ";tag=" + hex.EncodeToString(t)
+	}
+	m.AddHeader("To", to)
+	m.AddHeader("Call-ID", req.Header("Call-ID"))
+	m.AddHeader("CSeq", req.Header("CSeq"))
+	return m
+}
+
+// EscapeURIHeader escapes a value to be carried as a header in a SIP URI
+// (sip:user@host?Identity=...). See hnv-unreserved in RFC 3261 section 25.1
+func EscapeURIHeader(v string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("-_.!~*'()[]/?:+$", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package sip
+
+import (
+	"net"
+	"time"
+	"bufio"
+	"testing"
+	"math/big"
+	"crypto/tls"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"crypto/elliptic"
+)
+
+// redirect answers INVITEs with a 302 that names the transport
+func redirect(req *Message, transport string, remote net.Addr) *Message {
+	if req.Method == "ACK" {
+		return nil
+	}
+	resp := NewResponse(req, 302, "Moved Temporarily")
+	resp.AddHeader("Contact", "<sip:" + transport + "@example.com>")
+	return resp
+}
+
+func checkRedirect(t *testing.T, b []byte, transport string) {
+	m, err := Parse(b)
+	if err != nil {
+		t.Fatalf("%v - response %q", err, b)
+	}
+	if m.StatusCode != 302 || m.Header("Contact") != "<sip:" + transport + "@example.com>" || m.Header("Call-ID") != "a84b4c76e66710@10.0.0.1" || m.Header("Content-Length") != "0" {
+		t.Errorf("unexpected response over %v %q", transport, b)
+	}
+}
+
+func TestServeUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(redirect)
+	done := make(chan error)
+	go func() { done <- s.ServeUDP(pc) }()
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	// more requests than workers
+	for i := 0; i < 2 * udpWorkers; i++ {
+		if _, err := c.Write([]byte(invite)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRedirect(t, buf[:n], "udp")
+
+	s.Close()
+	if err := <- done; err != nil {
+		t.Errorf("ServeUDP() = %v after Close()", err)
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(redirect)
+	done := make(chan error)
+	go func() { done <- s.Serve(l, "tcp") }()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	// a keep-alive, then two requests on the same connection
+	if _, err := c.Write([]byte("\r\n\r\n" + invite + invite)); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(c)
+	for i := 0; i < 2; i++ {
+		b, err := readStreamMessage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRedirect(t, b, "tcp")
+	}
+
+	s.Close()
+	if err := <- done; err != nil {
+		t.Errorf("Serve() = %v after Close()", err)
+	}
+}
+
+// selfSigned returns a self-signed certificate for name
+func selfSigned(t *testing.T, name string) tls.Certificate {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: k}
+}
+
+func TestServeTLS(t *testing.T) {
+	client := selfSigned(t, "client1")
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{selfSigned(t, "server")}, ClientAuth: tls.RequireAnyClientCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the transport named in the response is the CN of the client certificate
+	s := NewServer(func(req *Message, transport string, remote net.Addr) *Message {
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+			return redirect(req, transport, remote)
+		}
+		return redirect(req, req.TLS.PeerCertificates[0].Subject.CommonName, remote)
+	})
+	done := make(chan error)
+	go func() { done <- s.Serve(l, "tls") }()
+
+	c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{Certificates: []tls.Certificate{client}, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := c.Write([]byte(invite)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := readStreamMessage(bufio.NewReader(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRedirect(t, b, "client1")
+
+	s.Close()
+	if err := <- done; err != nil {
+		t.Errorf("Serve() = %v after Close()", err)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(redirect)
+	s.conns = make(chan struct{}, 2)
+	s.idle = 200 * time.Millisecond
+	go s.Serve(l, "tcp")
+	defer s.Close()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		return c
+	}
+	closed := func(c net.Conn) bool {
+		_, err := c.Read(make([]byte, 1))
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return false
+		}
+		return err != nil
+	}
+
+	// a line longer than maxMessageSize closes the connection
+	c := dial()
+	c.Write(make([]byte, maxMessageSize + 1))
+	if !closed(c) {
+		t.Errorf("connection open after a line of %v bytes", maxMessageSize + 1)
+	}
+	c.Close()
+
+	// idle connections are closed
+	c = dial()
+	if !closed(c) {
+		t.Errorf("idle connection open")
+	}
+	c.Close()
+
+	// connections over the limit are closed when accepted
+	time.Sleep(50 * time.Millisecond)
+	c1, c2, c3 := dial(), dial(), dial()
+	defer c1.Close()
+	defer c2.Close()
+	defer c3.Close()
+	c3.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if !closed(c3) {
+		t.Errorf("connection over the limit open")
+	}
+}
@@ -0,0 +1,84 @@
+package sip
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"net/http"
+)
+
+// URI extracts the URI from a header field value in name-addr form
+// ("Alice" <sip:alice@example.com>;tag=1234) or addr-spec form
+// (sip:alice@example.com;tag=1234)
+func URI(v string) string {
+	v = strings.TrimSpace(v)
+	if i := strings.Index(v, "<"); i >= 0 {
+		if j := strings.Index(v[i:], ">"); j > 0 {
+			return v[i+1 : i+j]
+		}
+		return ""
+	}
+	// addr-spec - header field parameters follow the first ';'
+	if i := strings.Index(v, ";"); i >= 0 {
+		return v[:i]
+	}
+	return v
+}
+
+// TelephoneNumber returns the telephone number in a SIP, SIPS or TEL URI in the
+// canonical form used by SHAKEN - digits only, without the leading "+" and any
+// visual separators
+func TelephoneNumber(uri string) (string, error) {
+	var n string
+	u := strings.TrimSpace(uri)
+	switch {
+	case strings.HasPrefix(strings.ToLower(u), "sip:"), strings.HasPrefix(strings.ToLower(u), "sips:"):
+		u = u[strings.Index(u, ":")+1:]
+		i := strings.Index(u, "@")
+		if i <= 0 {
+			return "", fmt.Errorf("no user part in URI %v", uri)
+		}
+		n = u[:i]
+	case strings.HasPrefix(strings.ToLower(u), "tel:"):
+		n = u[4:]
+	default:
+		return "", fmt.Errorf("unsupported URI scheme in %v", uri)
+	}
+	// user parameters (;isub=, ;npdi, ;rn=, ...) and URI parameters are not part of the number
+	if i := strings.Index(n, ";"); i >= 0 {
+		n = n[:i]
+	}
+	n = strings.TrimPrefix(n, "+")
+	tn := make([]byte, 0, len(n))
+	for i := 0; i < len(n); i++ {
+		switch c := n[i]; {
+		case c >= '0' && c <= '9':
+			tn = append(tn, c)
+		case c == '-' || c == '.' || c == '(' || c == ')':
+			// visual separators (RFC 3966)
+		default:
+			return "", fmt.Errorf("user part of URI %v is not a telephone number", uri)
+		}
+	}
+	if len(tn) == 0 {
+		return "", fmt.Errorf("user part of URI %v is not a telephone number", uri)
+	}
+	return string(tn), nil
+}
+
+// AddUserParameter adds a parameter to the telephone number in a TEL URI or in
+// the user part of a SIP/SIPS URI (e.g. verstat, RFC 8588)
+func AddUserParameter(uri, param string) string {
+	if strings.HasPrefix(strings.ToLower(uri), "tel:") {
+		return uri + ";" + param
+	}
+	if i := strings.Index(uri, "@"); i > 0 {
+		return uri[:i] + ";" + param + uri[i:]
+	}
+	return uri
+}
+
+// ParseDate parses the value of a Date header field (RFC 3261 section 20.17)
+func ParseDate(v string) (time.Time, error) {
+	return http.ParseTime(strings.TrimSpace(v))
+}
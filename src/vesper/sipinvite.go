@@ -0,0 +1,251 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"strings"
+	"reflect"
+	"encoding/json"
+	"net/http"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	"vesper/sip"
+	"vesper/stats"
+	"vesper/audit"
+	"vesper/attestpolicy"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// origTNFromInvite - orig TN is taken from P-Asserted-Identity and, if absent, from From
+func origTNFromInvite(m *sip.Message) (string, error) {
+	// P-Asserted-Identity may carry a SIP and a TEL URI - use the first one that
+	// contains a telephone number
+	for _, v := range m.Headers("P-Asserted-Identity") {
+		for _, a := range strings.Split(v, ",") {
+			if tn, err := sip.TelephoneNumber(sip.URI(a)); err == nil {
+				return tn, nil
+			}
+		}
+	}
+	tn, err := sip.TelephoneNumber(sip.URI(m.Header("From")))
+	if err != nil {
+		return "", fmt.Errorf("%v - unable to derive orig TN from P-Asserted-Identity or From", err)
+	}
+	return tn, nil
+}
+
+// destTNFromInvite - dest TN is taken from Request-URI and, if absent, from To
+func destTNFromInvite(m *sip.Message) (string, error) {
+	if tn, err := sip.TelephoneNumber(m.RequestURI); err == nil {
+		return tn, nil
+	}
+	tn, err := sip.TelephoneNumber(sip.URI(m.Header("To")))
+	if err != nil {
+		return "", fmt.Errorf("%v - unable to derive dest TN from Request-URI or To", err)
+	}
+	return tn, nil
+}
+
+// iatFromInvite - iat is taken from Date and, if absent, is the current time
+func iatFromInvite(m *sip.Message, now time.Time) (int64, error) {
+	d := m.Header("Date")
+	if len(strings.TrimSpace(d)) == 0 {
+		return now.Unix(), nil
+	}
+	t, err := sip.ParseDate(d)
+	if err != nil {
+		return 0, fmt.Errorf("%v - invalid Date header \"%v\"", err, d)
+	}
+	return t.Unix(), nil
+}
+
+// signInvite - signs a raw SIP INVITE and returns it with the Identity header inserted
+func signInvite(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	stats.IncrSigningRequestCount()
+	// every terminal outcome is recorded - by signInviteMessage, once the INVITE is parsed
+	refuse := func(reasonCode string) {
+		recordDecision(response, "signing", start, audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "refused", ReasonCode: reasonCode})
+	}
+	var r map[string]interface{}
+	err := json.NewDecoder(request.Body).Decode(&r)
+	switch {
+	case err == io.EOF:
+		// empty request body
+		refuse("VESPER-4001")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4001", "empty request body", nil)
+		return
+	case err != nil :
+		refuse("VESPER-4002")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite")
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4002", "unable to parse request body", nil)
+		return
+	default:
+		// err == nil. continue
+	}
+	// customer, trunk and gateway are used by the attestation policy and the
+	// origid registry, if configured
+	origin, httpCode, errCode, err := callOrigin(r, request)
+	if err != nil {
+		refuse(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite", "requestPayload", r)
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	if !reflect.ValueOf(r["invite"]).IsValid() {
+		refuse("VESPER-4003")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite", "requestPayload", r)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4003", "one or more of the require fields missing in request payload", nil)
+		return
+	}
+	// attest and origid are validated with the claims derived from the INVITE
+	for k := range r {
+		if k != "invite" && k != "attest" && k != "origid" {
+			refuse("VESPER-4004")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite", "requestPayload", r)
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4004", "request payload has more than expected fields", nil)
+			return
+		}
+	}
+	inv, ok := r["invite"].(string)
+	if !ok || len(strings.TrimSpace(inv)) == 0 {
+		refuse("VESPER-4030")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite", "requestPayload", r)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4030", "invite field in request payload MUST be a non-empty string", nil)
+		return
+	}
+	m, err := sip.Parse([]byte(inv))
+	if err != nil {
+		refuse("VESPER-4031")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite", "requestPayload", r)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4031", fmt.Sprintf("%v - unable to parse SIP INVITE", err), nil)
+		return
+	}
+	delete(r, "invite")
+	identity, decision, httpCode, errCode, err := signInviteMessage(response, m, r, origin, traceID, clientIP, requestClient(request, clientIP), start)
+	if err != nil {
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "signInvite", "requestPayload", r)
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	m.AddHeader("Identity", identity)
+	resp := make(map[string]interface{})
+	resp["signingResponse"] = make(map[string]interface{})
+	resp["signingResponse"].(map[string]interface{})["identity"] = identity
+	resp["signingResponse"].(map[string]interface{})["invite"] = string(m.Bytes())
+	if decision != nil {
+		resp["signingResponse"].(map[string]interface{})["attestation"] = decision
+	}
+	lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "signInvite", "identity", identity)
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
+}
+
+// signInviteMessage derives the claims from a SIP INVITE, validates them and signs
+// them. r holds attest and origid, if given - they are validated like those in
+// the JSON signing API, and attest is the requested attest if an attestation
+// policy is configured. origin is the origin of the call, for the attestation
+// policy and the origid registry (nil if neither is configured). client is the client the signing is recorded
+// for (traceback, audit). Every outcome is recorded with recordDecision.
+// The identity header value returned is formatted for use in SIP
+func signInviteMessage(response http.ResponseWriter, m *sip.Message, r map[string]interface{}, origin *attestpolicy.Request, traceID, clientIP, client string, start time.Time) (string, *attestpolicy.Decision, int, string, error) {
+	outcome := audit.Entry{TraceID: traceID, Client: client, Result: "refused"}
+	refuse := func(reasonCode string) {
+		outcome.ReasonCode = reasonCode
+		recordDecision(response, "signing", start, outcome)
+	}
+	if m.Method != "INVITE" {
+		refuse("VESPER-4032")
+		return "", nil, http.StatusBadRequest, "VESPER-4032", fmt.Errorf("SIP message is not an INVITE request")
+	}
+	if len(m.Headers("Identity")) > 0 {
+		refuse("VESPER-4036")
+		return "", nil, http.StatusBadRequest, "VESPER-4036", fmt.Errorf("SIP INVITE already contains an Identity header")
+	}
+	origTN, err := origTNFromInvite(m)
+	if err != nil {
+		refuse("VESPER-4033")
+		return "", nil, http.StatusBadRequest, "VESPER-4033", err
+	}
+	destTN, err := destTNFromInvite(m)
+	if err != nil {
+		refuse("VESPER-4034")
+		return "", nil, http.StatusBadRequest, "VESPER-4034", err
+	}
+	iat, err := iatFromInvite(m, start)
+	if err != nil {
+		refuse("VESPER-4035")
+		return "", nil, http.StatusBadRequest, "VESPER-4035", err
+	}
+	outcome.Orig, outcome.Dest, outcome.Iat = origTN, []string{destTN}, iat
+	// build the payload expected by the JSON signing API
+	r["dest"] = map[string]interface{}{"tn": []interface{}{destTN}}
+	r["iat"] = float64(iat)
+	r["orig"] = map[string]interface{}{"tn": origTN}
+	if origin != nil {
+		origin.OrigTN = origTN
+	}
+	// origid is the origid registered for the customer, if not given
+	if errCode, err := applyOrigIDRegistry(r, origin); err != nil {
+		refuse(errCode)
+		return "", nil, http.StatusBadRequest, errCode, err
+	}
+	// attest is decided by the attestation policy, if configured
+	decision, httpCode, errCode, err := applyAttestPolicy(r, origin)
+	if err != nil {
+		refuse(errCode)
+		return "", decision, httpCode, errCode, err
+	}
+	orderedMap, _, _, destTNs, origID, errCode, err := validatePayload(r, traceID, clientIP)
+	if err != nil {
+		refuse(errCode)
+		return "", decision, http.StatusBadRequest, errCode, err
+	}
+	outcome.OrigID = origID
+	if errCode, err := validateNumbering(origTN, destTNs, signingOrigNumbering, signingDestNumbering); err != nil {
+		refuse(errCode)
+		return "", decision, http.StatusBadRequest, errCode, err
+	}
+	if httpCode, errCode, err := dnoSigning(origTN); err != nil {
+		refuse(errCode)
+		return "", decision, httpCode, errCode, err
+	}
+	// the pre-sign hook may deny signing or change attest, if configured
+	if _, httpCode, errCode, err := applyPreSignHook(traceID, client, orderedMap, origTN, destTNs, iat, origID, decision); err != nil {
+		refuse(errCode)
+		return "", decision, httpCode, errCode, err
+	}
+	identity, credential, errCode, err := signClaims("shaken", orderedMap, origTN)
+	if err != nil {
+		refuse(errCode)
+		return "", decision, http.StatusInternalServerError, errCode, err
+	}
+	recordSigning(traceID, client, orderedMap, origTN, iat, destTNs, origID, credential, start)
+	outcome.Result, outcome.X5u = "signed", credential.X5u
+	outcome.Attest, _ = orderedMap["attest"].(string)
+	recordDecision(response, "signing", start, outcome)
+	logInfo("type", "signInvite", "traceID", traceID, "clientIP", clientIP, "module", "signInviteMessage", "claims", orderedMap, "credential", credential.Type, "x5u", credential.X5u)
+	// RFC 8588 - ppt parameter is added for SHAKEN PASSporTs in SIP
+	return identity + ";ppt=shaken", decision, http.StatusOK, "", nil
+}
+
+// sipOrigin - the origin of a call signed over SIP, for the attestation policy
+// and the origid registry. Returns nil if neither is configured
+func sipOrigin() *attestpolicy.Request {
+	if attestPolicy == nil && origIDRegistry == nil {
+		return nil
+	}
+	return &attestpolicy.Request{}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"time"
+	"strings"
+	"testing"
+	"math/big"
+	"io/ioutil"
+	"crypto/rand"
+	"encoding/pem"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"encoding/json"
+	"encoding/asn1"
+	"crypto/elliptic"
+	"net/http/httptest"
+	"vesper/tnauthlist"
+	"vesper/delegatecredentials"
+)
+
+type testTNRange struct {
+	Start	string	`asn1:"ia5"`
+	Count	int
+}
+
+// initTestDelegate sets the delegate credentials to a self-signed delegate
+// certificate of x5u for TN range start/count, so that INVITEs from the range
+// are signed without fetching the signing credentials
+func initTestDelegate(t *testing.T, dir, x5u, start string, count int) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := asn1.Marshal(testTNRange{Start: start, Count: count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: r}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: tnauthlist.OID, Value: l}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile, f := filepath.Join(dir, "delegate.pem"), filepath.Join(dir, "delegate.key"), filepath.Join(dir, "delegates.json")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600)
+	b, _ := json.Marshal(map[string]interface{}{"delegates": []map[string]string{{"x5u": x5u, "certFile": certFile, "keyFile": keyFile}}})
+	if err := ioutil.WriteFile(f, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if delegateCredentials, err = delegatecredentials.InitObject(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignInviteMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "invite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x5u := "https://cert.example.com/delegate.pem"
+	initTestDelegate(t, dir, x5u, "12155551200", 100)
+	defer func() { delegateCredentials = nil }()
+
+	start := time.Now()
+	date := "Date: Sat, 13 Nov 2010 23:29:00 GMT"
+	var dateIat int64 = 1289690940
+	pai := "P-Asserted-Identity: <tel:+12155551212>"
+	from := "From: \"Alice\" <sip:+1-215-555-1213@example.com;user=phone>;tag=1928301774"
+	to := "To: <tel:+12155551214>"
+	payload := map[string]interface{}{"attest": "A", "origid": "de305d54-75b4-431b-adb2-eb6b9e546014"}
+	for _, tc := range []struct {
+		name			string
+		invite		string
+		headers		[]string
+		r					map[string]interface{}
+		orig			string
+		dest			string
+		iat				int64
+		errCode		string
+	}{
+		{"P-Asserted-Identity and Request-URI", "sip:+12155551215@example.com;user=phone", []string{pai, from, to, date}, payload, "12155551212", "12155551215", dateIat, ""},
+		{"From without P-Asserted-Identity", "sip:+12155551215@example.com;user=phone", []string{from, to, date}, payload, "12155551213", "12155551215", dateIat, ""},
+		{"To if Request-URI has no TN", "sip:bob@example.com", []string{pai, from, to, date}, payload, "12155551212", "12155551214", dateIat, ""},
+		{"current time without Date", "sip:+12155551215@example.com", []string{pai, from, to}, payload, "12155551212", "12155551215", start.Unix(), ""},
+		{"no orig TN", "sip:+12155551215@example.com", []string{"From: <sip:alice@example.com>", to, date}, payload, "", "", 0, "VESPER-4033"},
+		{"no dest TN", "sip:bob@example.com", []string{pai, from, "To: <sip:bob@example.com>", date}, payload, "", "", 0, "VESPER-4034"},
+		{"invalid Date", "sip:+12155551215@example.com", []string{pai, from, to, "Date: yesterday"}, payload, "", "", 0, "VESPER-4035"},
+		{"Identity present", "sip:+12155551215@example.com", []string{pai, from, to, date, "Identity: a.b.c;info=<https://cert.example.com/c.pem>"}, payload, "", "", 0, "VESPER-4036"},
+		{"no attest", "sip:+12155551215@example.com", []string{pai, from, to, date}, map[string]interface{}{"origid": "de305d54-75b4-431b-adb2-eb6b9e546014"}, "", "", 0, "VESPER-4003"},
+		{"attest not A, B or C", "sip:+12155551215@example.com", []string{pai, from, to, date}, map[string]interface{}{"attest": "D", "origid": "de305d54-75b4-431b-adb2-eb6b9e546014"}, "", "", 0, "VESPER-4006"},
+	} {
+		r := make(map[string]interface{})
+		for k, v := range tc.r {
+			r[k] = v
+		}
+		identity, _, _, errCode, err := signInviteMessage(httptest.NewRecorder(), testInvite(t, tc.invite, tc.headers...), r, nil, "trace", "127.0.0.1", "client", start)
+		if errCode != tc.errCode {
+			t.Errorf("%v: reason code = %v (%v) - want %v", tc.name, errCode, err, tc.errCode)
+			continue
+		}
+		if len(tc.errCode) > 0 {
+			continue
+		}
+		if !strings.HasSuffix(identity, ";info=<" + x5u + ">;alg=ES256;ppt=shaken") {
+			t.Errorf("%v: identity = %v - want info of the delegate and ppt=shaken", tc.name, identity)
+			continue
+		}
+		c, err := base64Decode(strings.Split(strings.Split(identity, ";")[0], ".")[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims struct {
+			Attest	string	`json:"attest"`
+			Dest		struct {
+				TN	[]string	`json:"tn"`
+			}	`json:"dest"`
+			Iat			int64		`json:"iat"`
+			Orig		struct {
+				TN	string	`json:"tn"`
+			}	`json:"orig"`
+			OrigID	string	`json:"origid"`
+		}
+		if err := json.Unmarshal(c, &claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims.Orig.TN != tc.orig || len(claims.Dest.TN) != 1 || claims.Dest.TN[0] != tc.dest || claims.Iat != tc.iat || claims.Attest != "A" || claims.OrigID != payload["origid"] {
+			t.Errorf("%v: claims = %+v - want orig %v, dest %v, iat %v", tc.name, claims, tc.orig, tc.dest, tc.iat)
+		}
+	}
+
+	// only INVITEs are signed
+	m := testInvite(t, "sip:+12155551215@example.com", pai, from, to)
+	m.Method = "BYE"
+	if _, _, _, errCode, _ := signInviteMessage(httptest.NewRecorder(), m, map[string]interface{}{"attest": "A", "origid": "x"}, nil, "trace", "127.0.0.1", "client", start); errCode != "VESPER-4032" {
+		t.Errorf("BYE: reason code = %v - want VESPER-4032", errCode)
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"math"
+	"time"
+	"strings"
+	"strconv"
+	"net/http"
+	"github.com/satori/go.uuid"
+	"vesper/configuration"
+	"vesper/sip"
+	"vesper/stats"
+	"vesper/audit"
+	"vesper/ratelimit"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// sipReasonPhrases - reason phrases of status codes sent by vesper
+var sipReasonPhrases = map[int]string{
+	200: "OK",
+	302: "Moved Temporarily",
+	400: "Bad Request",
+	403: "Forbidden",
+	405: "Method Not Allowed",
+	436: "Bad Identity Info",
+	437: "Unsupported Credential",
+	438: "Invalid Identity Header",
+	500: "Server Internal Error",
+	503: "Service Unavailable",
+}
+
+// SIP status codes for verification failures (RFC 8224 section 6.2.2).
+// Any other verification failure is answered with 438
+var sipVerificationStatusCodes = map[string]int{
+	"VESPER-4156": 436,
+	"VESPER-4157": 436,
+	"VESPER-4158": 436,
+	"VESPER-4159": 436,
+	"VESPER-4160": 437,
+	"VESPER-4161": 437,
+	"VESPER-4162": 437,
+	"VESPER-4163": 437,
+	"VESPER-4164": 437,
+	"VESPER-4165": 437,
+	"VESPER-4180": 400,
+	"VESPER-4181": 400,
+	"VESPER-4182": 400,
+}
+
+// sipStatus maps the HTTP status code a VESPER reason code is served with over
+// HTTP to a SIP status code
+func sipStatus(httpCode int) int {
+	switch httpCode {
+	case http.StatusBadRequest, http.StatusForbidden:
+		return httpCode
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		return 503
+	}
+	return 500
+}
+
+// sipVerificationStatus maps a VESPER reason code for a verification failure to
+// a SIP status code
+func sipVerificationStatus(reasonCode string, httpCode int) int {
+	if c, ok := sipVerificationStatusCodes[reasonCode]; ok {
+		return c
+	}
+	switch httpCode {
+	case http.StatusBadRequest, http.StatusUnauthorized:
+		return 438
+	}
+	return sipStatus(httpCode)
+}
+
+// startSipService starts a SIP listener on each of the configured transports.
+// Listener failures are reported on errs
+func startSipService(name string, transports []string, port, tlsPort string, h sip.Handler, errs chan error) *sip.Server {
+	srv := sip.NewServer(h)
+	host := configuration.ConfigurationInstance().SipHost
+	for _, t := range transports {
+		var f func() error
+		switch strings.ToLower(t) {
+		case "udp":
+			hostPort := net.JoinHostPort(host, port)
+			f = func() error { return srv.ListenAndServeUDP(hostPort) }
+		case "tcp":
+			hostPort := net.JoinHostPort(host, port)
+			f = func() error { return srv.ListenAndServeTCP(hostPort) }
+		case "tls":
+			hostPort := net.JoinHostPort(host, tlsPort)
+			f = func() error {
+				return srv.ListenAndServeTLS(hostPort, configuration.ConfigurationInstance().SslCertFile, configuration.ConfigurationInstance().SslKeyFile, tlsConfig)
+			}
+		default:
+			logError("type", "sipServiceFailure", "module", "startSipService", "message", fmt.Sprintf("%v - unsupported SIP transport %v", name, t))
+			continue
+		}
+		logInfo("type", "sipServiceStart", "message", fmt.Sprintf("starting %v SIP service over %v ...", name, t))
+		go func(t string) {
+			if err := f(); err != nil {
+				logError("type", "sipServiceFailure", "message", fmt.Sprintf("%v - could not start serving %v SIP service over %v", err, name, t))
+				errs <- err
+			}
+		}(t)
+	}
+	return srv
+}
+
+// guardSip wraps the handler of a SIP listener, like accessControl and authorize
+// wrap HTTP endpoints. With ACLs configured, requests from client IPs that are
+// not allowed to use path (e.g. /sip/signing) are denied with 403. With client
+// authentication configured, requests MUST be received over TLS with a client
+// certificate mapped to an identity with permission p - others are denied with
+// 403. INVITEs are admitted by the rate limit and daily quota of permission p, if
+// configured, for the client - INVITEs over the limit are answered with 503 and
+// Retry-After
+func guardSip(path, p string, h sipHandler) sipHandler {
+	return func(response http.ResponseWriter, req *sip.Message, transport string, remote net.Addr) *sip.Message {
+		if req.Method == "ACK" {
+			return h(response, req, transport, remote)
+		}
+		start := time.Now()
+		clientIP := sipRemoteIP(remote)
+		lg := kitlog.With(glogger, "type", "clientAuthorization", "clientIP", clientIP, "transport", transport, "path", path)
+		if accessControlLists != nil && !accessControlLists.Allowed(path, net.ParseIP(clientIP)) {
+			stats.IncrAclDeniedCount()
+			return sipErrorResponse(start, response, req, lg, sipTraceID(req), 403, "VESPER-4320", "client IP " + clientIP + " is not allowed to use " + path)
+		}
+		if clientIdentities != nil {
+			if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+				return sipErrorResponse(start, response, req, lg, sipTraceID(req), 403, "VESPER-4301", "client certificate required")
+			}
+			c := req.TLS.PeerCertificates[0]
+			id, ok := clientIdentities.Identify(c)
+			if !ok {
+				return sipErrorResponse(start, response, req, kitlog.With(lg, "client", c.Subject.String()), sipTraceID(req), 403, "VESPER-4302", "client certificate is not mapped to a client identity")
+			}
+			if !id.Allowed(p) {
+				return sipErrorResponse(start, response, req, kitlog.With(lg, "client", id.Name), sipTraceID(req), 403, "VESPER-4303", "client identity " + id.Name + " is not authorized for " + p)
+			}
+		}
+		if l, ok := rateLimiters[p]; ok && req.Method == "INVITE" {
+			d, err := l.Allow(sipRequestClient(req, clientIP), start)
+			if err != nil {
+				eCode := "VESPER-4310"
+				if err == ratelimit.ErrQuotaExceeded {
+					eCode = "VESPER-4311"
+				}
+				resp := sip.NewResponse(req, 503, sipReasonPhrases[503])
+				resp.AddHeader("Retry-After", strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10))
+				return serveSipResponse(start, response, req, resp, lg, "error", sipTraceID(req), eCode, fmt.Sprintf("%v - %v requests", err, p))
+			}
+		}
+		return h(response, req, transport, remote)
+	}
+}
+
+// sipRequestClient - the client of a SIP request, its authenticated identity,
+// else clientIP
+func sipRequestClient(req *sip.Message, clientIP string) string {
+	if id := sipClientIdentity(req); len(id) > 0 {
+		return id
+	}
+	return clientIP
+}
+
+// sipClientIdentity returns the identity of the client certificate of a SIP
+// request, empty string if the client is not authenticated
+func sipClientIdentity(req *sip.Message) string {
+	if clientIdentities == nil || req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	id, ok := clientIdentities.Identify(req.TLS.PeerCertificates[0])
+	if !ok {
+		return ""
+	}
+	return id.Name
+}
+
+// sipHandler - handler of SIP requests whose outcome is observed, like that of
+// HTTP requests, through response. No HTTP response is written
+type sipHandler func(response http.ResponseWriter, req *sip.Message, transport string, remote net.Addr) *sip.Message
+
+// instrumentSip wraps the handler of a SIP listener, like instrument wraps HTTP
+// endpoints. The latency and outcome of each request is observed as endpoint
+// (e.g. /sip/signing)
+func instrumentSip(endpoint string, h sipHandler) sip.Handler {
+	return func(req *sip.Message, transport string, remote net.Addr) *sip.Message {
+		start := time.Now()
+		m := &metricsWriter{status: http.StatusOK}
+		resp := h(m, req, transport, remote)
+		if resp != nil {
+			observeRequest(endpoint, resp.StatusCode, m.reasonCode, m.attest, time.Since(start))
+		}
+		return resp
+	}
+}
+
+// sipTraceID - uses Trace-Id in the request, if present
+func sipTraceID(req *sip.Message) string {
+	traceID := req.Header("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	return traceID
+}
+
+// sipRemoteIP - IP address of the SIP client
+func sipRemoteIP(remote net.Addr) string {
+	h, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return remote.String()
+	}
+	return h
+}
+
+// serveSipResponse is the SIP counterpart of serveHttpResponse - it completes the
+// response, updates stats and logs the outcome
+func serveSipResponse(s time.Time, w http.ResponseWriter, req *sip.Message, resp *sip.Message, l kitlog.Logger, level, traceID, eCode, eString string) *sip.Message {
+	observeOutcome(w, eCode, "")
+	resp.AddHeader("Trace-Id", traceID)
+	if len(eCode) > 0 {
+		// RFC 3326
+		resp.AddHeader("Reason", fmt.Sprintf("SIP;cause=%d;text=\"%s - %s\"", resp.StatusCode, eCode, strings.Replace(eString, "\"", "'", -1)))
+	}
+	t := int64(time.Since(s).Seconds()*1000)
+	stats.UpdateApiProcessingTime(t)
+	lg := kitlog.With(
+		l,
+		"code", level,
+		"traceID", traceID,
+		"sipMethod", req.Method,
+		"sipCallID", req.Header("Call-ID"),
+		"sipResponseCode", resp.StatusCode,
+		"reasonCode", eCode,
+		"reasonString", eString,
+		"apiProcessingTimeInMilliSeconds", t,
+	)
+	lg.Log()
+	return resp
+}
+
+// sipErrorResponse - error response for a VESPER reason code
+func sipErrorResponse(s time.Time, w http.ResponseWriter, req *sip.Message, l kitlog.Logger, traceID string, c int, eCode, eString string) *sip.Message {
+	return serveSipResponse(s, w, req, sip.NewResponse(req, c, sipReasonPhrases[c]), l, "error", traceID, eCode, eString)
+}
+
+// sipSigningHandler - STI-AS redirect server. INVITEs are answered with a 302
+// whose Contact carries the Identity header as a URI header
+func sipSigningHandler(response http.ResponseWriter, req *sip.Message, transport string, remote net.Addr) *sip.Message {
+	start := time.Now()
+	switch req.Method {
+	case "ACK":
+		// ACK for a final non-2xx response - nothing to do
+		return nil
+	case "OPTIONS":
+		// health check
+		resp := sip.NewResponse(req, 200, sipReasonPhrases[200])
+		resp.AddHeader("Allow", "INVITE, ACK, OPTIONS")
+		return resp
+	case "INVITE":
+	default:
+		resp := sip.NewResponse(req, 405, sipReasonPhrases[405])
+		resp.AddHeader("Allow", "INVITE, ACK, OPTIONS")
+		return resp
+	}
+	clientIP := sipRemoteIP(remote)
+	client := sipRequestClient(req, clientIP)
+	traceID := sipTraceID(req)
+	stats.IncrSigningRequestCount()
+	lg := kitlog.With(glogger, "type", "sipRequest", "clientIP", clientIP, "client", client, "transport", transport, "module", "sipSigningHandler")
+	// attestation and origination ID are taken from the INVITE, if present. With
+	// an attestation policy, attest is only the requested attest. Without
+	// P-Origination-ID, origid is the one registered for the customer, if the
+	// customer is known and an origid registry is configured
+	origin := sipOrigin()
+	r := make(map[string]interface{})
+	if a := req.Header("P-Attestation-Indicator"); len(a) > 0 {
+		r["attest"] = a
+	} else if a = configuration.ConfigurationInstance().SipDefaultAttest; len(a) > 0 {
+		r["attest"] = a
+	}
+	if o := req.Header("P-Origination-ID"); len(o) > 0 {
+		r["origid"] = o
+	} else if o = configuration.ConfigurationInstance().SipDefaultOrigID; len(o) > 0 && (origIDRegistry == nil || origin == nil || len(origin.Customer) == 0) {
+		r["origid"] = o
+	}
+	identity, _, httpCode, errCode, err := signInviteMessage(response, req, r, origin, traceID, clientIP, client, start)
+	if err != nil {
+		return sipErrorResponse(start, response, req, lg, traceID, sipStatus(httpCode), errCode, err.Error())
+	}
+	// the call is redirected to the original Request-URI, with Identity added
+	contact := req.RequestURI
+	if strings.Contains(contact, "?") {
+		contact += "&"
+	} else {
+		contact += "?"
+	}
+	contact += "Identity=" + sip.EscapeURIHeader(identity)
+	resp := sip.NewResponse(req, 302, sipReasonPhrases[302])
+	resp.AddHeader("Contact", "<" + contact + ">")
+	return serveSipResponse(start, response, req, resp, lg, "info", traceID, "", "")
+}
+
+// sipVerificationHandler - STI-VS redirect server. The Identity header of an
+// INVITE is verified and the result returned in a 302 - verstat in
+// P-Asserted-Identity (RFC 8588), attestation in P-Attestation-Indicator and
+// origid in P-Origination-ID
+func sipVerificationHandler(response http.ResponseWriter, req *sip.Message, transport string, remote net.Addr) *sip.Message {
+	start := time.Now()
+	switch req.Method {
+	case "ACK":
+		// ACK for a final non-2xx response - nothing to do
+		return nil
+	case "OPTIONS":
+		// health check
+		resp := sip.NewResponse(req, 200, sipReasonPhrases[200])
+		resp.AddHeader("Allow", "INVITE, ACK, OPTIONS")
+		return resp
+	case "INVITE":
+	default:
+		resp := sip.NewResponse(req, 405, sipReasonPhrases[405])
+		resp.AddHeader("Allow", "INVITE, ACK, OPTIONS")
+		return resp
+	}
+	clientIP := sipRemoteIP(remote)
+	client := sipRequestClient(req, clientIP)
+	traceID := sipTraceID(req)
+	stats.IncrVerificationRequestCount()
+	lg := kitlog.With(glogger, "type", "sipRequest", "clientIP", clientIP, "client", client, "transport", transport, "module", "sipVerificationHandler")
+	// every terminal outcome is recorded
+	decision := audit.Entry{TraceID: traceID, Client: client, Result: "failed"}
+	failed := func(reasonCode string) {
+		decision.ReasonCode = reasonCode
+		recordDecision(response, "verification", start, decision)
+	}
+	origTN, err := origTNFromInvite(req)
+	if err != nil {
+		failed("VESPER-4180")
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus("VESPER-4180", http.StatusBadRequest), "VESPER-4180", err.Error())
+	}
+	destTN, err := destTNFromInvite(req)
+	if err != nil {
+		failed("VESPER-4181")
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus("VESPER-4181", http.StatusBadRequest), "VESPER-4181", err.Error())
+	}
+	iat, err := iatFromInvite(req, start)
+	if err != nil {
+		failed("VESPER-4182")
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus("VESPER-4182", http.StatusBadRequest), "VESPER-4182", err.Error())
+	}
+	if errCode, err := validateNumbering(origTN, []string{destTN}, verificationOrigNumbering, verificationDestNumbering); err != nil {
+		failed(errCode)
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus(errCode, http.StatusBadRequest), errCode, err.Error())
+	}
+	decision.Orig, decision.Dest, decision.Iat = origTN, []string{destTN}, iat
+	resp := sip.NewResponse(req, 302, sipReasonPhrases[302])
+	resp.AddHeader("Contact", "<" + req.RequestURI + ">")
+	// the asserted identity returned is the one the orig TN was taken from
+	pai := sip.URI(req.Header("P-Asserted-Identity"))
+	if _, err := sip.TelephoneNumber(pai); err != nil {
+		pai = sip.URI(req.Header("From"))
+	}
+	identities := req.Headers("Identity")
+	if len(identities) == 0 {
+		// nothing to verify - the call is not failed, it is just not validated
+		decision.Result, decision.ReasonCode = "unverified", "VESPER-4183"
+		recordDecision(response, "verification", start, decision)
+		resp.AddHeader("P-Asserted-Identity", "<" + sip.AddUserParameter(pai, "verstat=No-TN-Validation") + ">")
+		return serveSipResponse(start, response, req, resp, lg, "info", traceID, "", "")
+	}
+	pp, errCode, err := validateIdentity(identities[0], origTN, []string{destTN}, iat, start.Unix(), traceID, clientIP)
+	if err != nil {
+		failed(errCode)
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus(errCode, http.StatusBadRequest), errCode, err.Error())
+	}
+	errCode, httpCode, err := verifySignature(pp.x5u, pp.token, configuration.ConfigurationInstance().VerifyRootCA)
+	if err != nil {
+		failed(errCode)
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus(errCode, httpCode), errCode, err.Error())
+	}
+	// the claims are attributed to the signer only once the signature is verified
+	decision.Attest, _ = pp.claims["attest"].(string)
+	decision.OrigID, _ = pp.claims["origid"].(string)
+	decision.X5u = pp.x5u
+	fail, errCode, err := dnoVerification(origTN)
+	if fail {
+		failed(errCode)
+		return sipErrorResponse(start, response, req, lg, traceID, sipVerificationStatus(errCode, http.StatusForbidden), errCode, err.Error())
+	}
+	if err != nil {
+		// the call is verified, but flagged
+		logInfo("type", "sipVerification", "traceID", traceID, "clientIP", clientIP, "reasonCode", errCode, "message", err.Error())
+		resp.AddHeader("P-DNO", fmt.Sprintf("%s;text=\"%s\"", errCode, strings.Replace(err.Error(), "\"", "'", -1)))
+	}
+	// the post-verify hook is called, if configured - its response is not carried
+	// in SIP, but a failed hook fails verification, per its policy
+	if errCode, err := applyPostVerifyHook(traceID, client, make(map[string]interface{}), origTN, []string{destTN}, iat, decision.Attest, decision.OrigID, pp.x5u); err != nil {
+		failed(errCode)
+		return sipErrorResponse(start, response, req, lg, traceID, sipStatus(http.StatusServiceUnavailable), errCode, err.Error())
+	}
+	// cache claims in identity header to validate replay attacks in future
+	replayAttackCache.Add(pp.iat, pp.claimsString)
+	decision.Result = "verified"
+	decision.ReasonCode = errCode
+	recordDecision(response, "verification", start, decision)
+	resp.AddHeader("P-Asserted-Identity", "<" + sip.AddUserParameter(pai, "verstat=TN-Validation-Passed") + ">")
+	resp.AddHeader("P-Attestation-Indicator", fmt.Sprintf("%v", pp.claims["attest"]))
+	resp.AddHeader("P-Origination-ID", fmt.Sprintf("%v", pp.claims["origid"]))
+	return serveSipResponse(start, response, req, resp, lg, "info", traceID, "", "")
+}
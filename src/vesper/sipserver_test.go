@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"time"
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"vesper/replayattack"
+)
+
+func TestSipVerificationStatus(t *testing.T) {
+	for _, tc := range []struct {
+		reasonCode	string
+		httpCode		int
+		want				int
+	}{
+		{"VESPER-4156", http.StatusBadRequest, 436},		// x5u cannot be fetched
+		{"VESPER-4159", http.StatusBadRequest, 436},
+		{"VESPER-4160", http.StatusBadRequest, 437},		// certificate not valid
+		{"VESPER-4165", http.StatusBadRequest, 437},
+		{"VESPER-4180", http.StatusBadRequest, 400},		// orig TN cannot be derived
+		{"VESPER-4154", http.StatusBadRequest, 438},
+		{"VESPER-4166", http.StatusUnauthorized, 438},		// signature does not verify
+		{"VESPER-4211", http.StatusForbidden, 403},
+		{"VESPER-5601", http.StatusInternalServerError, 500},
+		{"VESPER-5300", http.StatusServiceUnavailable, 503},
+	} {
+		if got := sipVerificationStatus(tc.reasonCode, tc.httpCode); got != tc.want {
+			t.Errorf("sipVerificationStatus(%v, %v) = %v - want %v", tc.reasonCode, tc.httpCode, got, tc.want)
+		}
+	}
+}
+
+func TestSipVerificationVerstat(t *testing.T) {
+	replayAttackCache = replayattack.InitObject()
+	s := newTestSigner(t, "https://cert.example.com/sip.pem")
+	now := time.Now()
+	date := "Date: " + now.UTC().Format(http.TimeFormat)
+	orig, dest := "12155551212", []string{"12155551213"}
+	pai := "P-Asserted-Identity: <sip:+12155551212@example.com;user=phone>"
+	from := "From: <sip:+12155551212@example.com>;tag=1928301774"
+	to := "To: <sip:+12155551213@example.com>"
+	claims := map[string]interface{}{"attest": "B", "origid": "de305d54-75b4-431b-adb2-eb6b9e546014"}
+	identity := s.sign(t, "shaken", testClaims(orig, dest, now.Unix(), claims)) + ";ppt=shaken"
+	// the public key of an x5u that cannot be fetched is not cached
+	unfetched := testSigner{x5u: "http://127.0.0.1:1/sip.pem", key: s.key}
+	unfetchedIdentity := unfetched.sign(t, "shaken", testClaims(orig, dest, now.Unix(), map[string]interface{}{"attest": "B", "origid": "unfetched"})) + ";ppt=shaken"
+	uri := "sip:+12155551213@example.com;user=phone"
+	for _, tc := range []struct {
+		name		string
+		uri			string
+		headers	[]string
+		status	int
+		verstat	string
+		attest	string
+	}{
+		{"no Identity", uri, []string{pai, from, to, date}, 302, "verstat=No-TN-Validation", ""},
+		{"verified", uri, []string{pai, from, to, date, "Identity: " + identity}, 302, "verstat=TN-Validation-Passed", "B"},
+		{"repeated Identity", uri, []string{pai, from, to, date, "Identity: " + identity}, 438, "", ""},
+		{"dest does not match", "sip:bob@example.com", []string{pai, from, "To: <tel:+12155551299>", date, "Identity: " + identity}, 438, "", ""},
+		{"x5u cannot be fetched", uri, []string{pai, from, to, date, "Identity: " + unfetchedIdentity}, 436, "", ""},
+		{"no orig TN", uri, []string{"From: <sip:alice@example.com>;tag=1928301774", to, date}, 400, "", ""},
+	} {
+		resp := sipVerificationHandler(httptest.NewRecorder(), testInvite(t, tc.uri, tc.headers...), "udp", &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5060})
+		if resp.StatusCode != tc.status {
+			t.Errorf("%v: status = %v (%v) - want %v", tc.name, resp.StatusCode, resp.Header("Reason"), tc.status)
+			continue
+		}
+		p := resp.Header("P-Asserted-Identity")
+		if len(tc.verstat) > 0 && (!strings.Contains(p, tc.verstat) || !strings.Contains(p, "+12155551212")) {
+			t.Errorf("%v: P-Asserted-Identity = %v - want %v", tc.name, p, tc.verstat)
+		}
+		if len(tc.verstat) == 0 && len(p) > 0 {
+			t.Errorf("%v: P-Asserted-Identity = %v - want none", tc.name, p)
+		}
+		if a := resp.Header("P-Attestation-Indicator"); a != tc.attest {
+			t.Errorf("%v: P-Attestation-Indicator = %v - want %v", tc.name, a, tc.attest)
+		}
+	}
+}
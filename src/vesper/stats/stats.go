@@ -18,6 +18,7 @@ var (
 	processingTimeMoreThan1000ms int64
 	signingRequests int64
 	verificationRequests int64
+	aclDeniedRequests int64
 )
 
 type processingTime struct {
@@ -38,7 +39,7 @@ func UpdateApiProcessingTime(t int64) {
 		processingTime51To100ms += 1
 	case t > 100 && t < 151 :
 		processingTime101To150ms += 1
-	case t > 150 && t < 300 :
+	case t > 150 && t < 301 :
 		processingTime151To300ms += 1
 	case t > 300 && t < 601 :
 		processingTime301To600ms += 1
@@ -72,6 +73,13 @@ func IncrVerificationRequestCount() {
 	verificationRequests += 1
 }
 
+// increment number of requests denied by ACLs
+func IncrAclDeniedCount() {
+	mtx.Lock()
+	defer mtx.Unlock()
+	aclDeniedRequests += 1
+}
+
 // retrieve stats
 func Stats() map[string]interface{} {
 	mtx.RLock()
@@ -80,6 +88,7 @@ func Stats() map[string]interface{} {
 	resp := make(map[string]interface{})
 	resp["signingRequests"] = signingRequests
 	resp["verificationRequests"] = verificationRequests
+	resp["aclDeniedRequests"] = aclDeniedRequests
 	if signingRequests > 0 || verificationRequests > 0 {
 		resp["minApiProcessingTime"] = minApiProcessingTime
 		resp["maxApiProcessingTime"] = maxApiProcessingTime
@@ -87,7 +96,7 @@ func Stats() map[string]interface{} {
 		resp["processingTime (0 - 25ms)"] = &processingTime{processingTime0To25ms, (float64(processingTime0To25ms)/float64(total))*100}
 		resp["processingTime (26 - 50ms)"] = &processingTime{processingTime26To50ms, (float64(processingTime26To50ms)/float64(total))*100}
 		resp["processingTime (51 - 100ms)"] = &processingTime{processingTime51To100ms, (float64(processingTime51To100ms)/float64(total))*100}
-		resp["processingTime (101 - 150ms)"] = &processingTime{processingTime51To100ms, (float64(processingTime51To100ms)/float64(total))*100}
+		resp["processingTime (101 - 150ms)"] = &processingTime{processingTime101To150ms, (float64(processingTime101To150ms)/float64(total))*100}
 		resp["processingTime (151 - 300ms)"] = &processingTime{processingTime151To300ms, (float64(processingTime151To300ms)/float64(total))*100}
 		resp["processingTime (301 - 600ms)"] = &processingTime{processingTime301To600ms, (float64(processingTime301To600ms)/float64(total))*100}
 		resp["processingTime (601 - 1000ms)"] = &processingTime{processingTime601To1000ms, (float64(processingTime601To1000ms)/float64(total))*100}
@@ -112,4 +121,5 @@ func ResetStats() {
 	processingTimeMoreThan1000ms = 0
 	signingRequests = 0
 	verificationRequests = 0
+	aclDeniedRequests = 0
 }
\ No newline at end of file
@@ -0,0 +1,193 @@
+package stats
+
+import (
+	"math"
+	"time"
+	"strconv"
+)
+
+// WindowsVersion - version of the format of windowed stats
+const WindowsVersion = 1
+
+const (
+	slotSeconds = 5
+	slots = 3600 / slotSeconds			// the longest window
+	// latency buckets - upper bounds grow by 10%, from 0.1ms. The last bucket
+	// holds everything longer
+	latencyBase = 0.1
+	latencyGrowth = 1.1
+	latencyBuckets = 150
+)
+
+// windows reported, in seconds
+var windowSeconds = []struct {
+	name	string
+	secs	int64
+}{
+	{"1m", 60},
+	{"5m", 300},
+	{"1h", 3600},
+}
+
+// counts of an endpoint in a slot or a window
+type endpointCounts struct {
+	requests		int64
+	successes		int64
+	errors			map[string]int64
+	latency			[latencyBuckets]uint32
+}
+
+type slot struct {
+	start				int64		// unix time / slotSeconds
+	endpoints		map[string]*endpointCounts
+}
+
+var ring [slots]slot
+
+// Latency - latency percentiles in milliseconds
+type Latency struct {
+	P50	float64	`json:"p50"`
+	P90	float64	`json:"p90"`
+	P99	float64	`json:"p99"`
+}
+
+// EndpointWindow - stats of an endpoint in a window
+type EndpointWindow struct {
+	Requests		int64							`json:"requests"`
+	SuccessRate	float64						`json:"successRate"`		// percentage
+	Latency			Latency						`json:"latency"`
+	Errors			map[string]int64	`json:"errors"`					// by reasonCode, else HTTP status (e.g. "HTTP-404")
+}
+
+// Window - stats of all endpoints in a window
+type Window struct {
+	Seconds			int64											`json:"seconds"`
+	Endpoints		map[string]EndpointWindow	`json:"endpoints"`
+}
+
+// WindowedStats - versioned response of windowed stats
+type WindowedStats struct {
+	Version			int								`json:"version"`
+	GeneratedAt	int64							`json:"generatedAt"`
+	Windows			map[string]Window	`json:"windows"`
+}
+
+// ObserveRequest records a request to endpoint - its HTTP status, reasonCode
+// (empty if none) and latency
+func ObserveRequest(endpoint string, status int, reasonCode string, latency time.Duration) {
+	observeRequest(time.Now(), endpoint, status, reasonCode, latency)
+}
+
+func observeRequest(now time.Time, endpoint string, status int, reasonCode string, latency time.Duration) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	n := now.Unix() / slotSeconds
+	s := &ring[n % slots]
+	if n < s.start {
+		// the slot has moved on (e.g. the clock was set back)
+		return
+	}
+	if s.start != n || s.endpoints == nil {
+		s.start = n
+		s.endpoints = make(map[string]*endpointCounts)
+	}
+	c, ok := s.endpoints[endpoint]
+	if !ok {
+		c = &endpointCounts{errors: make(map[string]int64)}
+		s.endpoints[endpoint] = c
+	}
+	c.requests++
+	if status < 400 {
+		c.successes++
+	} else if len(reasonCode) > 0 {
+		c.errors[reasonCode]++
+	} else {
+		c.errors["HTTP-" + strconv.Itoa(status)]++
+	}
+	c.latency[latencyBucket(latency)]++
+}
+
+// Windows returns the stats of the last minute, 5 minutes and hour, by endpoint.
+// Unlike Stats, they are not reset
+func Windows() WindowedStats {
+	return windows(time.Now())
+}
+
+func windows(now time.Time) WindowedStats {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	n := now.Unix() / slotSeconds
+	resp := WindowedStats{Version: WindowsVersion, GeneratedAt: now.Unix(), Windows: make(map[string]Window)}
+	for _, w := range windowSeconds {
+		merged := make(map[string]*endpointCounts)
+		for i := int64(0); i < w.secs / slotSeconds; i++ {
+			s := &ring[(n - i) % slots]
+			if s.start != n - i {
+				continue
+			}
+			for e, c := range s.endpoints {
+				m, ok := merged[e]
+				if !ok {
+					m = &endpointCounts{errors: make(map[string]int64)}
+					merged[e] = m
+				}
+				m.requests += c.requests
+				m.successes += c.successes
+				for k, v := range c.errors {
+					m.errors[k] += v
+				}
+				for k, v := range c.latency {
+					m.latency[k] += v
+				}
+			}
+		}
+		win := Window{Seconds: w.secs, Endpoints: make(map[string]EndpointWindow)}
+		for e, m := range merged {
+			win.Endpoints[e] = EndpointWindow{
+				Requests: m.requests,
+				SuccessRate: round(float64(m.successes) / float64(m.requests) * 100),
+				Latency: Latency{P50: percentile(&m.latency, m.requests, 50), P90: percentile(&m.latency, m.requests, 90), P99: percentile(&m.latency, m.requests, 99)},
+				Errors: m.errors,
+			}
+		}
+		resp.Windows[w.name] = win
+	}
+	return resp
+}
+
+// latencyBucket returns the bucket of a latency
+func latencyBucket(d time.Duration) int {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms <= latencyBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(ms / latencyBase) / math.Log(latencyGrowth)))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return i
+}
+
+// percentile returns the upper bound (ms) of the bucket of the p-th percentile
+func percentile(h *[latencyBuckets]uint32, total int64, p float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(float64(total) * p / 100))
+	var n int64
+	i := 0
+	for ; i < latencyBuckets; i++ {
+		n += int64(h[i])
+		if n >= rank {
+			break
+		}
+	}
+	if i >= latencyBuckets {
+		i = latencyBuckets - 1
+	}
+	return round(latencyBase * math.Pow(latencyGrowth, float64(i)))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
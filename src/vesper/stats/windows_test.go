@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"time"
+	"testing"
+)
+
+func TestWindows(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	// 10 minutes ago - only in the hour window
+	observeRequest(now.Add(-10*time.Minute), "/stir/v1/signing", 200, "", 100*time.Millisecond)
+	for i := 0; i < 98; i++ {
+		observeRequest(now.Add(-10*time.Second), "/stir/v1/signing", 200, "", 10*time.Millisecond)
+	}
+	observeRequest(now, "/stir/v1/signing", 400, "VESPER-4001", 1*time.Millisecond)
+	observeRequest(now, "/stir/v1/signing", 404, "", 1*time.Millisecond)
+	// older than an hour - dropped
+	observeRequest(now.Add(-2*time.Hour), "/stir/v1/verification", 200, "", time.Millisecond)
+
+	w := windows(now)
+	if w.Version != WindowsVersion {
+		t.Errorf("Version = %v - want %v", w.Version, WindowsVersion)
+	}
+	m := w.Windows["1m"].Endpoints["/stir/v1/signing"]
+	if m.Requests != 100 || m.SuccessRate != 98 {
+		t.Errorf("1m = %+v - want 100 requests, 98%% success", m)
+	}
+	if m.Errors["VESPER-4001"] != 1 || m.Errors["HTTP-404"] != 1 {
+		t.Errorf("1m errors = %v", m.Errors)
+	}
+	if m.Latency.P50 < 10 || m.Latency.P50 > 11 || m.Latency.P99 > 11 {
+		t.Errorf("1m latency = %+v - want p50, p99 about 10ms", m.Latency)
+	}
+	if h := w.Windows["1h"].Endpoints["/stir/v1/signing"]; h.Requests != 101 || h.Latency.P99 < 10 {
+		t.Errorf("1h = %+v - want 101 requests", h)
+	}
+	if _, ok := w.Windows["1h"].Endpoints["/stir/v1/verification"]; ok {
+		t.Errorf("1h - want no requests older than an hour")
+	}
+}
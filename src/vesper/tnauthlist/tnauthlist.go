@@ -0,0 +1,157 @@
+// Package tnauthlist parses the TN Authorization List certificate extension
+// (RFC 8226) of STIR certificates
+//
+//	TNAuthorizationList ::= SEQUENCE SIZE (1..MAX) OF TNEntry
+//	TNEntry ::= CHOICE {
+//	  spc   [0] ServiceProviderCode,
+//	  range [1] TelephoneNumberRange,
+//	  one   [2] TelephoneNumber
+//	}
+//	TelephoneNumberRange ::= SEQUENCE {
+//	  start TelephoneNumber,
+//	  count INTEGER (2..MAX)
+//	}
+//
+// The ASN.1 module uses EXPLICIT tags.
+package tnauthlist
+
+import (
+	"fmt"
+	"strconv"
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// OID - id-pe-TNAuthList
+var OID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 26}
+
+// Range - a block of count telephone numbers, starting at Start
+type Range struct {
+	Start	string	`json:"start"`
+	Count	int64		`json:"count"`
+}
+
+// TNAuthList - the entries of a TN Authorization List
+type TNAuthList struct {
+	SPCs		[]string	`json:"spc,omitempty"`
+	Ranges	[]Range		`json:"range,omitempty"`
+	TNs			[]string	`json:"one,omitempty"`
+}
+
+type telephoneNumberRange struct {
+	Start	string	`asn1:"ia5"`
+	Count	int64
+}
+
+// Parse decodes the DER encoded value of a TNAuthList extension
+func Parse(der []byte) (*TNAuthList, error) {
+	var entries []asn1.RawValue
+	rest, err := asn1.Unmarshal(der, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("%v - invalid TNAuthList", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data after TNAuthList")
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("TNAuthList has no entries")
+	}
+	l := &TNAuthList{}
+	for _, e := range entries {
+		if e.Class != asn1.ClassContextSpecific || !e.IsCompound {
+			return nil, fmt.Errorf("TNAuthList entry is not an explicitly tagged TNEntry")
+		}
+		switch e.Tag {
+		case 0:
+			var spc string
+			if _, err := asn1.UnmarshalWithParams(e.Bytes, &spc, "ia5"); err != nil {
+				return nil, fmt.Errorf("%v - invalid spc in TNAuthList", err)
+			}
+			l.SPCs = append(l.SPCs, spc)
+		case 1:
+			var r telephoneNumberRange
+			if _, err := asn1.Unmarshal(e.Bytes, &r); err != nil {
+				return nil, fmt.Errorf("%v - invalid range in TNAuthList", err)
+			}
+			if !validTN(r.Start) || r.Count < 2 {
+				return nil, fmt.Errorf("invalid range (start %v, count %v) in TNAuthList", r.Start, r.Count)
+			}
+			l.Ranges = append(l.Ranges, Range{Start: r.Start, Count: r.Count})
+		case 2:
+			var tn string
+			if _, err := asn1.UnmarshalWithParams(e.Bytes, &tn, "ia5"); err != nil {
+				return nil, fmt.Errorf("%v - invalid one in TNAuthList", err)
+			}
+			if !validTN(tn) {
+				return nil, fmt.Errorf("invalid telephone number %v in TNAuthList", tn)
+			}
+			l.TNs = append(l.TNs, tn)
+		default:
+			return nil, fmt.Errorf("unknown TNEntry tag [%v] in TNAuthList", e.Tag)
+		}
+	}
+	return l, nil
+}
+
+// FromCertificate returns the TNAuthList in a certificate
+func FromCertificate(c *x509.Certificate) (*TNAuthList, error) {
+	for _, e := range c.Extensions {
+		if e.Id.Equal(OID) {
+			return Parse(e.Value)
+		}
+	}
+	return nil, fmt.Errorf("certificate has no TNAuthList extension")
+}
+
+// Scope returns the number of telephone numbers in the narrowest entry that
+// covers tn, or 0 if no entry covers tn. spc entries do not cover any
+// telephone number
+func (l *TNAuthList) Scope(tn string) int64 {
+	var s int64
+	for _, v := range l.TNs {
+		if v == tn {
+			return 1
+		}
+	}
+	for _, r := range l.Ranges {
+		if inRange(tn, r) && (s == 0 || r.Count < s) {
+			s = r.Count
+		}
+	}
+	return s
+}
+
+// Covers returns true if tn is one of the telephone numbers in the list
+func (l *TNAuthList) Covers(tn string) bool {
+	return l.Scope(tn) > 0
+}
+
+// inRange - tn must have the same number of digits as the start of the range
+func inRange(tn string, r Range) bool {
+	if len(tn) != len(r.Start) {
+		return false
+	}
+	n, err := strconv.ParseUint(tn, 10, 64)
+	if err != nil {
+		return false
+	}
+	s, err := strconv.ParseUint(r.Start, 10, 64)
+	if err != nil {
+		return false
+	}
+	return n >= s && n - s < uint64(r.Count)
+}
+
+// validTN - TelephoneNumber is 1 to 15 characters from "0123456789#*". "#" and
+// "*" never match the orig TN of a PASSporT
+func validTN(tn string) bool {
+	if len(tn) == 0 || len(tn) > 15 {
+		return false
+	}
+	for i := 0; i < len(tn); i++ {
+		if (tn[i] < '0' || tn[i] > '9') && tn[i] != '#' && tn[i] != '*' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package tnauthlist
+
+import (
+	"testing"
+	"encoding/asn1"
+)
+
+func explicit(t *testing.T, tag int, v interface{}, params string) asn1.RawValue {
+	b, err := asn1.MarshalWithParams(v, params)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b}
+}
+
+func TestParse(t *testing.T) {
+	entries := []asn1.RawValue{
+		explicit(t, 0, "1234", "ia5"),
+		explicit(t, 1, telephoneNumberRange{Start: "12155551000", Count: 100}, ""),
+		explicit(t, 2, "12155559999", "ia5"),
+	}
+	der, err := asn1.Marshal(entries)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l, err := Parse(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(l.SPCs) != 1 || l.SPCs[0] != "1234" {
+		t.Errorf("unexpected spc %v", l.SPCs)
+	}
+	if len(l.Ranges) != 1 || l.Ranges[0].Start != "12155551000" || l.Ranges[0].Count != 100 {
+		t.Errorf("unexpected range %v", l.Ranges)
+	}
+	if len(l.TNs) != 1 || l.TNs[0] != "12155559999" {
+		t.Errorf("unexpected one %v", l.TNs)
+	}
+	if _, err := Parse([]byte{0x30, 0x00}); err == nil {
+		t.Errorf("empty TNAuthList accepted")
+	}
+	bad, _ := asn1.Marshal([]asn1.RawValue{explicit(t, 3, "1234", "ia5")})
+	if _, err := Parse(bad); err == nil {
+		t.Errorf("unknown TNEntry accepted")
+	}
+}
+
+func TestScope(t *testing.T) {
+	l := &TNAuthList{
+		SPCs: []string{"1234"},
+		Ranges: []Range{{Start: "12155551000", Count: 1000}, {Start: "12155551200", Count: 10}},
+		TNs: []string{"12155559999"},
+	}
+	tests := map[string]int64{
+		"12155559999": 1,
+		"12155551000": 1000,
+		"12155551999": 1000,
+		"12155551205": 10,
+		"12155552000": 0,
+		"2155551205": 0,
+		"1234": 0,
+	}
+	for tn, s := range tests {
+		if v := l.Scope(tn); v != s {
+			t.Errorf("%v - got scope %v, expected %v", tn, v, s)
+		}
+	}
+	if !l.Covers("12155551001") || l.Covers("12155550999") {
+		t.Errorf("unexpected coverage")
+	}
+}
@@ -0,0 +1,84 @@
+package tninventory
+
+import (
+	"io"
+	"fmt"
+	"strings"
+	"strconv"
+	"encoding/csv"
+	"encoding/json"
+)
+
+// ParseCSV parses entries in CSV form, one entry per record
+//
+//	customer,tn,12155551212
+//	customer,prefix,1215556
+//	customer,range,12155570000,500
+//
+// A first record starting with "customer" is a header and is skipped
+func ParseCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var entries []Entry
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(rec[0]), "customer") {
+			continue
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %v - expected customer,type,value[,count]", line)
+		}
+		e := Entry{Customer: strings.TrimSpace(rec[0])}
+		v := strings.TrimSpace(rec[2])
+		switch t := strings.ToLower(strings.TrimSpace(rec[1])); t {
+		case "tn":
+			e.TN = v
+		case "prefix":
+			e.Prefix = v
+		case "range":
+			if len(rec) < 4 {
+				return nil, fmt.Errorf("line %v - count missing for range", line)
+			}
+			c, err := strconv.ParseInt(strings.TrimSpace(rec[3]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v - %v - invalid count", line, err)
+			}
+			e.Start, e.Count = v, c
+		default:
+			return nil, fmt.Errorf("line %v - unknown type %v (tn, prefix or range)", line, t)
+		}
+		if err := Validate(e); err != nil {
+			return nil, fmt.Errorf("line %v - %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ParseJSON parses entries in JSON form - an array of entries, or an object
+// with the array in "tns"
+func ParseJSON(b []byte) ([]Entry, error) {
+	var entries []Entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		var o struct {
+			TNs []Entry `json:"tns"`
+		}
+		if err2 := json.Unmarshal(b, &o); err2 != nil {
+			return nil, err
+		}
+		entries = o.TNs
+	}
+	for i, e := range entries {
+		if err := Validate(e); err != nil {
+			return nil, fmt.Errorf("entry %v - %v", i + 1, err)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,446 @@
+// Package tninventory maps TNs and TN blocks to the customers they are assigned
+// to.
+//
+// An entry is a single TN, a prefix (all TNs starting with it) or a range of
+// count TNs starting at start. Entries are held in a digit trie - ranges are
+// decomposed into the smallest set of prefixes covering them - so that the
+// entry a TN belongs to is found by longest-prefix match in time proportional
+// to the number of digits in the TN. An entry may be nested in a larger one
+// (e.g. a TN in a block assigned to a reseller) - the most specific entry wins.
+// Entries that take the same TN or prefix overlap and are refused.
+//
+// The inventory can optionally be persisted to a file.
+//
+// This data structure is thread safe.
+package tninventory
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"strings"
+	"strconv"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+)
+
+// Entry - TNs assigned to a customer. Exactly one of TN, Prefix and Start (with
+// Count) is set
+type Entry struct {
+	ID				string	`json:"id"`
+	Customer	string	`json:"customer"`
+	TN				string	`json:"tn,omitempty"`
+	Prefix		string	`json:"prefix,omitempty"`
+	Start			string	`json:"start,omitempty"`
+	Count			int64		`json:"count,omitempty"`
+}
+
+// node - trie node. prefix is the entry all TNs below the node belong to, exact
+// the entry the TN ending at the node belongs to
+type node struct {
+	children	[10]*node
+	prefix		string
+	exact			string
+}
+
+// slot - a trie node slot taken by an entry
+type slot struct {
+	digits	string
+	exact		bool
+}
+
+// Inventory - TN inventory
+type Inventory struct {
+	sync.RWMutex	// A field declared with a type but no explicit field name is an
+					// anonymous field, also called an embedded field or an embedding of
+					// the type in the structembedded. see http://golang.org/ref/spec#Struct_types
+	file		string
+	entries	map[string]Entry
+	root		*node
+}
+
+// Initialize object
+// If f is not empty, entries persisted in f are loaded
+func InitObject(f string) (*Inventory, error) {
+	inv := &Inventory{file: strings.TrimSpace(f), entries: make(map[string]Entry), root: &node{}}
+	if len(inv.file) == 0 {
+		return inv, nil
+	}
+	b, err := ioutil.ReadFile(inv.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return inv, nil
+		}
+		return nil, fmt.Errorf("%v - TN inventory file", err)
+	}
+	if len(b) == 0 {
+		return inv, nil
+	}
+	var entries []Entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%v - decode JSON object in TN inventory file", err)
+	}
+	for _, e := range entries {
+		if err := inv.add(e); err != nil {
+			return nil, fmt.Errorf("%v - TN inventory file", err)
+		}
+	}
+	return inv, nil
+}
+
+// Validate checks an entry
+func Validate(e Entry) error {
+	if len(strings.TrimSpace(e.Customer)) == 0 {
+		return fmt.Errorf("customer MUST be a non-empty string")
+	}
+	n := 0
+	if len(e.TN) > 0 {
+		n++
+		if !digits(e.TN) {
+			return fmt.Errorf("tn %v MUST be digits only", e.TN)
+		}
+	}
+	if len(e.Prefix) > 0 {
+		n++
+		if !digits(e.Prefix) {
+			return fmt.Errorf("prefix %v MUST be digits only", e.Prefix)
+		}
+	}
+	if len(e.Start) > 0 || e.Count != 0 {
+		n++
+		if !digits(e.Start) || len(e.Start) > 18 {
+			return fmt.Errorf("start %v MUST be 1 to 18 digits", e.Start)
+		}
+		if e.Count < 1 {
+			return fmt.Errorf("count %v MUST be > 0", e.Count)
+		}
+		s, _ := strconv.ParseUint(e.Start, 10, 64)
+		if s + uint64(e.Count) - 1 > pow10(len(e.Start)) - 1 {
+			return fmt.Errorf("range (start %v, count %v) exceeds %v digits", e.Start, e.Count, len(e.Start))
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("exactly one of tn, prefix and start/count MUST be present")
+	}
+	return nil
+}
+
+// Add adds an entry. An ID is assigned if the entry has none. Nothing is
+// changed if the inventory cannot be persisted
+func (inv *Inventory) Add(e Entry) (Entry, error) {
+	if len(e.ID) == 0 {
+		e.ID = uuid.NewV4().String()
+	}
+	inv.Lock()
+	defer inv.Unlock()
+	if _, ok := inv.entries[e.ID]; ok {
+		return e, fmt.Errorf("entry %v already exists", e.ID)
+	}
+	if err := inv.add(e); err != nil {
+		return e, err
+	}
+	if err := inv.save(); err != nil {
+		inv.remove(e)
+		return e, err
+	}
+	return e, nil
+}
+
+// Update replaces the entry with ID id. Nothing is changed if the inventory
+// cannot be persisted
+func (inv *Inventory) Update(id string, e Entry) (Entry, error) {
+	e.ID = id
+	inv.Lock()
+	defer inv.Unlock()
+	old, ok := inv.entries[id]
+	if !ok {
+		return e, ErrNotFound
+	}
+	if err := Validate(e); err != nil {
+		return e, err
+	}
+	inv.remove(old)
+	if err := inv.add(e); err != nil {
+		// restore the entry being replaced
+		inv.add(old)
+		return e, err
+	}
+	if err := inv.save(); err != nil {
+		inv.remove(e)
+		inv.add(old)
+		return e, err
+	}
+	return e, nil
+}
+
+// Delete removes the entry with ID id. Nothing is changed if the inventory
+// cannot be persisted
+func (inv *Inventory) Delete(id string) error {
+	inv.Lock()
+	defer inv.Unlock()
+	e, ok := inv.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	inv.remove(e)
+	if err := inv.save(); err != nil {
+		inv.add(e)
+		return err
+	}
+	return nil
+}
+
+// Get returns the entry with ID id
+func (inv *Inventory) Get(id string) (Entry, bool) {
+	inv.RLock()
+	defer inv.RUnlock()
+	e, ok := inv.entries[id]
+	return e, ok
+}
+
+// List returns all entries, or the entries of a customer, ordered by ID
+func (inv *Inventory) List(customer string) []Entry {
+	inv.RLock()
+	defer inv.RUnlock()
+	l := make([]Entry, 0, len(inv.entries))
+	for _, e := range inv.entries {
+		if len(customer) == 0 || e.Customer == customer {
+			l = append(l, e)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
+
+// Size returns the number of entries
+func (inv *Inventory) Size() int {
+	inv.RLock()
+	defer inv.RUnlock()
+	return len(inv.entries)
+}
+
+// Lookup returns the most specific entry tn belongs to
+func (inv *Inventory) Lookup(tn string) (Entry, bool) {
+	inv.RLock()
+	defer inv.RUnlock()
+	var id string
+	n := inv.root
+	for i := 0; i < len(tn); i++ {
+		c := tn[i]
+		if c < '0' || c > '9' {
+			return Entry{}, false
+		}
+		if n = n.children[c-'0']; n == nil {
+			break
+		}
+		if len(n.prefix) > 0 {
+			id = n.prefix
+		}
+		if i == len(tn) - 1 && len(n.exact) > 0 {
+			id = n.exact
+		}
+	}
+	if len(id) == 0 {
+		return Entry{}, false
+	}
+	return inv.entries[id], true
+}
+
+// Owner returns true if tn is assigned to customer
+func (inv *Inventory) Owner(customer, tn string) bool {
+	e, ok := inv.Lookup(tn)
+	return ok && e.Customer == customer
+}
+
+// Import adds entries. With replace, all existing entries are removed first.
+// Nothing is changed if any entry cannot be added, or if the inventory cannot be
+// persisted
+func (inv *Inventory) Import(entries []Entry, replace bool) (int, error) {
+	inv.Lock()
+	defer inv.Unlock()
+	oldEntries, oldRoot := inv.entries, inv.root
+	if replace {
+		inv.entries, inv.root = make(map[string]Entry), &node{}
+	} else {
+		// work on a copy, so that a failed import changes nothing
+		inv.entries, inv.root = make(map[string]Entry), &node{}
+		for _, e := range oldEntries {
+			inv.add(e)
+		}
+	}
+	for i, e := range entries {
+		if len(e.ID) == 0 {
+			e.ID = uuid.NewV4().String()
+		}
+		if err := inv.add(e); err != nil {
+			inv.entries, inv.root = oldEntries, oldRoot
+			return 0, fmt.Errorf("entry %v - %v", i + 1, err)
+		}
+	}
+	if err := inv.save(); err != nil {
+		inv.entries, inv.root = oldEntries, oldRoot
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// ErrNotFound - no entry with the ID
+var ErrNotFound = fmt.Errorf("entry not found")
+
+// add - caller holds the lock
+func (inv *Inventory) add(e Entry) error {
+	if err := Validate(e); err != nil {
+		return err
+	}
+	if _, ok := inv.entries[e.ID]; ok {
+		return fmt.Errorf("entry %v already exists", e.ID)
+	}
+	slots := slotsOf(e)
+	for _, s := range slots {
+		n := inv.node(s.digits, false)
+		if n == nil {
+			continue
+		}
+		if s.exact && len(n.exact) > 0 {
+			return fmt.Errorf("tn %v overlaps entry %v", s.digits, n.exact)
+		}
+		if !s.exact && len(n.prefix) > 0 {
+			return fmt.Errorf("prefix %v overlaps entry %v", s.digits, n.prefix)
+		}
+	}
+	for _, s := range slots {
+		n := inv.node(s.digits, true)
+		if s.exact {
+			n.exact = e.ID
+		} else {
+			n.prefix = e.ID
+		}
+	}
+	inv.entries[e.ID] = e
+	return nil
+}
+
+// remove - caller holds the lock. Emptied nodes are left in place
+func (inv *Inventory) remove(e Entry) {
+	for _, s := range slotsOf(e) {
+		if n := inv.node(s.digits, false); n != nil {
+			if s.exact && n.exact == e.ID {
+				n.exact = ""
+			}
+			if !s.exact && n.prefix == e.ID {
+				n.prefix = ""
+			}
+		}
+	}
+	delete(inv.entries, e.ID)
+}
+
+// node returns the trie node of digits, optionally creating it
+func (inv *Inventory) node(digits string, create bool) *node {
+	n := inv.root
+	for i := 0; i < len(digits); i++ {
+		c := digits[i] - '0'
+		if n.children[c] == nil {
+			if !create {
+				return nil
+			}
+			n.children[c] = &node{}
+		}
+		n = n.children[c]
+	}
+	return n
+}
+
+// save persists all entries - caller holds the lock. The file is replaced atomically
+func (inv *Inventory) save() error {
+	if len(inv.file) == 0 {
+		return nil
+	}
+	l := make([]Entry, 0, len(inv.entries))
+	for _, e := range inv.entries {
+		l = append(l, e)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(inv.file), filepath.Base(inv.file))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), inv.file)
+}
+
+// slotsOf returns the trie slots of an entry
+func slotsOf(e Entry) []slot {
+	switch {
+	case len(e.TN) > 0:
+		return []slot{{digits: e.TN, exact: true}}
+	case len(e.Prefix) > 0:
+		return []slot{{digits: e.Prefix}}
+	}
+	return decompose(e.Start, e.Count)
+}
+
+// decompose returns the smallest set of slots covering count TNs starting at
+// start. e.g. start 12155551995, count 110 is 12155551995 - 12155551999 (exact),
+// 1215555200 - 1215555209 (prefix) and 12155552100 - 12155552104 (exact)
+func decompose(start string, count int64) []slot {
+	l := len(start)
+	lo, _ := strconv.ParseUint(start, 10, 64)
+	hi := lo + uint64(count) - 1
+	var slots []slot
+	for lo <= hi {
+		// largest block of 10^k TNs aligned at lo that fits. A block is never all
+		// TNs of l digits - the prefix would be empty
+		k := 0
+		for k + 1 < l {
+			b := pow10(k + 1)
+			if lo % b != 0 || lo + b - 1 > hi {
+				break
+			}
+			k++
+		}
+		d := fmt.Sprintf("%0*d", l, lo)
+		slots = append(slots, slot{digits: d[:l-k], exact: k == 0})
+		lo += pow10(k)
+		if lo == 0 {
+			// overflow
+			break
+		}
+	}
+	return slots
+}
+
+func pow10(k int) uint64 {
+	p := uint64(1)
+	for i := 0; i < k; i++ {
+		p *= 10
+	}
+	return p
+}
+
+func digits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package tninventory
+
+import (
+	"os"
+	"strings"
+	"strconv"
+	"testing"
+	"path/filepath"
+)
+
+func TestDecompose(t *testing.T) {
+	s := decompose("12155551995", 110)
+	expected := []slot{
+		{"12155551995", true}, {"12155551996", true}, {"12155551997", true}, {"12155551998", true}, {"12155551999", true},
+		{"121555520", false},
+		{"12155552100", true}, {"12155552101", true}, {"12155552102", true}, {"12155552103", true}, {"12155552104", true},
+	}
+	if len(s) != len(expected) {
+		t.Fatalf("got %v, expected %v", s, expected)
+	}
+	for i := range s {
+		if s[i] != expected[i] {
+			t.Errorf("slot %v - got %v, expected %v", i, s[i], expected[i])
+		}
+	}
+	if s := decompose("12155550000", 10000); len(s) != 1 || s[0].digits != "1215555" {
+		t.Errorf("unexpected slots %v", s)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	inv, _ := InitObject("")
+	for _, e := range []Entry{
+		{ID: "block", Customer: "acme", Prefix: "1215555"},
+		{ID: "range", Customer: "resold", Start: "12155551000", Count: 200},
+		{ID: "one", Customer: "bob", TN: "12155551100"},
+	} {
+		if _, err := inv.Add(e); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	tests := map[string]string{
+		"12155550001": "block",
+		"12155551000": "range",
+		"12155551199": "range",
+		"12155551100": "one",
+		"12155551200": "block",
+		"12165550000": "",
+	}
+	for tn, id := range tests {
+		e, ok := inv.Lookup(tn)
+		if e.ID != id || ok != (id != "") {
+			t.Errorf("%v - got %v, expected %v", tn, e.ID, id)
+		}
+	}
+	if !inv.Owner("bob", "12155551100") || inv.Owner("acme", "12155551100") {
+		t.Errorf("unexpected owner")
+	}
+	if _, err := inv.Add(Entry{Customer: "x", Start: "12155551099", Count: 2}); err == nil {
+		t.Errorf("overlapping entry accepted")
+	}
+	if err := inv.Delete("one"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if e, _ := inv.Lookup("12155551100"); e.ID != "range" {
+		t.Errorf("got %v after delete, expected range", e.ID)
+	}
+	if _, err := inv.Import([]Entry{{Customer: "x", TN: "19995550000"}, {Customer: "y", Prefix: "1215555"}}, false); err == nil {
+		t.Errorf("overlapping import accepted")
+	}
+	if inv.Size() != 2 {
+		t.Errorf("failed import changed the inventory - %v entries", inv.Size())
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	entries, err := ParseCSV(strings.NewReader("customer,type,value,count\nacme,tn,12155551212\nacme,prefix,1215556\nacme,range,12155570000,500\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(entries) != 3 || entries[2].Start != "12155570000" || entries[2].Count != 500 {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	if _, err := ParseCSV(strings.NewReader("acme,block,1215\n")); err == nil {
+		t.Errorf("unknown type accepted")
+	}
+}
+
+func TestSaveFailure(t *testing.T) {
+	inv, _ := InitObject("")
+	inv.Add(Entry{ID: "block", Customer: "acme", Prefix: "1215555"})
+	// the directory of the file does not exist - every save fails
+	inv.file = filepath.Join(os.TempDir(), "vesper-missing-" + strconv.Itoa(os.Getpid()), "tns.json")
+	if _, err := inv.Add(Entry{ID: "one", Customer: "bob", TN: "12155551100"}); err == nil {
+		t.Errorf("Add() - want error")
+	}
+	if _, err := inv.Update("block", Entry{Customer: "acme", Prefix: "1216666"}); err == nil {
+		t.Errorf("Update() - want error")
+	}
+	if err := inv.Delete("block"); err == nil {
+		t.Errorf("Delete() - want error")
+	}
+	if _, err := inv.Import([]Entry{{Customer: "x", TN: "19995550000"}}, true); err == nil {
+		t.Errorf("Import() - want error")
+	}
+	if e, ok := inv.Lookup("12155551100"); !ok || e.ID != "block" || inv.Size() != 1 {
+		t.Errorf("Lookup() = %v, Size() = %v - want inventory unchanged", e.ID, inv.Size())
+	}
+	if _, ok := inv.Lookup("12166660000"); ok {
+		t.Errorf("failed update changed the inventory")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"io"
+	"fmt"
+	"time"
+	"bytes"
+	"strings"
+	"net/http"
+	"io/ioutil"
+	"encoding/json"
+	"github.com/httprouter"
+	"github.com/satori/go.uuid"
+	"vesper/configuration"
+	"vesper/tninventory"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// adminRequest - common start of admin API requests. Returns false if the
+// request has been answered (not authorized)
+func adminRequest(response http.ResponseWriter, request *http.Request, module string) (time.Time, string, kitlog.Logger, bool) {
+	start := time.Now()
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	response.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(request)
+	client := clientIdentity(request)
+	traceID := request.Header.Get("Trace-Id")
+	if traceID == "" {
+		traceID = "VESPER-" + uuid.NewV1().String()
+	}
+	response.Header().Set("Trace-Id", traceID)
+	lg := kitlog.With(glogger, "type", "admin", "clientIP", clientIP, "client", client, "module", module)
+	if !bearerAuthorized(request, configuration.ConfigurationInstance().AdminTokens) {
+		serveHttpResponse(start, response, lg, http.StatusUnauthorized, "error", traceID, "VESPER-4501", "not authorized to use admin APIs", nil)
+		return start, traceID, lg, false
+	}
+	return start, traceID, lg, true
+}
+
+// decodeTnEntry - a TN inventory entry in a request body
+func decodeTnEntry(request *http.Request) (tninventory.Entry, string, error) {
+	var e tninventory.Entry
+	err := json.NewDecoder(request.Body).Decode(&e)
+	switch {
+	case err == io.EOF:
+		return e, "VESPER-4502", fmt.Errorf("empty request body")
+	case err != nil:
+		return e, "VESPER-4503", fmt.Errorf("%v - unable to parse request body", err)
+	}
+	if err := tninventory.Validate(e); err != nil {
+		return e, "VESPER-4504", err
+	}
+	return e, "", nil
+}
+
+// listTns - all TN inventory entries, the entries of a customer (query customer),
+// or the entry a TN belongs to (query tn)
+func listTns(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "listTns")
+	if !ok {
+		return
+	}
+	if tn := request.URL.Query().Get("tn"); len(tn) > 0 {
+		e, ok := tnInventory.Lookup(tn)
+		if !ok {
+			serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4505", "TN is not in TN inventory", nil)
+			return
+		}
+		serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", e)
+		return
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{"tns": tnInventory.List(request.URL.Query().Get("customer"))})
+}
+
+// getTn - a TN inventory entry
+func getTn(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "getTn")
+	if !ok {
+		return
+	}
+	e, ok := tnInventory.Get(ps.ByName("id"))
+	if !ok {
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4505", "TN inventory entry not found", nil)
+		return
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", e)
+}
+
+// createTn - adds a TN inventory entry
+func createTn(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "createTn")
+	if !ok {
+		return
+	}
+	e, errCode, err := decodeTnEntry(request)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	e, err = tnInventory.Add(e)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusConflict, "error", traceID, "VESPER-4506", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "createTn", "entry", e)
+	serveHttpResponse(start, response, lg, http.StatusCreated, "info", traceID, "", "", e)
+}
+
+// updateTn - replaces a TN inventory entry
+func updateTn(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "updateTn")
+	if !ok {
+		return
+	}
+	e, errCode, err := decodeTnEntry(request)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	e, err = tnInventory.Update(ps.ByName("id"), e)
+	switch {
+	case err == tninventory.ErrNotFound:
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4505", "TN inventory entry not found", nil)
+		return
+	case err != nil:
+		serveHttpResponse(start, response, lg, http.StatusConflict, "error", traceID, "VESPER-4506", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "updateTn", "entry", e)
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", e)
+}
+
+// deleteTn - removes a TN inventory entry
+func deleteTn(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "deleteTn")
+	if !ok {
+		return
+	}
+	err := tnInventory.Delete(ps.ByName("id"))
+	switch {
+	case err == tninventory.ErrNotFound:
+		serveHttpResponse(start, response, lg, http.StatusNotFound, "error", traceID, "VESPER-4505", "TN inventory entry not found", nil)
+		return
+	case err != nil:
+		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, "VESPER-5060", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "deleteTn", "id", ps.ByName("id"))
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{})
+}
+
+// importTns - bulk import of TN inventory entries from a CSV (Content-Type
+// text/csv) or JSON file. With query replace=true, the inventory is replaced
+func importTns(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "importTns")
+	if !ok {
+		return
+	}
+	b, err := ioutil.ReadAll(request.Body)
+	if err != nil || len(b) == 0 {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4502", "empty request body", nil)
+		return
+	}
+	var entries []tninventory.Entry
+	if strings.Contains(request.Header.Get("Content-Type"), "csv") {
+		entries, err = tninventory.ParseCSV(bytes.NewReader(b))
+	} else {
+		entries, err = tninventory.ParseJSON(b)
+	}
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4507", err.Error() + " - unable to parse TN inventory file", nil)
+		return
+	}
+	n, err := tnInventory.Import(entries, request.URL.Query().Get("replace") == "true")
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusConflict, "error", traceID, "VESPER-4506", err.Error(), nil)
+		return
+	}
+	logInfo("type", "admin", "traceID", traceID, "module", "importTns", "imported", n, "size", tnInventory.Size())
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{"imported": n, "size": tnInventory.Size()})
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Comcast Cable Communications Management, LLC
+
+package main
+
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"net/http"
+	"github.com/httprouter"
+	"vesper/ledger"
+)
+
+// recordSigning appends a signed PASSporT to the signing ledger, if enabled.
+// A failure to record does not fail signing - it is logged
+func recordSigning(traceID, clientIP string, orderedMap map[string]interface{}, origTN string, iat int64, destTNs []string, origID string, credential Credential, t time.Time) {
+	if signingLedger == nil {
+		return
+	}
+	r := ledger.Record{
+		Time: t.Unix(),
+		TraceID: traceID,
+		OrigID: origID,
+		Orig: origTN,
+		Dest: destTNs,
+		Iat: iat,
+		X5u: credential.X5u,
+		Client: clientIP,
+	}
+	r.Attest, _ = orderedMap["attest"].(string)
+	if err := signingLedger.Append(r); err != nil {
+		logError("type", "signingLedger", "traceID", traceID, "message", fmt.Sprintf("%v - unable to record in signing ledger", err))
+	}
+}
+
+// traceback - signing ledger records for an origid or orig TN, optionally in a
+// time range (query from and to, in seconds)
+func traceback(response http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	start, traceID, lg, ok := adminRequest(response, request, "traceback")
+	if !ok {
+		return
+	}
+	v := request.URL.Query()
+	q := ledger.Query{OrigID: v.Get("origid"), Orig: v.Get("orig")}
+	if len(q.OrigID) == 0 && len(q.Orig) == 0 {
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4601", "query MUST contain origid or orig", nil)
+		return
+	}
+	var err error
+	if s := v.Get("from"); len(s) > 0 {
+		if q.From, err = strconv.ParseInt(s, 10, 64); err != nil || q.From <= 0 {
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4602", "from and to in query MUST be times in seconds, > 0", nil)
+			return
+		}
+	}
+	if s := v.Get("to"); len(s) > 0 {
+		if q.To, err = strconv.ParseInt(s, 10, 64); err != nil || q.To <= 0 || q.To < q.From {
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4602", "from and to in query MUST be times in seconds, > 0, with from <= to", nil)
+			return
+		}
+	}
+	q.Limit = 1000
+	if s := v.Get("limit"); len(s) > 0 {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 1 || q.Limit > 1000 {
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4603", "limit in query MUST be 1 to 1000", nil)
+			return
+		}
+	}
+	records, err := signingLedger.Find(q)
+	if err != nil {
+		serveHttpResponse(start, response, lg, http.StatusInternalServerError, "error", traceID, "VESPER-5601", fmt.Sprintf("%v - unable to read signing ledger", err), nil)
+		return
+	}
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", map[string]interface{}{"records": records})
+}
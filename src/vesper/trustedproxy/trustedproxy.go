@@ -0,0 +1,139 @@
+// Package trustedproxy resolves the IP address of the client of an HTTP
+// request behind trusted proxies.
+//
+// One forwarding header - Forwarded (RFC 7239), X-Forwarded-For or X-Real-Ip,
+// the one the trusted proxies set - is honored, only when the direct peer is a
+// trusted proxy. The other headers are ignored, as a client can send them
+// through the proxies. The chain of addresses is walked right to left,
+// skipping trusted proxies; the first address that is not a trusted proxy is
+// the client.
+package trustedproxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"net/http"
+)
+
+// forwarding headers, by name in configuration
+var headers = map[string]string{"forwarded": "Forwarded", "x-forwarded-for": "X-Forwarded-For", "x-real-ip": "X-Real-Ip"}
+
+// Proxies - trusted proxies
+type Proxies struct {
+	nets		[]*net.IPNet
+	header	string				// canonical name of the forwarding header honored
+}
+
+// Initialize object
+// cidrs are CIDRs (e.g. "10.0.0.0/8") or IP addresses. header is the forwarding
+// header honored - "forwarded", "x-forwarded-for" or "x-real-ip"
+func InitObject(cidrs []string, header string) (*Proxies, error) {
+	h, ok := headers[strings.ToLower(strings.TrimSpace(header))]
+	if !ok {
+		return nil, fmt.Errorf("trusted proxy header %v MUST be \"forwarded\", \"x-forwarded-for\" or \"x-real-ip\"", header)
+	}
+	p := &Proxies{header: h}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %v MUST be a CIDR or an IP address", c)
+			}
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %v MUST be a CIDR or an IP address", c)
+		}
+		p.nets = append(p.nets, n)
+	}
+	return p, nil
+}
+
+// Trusted returns true if ip is a trusted proxy
+func (p *Proxies) Trusted(ip net.IP) bool {
+	if p == nil || ip == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client of a request from peer
+// remoteAddr with header h
+func (p *Proxies) ClientIP(remoteAddr string, h http.Header) string {
+	peer := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		peer = host
+	}
+	if !p.Trusted(net.ParseIP(peer)) {
+		return peer
+	}
+	var chain []string
+	switch p.header {
+	case "Forwarded":
+		chain = forwardedFor(h["Forwarded"])
+	case "X-Forwarded-For":
+		for _, l := range h["X-Forwarded-For"] {
+			for _, a := range strings.Split(l, ",") {
+				chain = append(chain, strings.TrimSpace(a))
+			}
+		}
+	case "X-Real-Ip":
+		if v := strings.TrimSpace(h.Get("X-Real-Ip")); len(v) > 0 {
+			chain = []string{v}
+		}
+	}
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseAddr(chain[i])
+		if ip == nil {
+			// unknown, obfuscated or malformed - the hop it came from is the
+			// last that is known
+			break
+		}
+		client = ip.String()
+		if !p.Trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor returns the for= parameters of Forwarded headers, in order
+func forwardedFor(v []string) []string {
+	var chain []string
+	for _, l := range v {
+		for _, e := range strings.Split(l, ",") {
+			for _, pair := range strings.Split(e, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					chain = append(chain, strings.Trim(kv[1], "\""))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseAddr parses an address of a forwarding header - an IP address,
+// optionally with a port, IPv6 optionally in brackets
+func parseAddr(a string) net.IP {
+	if ip := net.ParseIP(a); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(a); err == nil {
+		a = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(a, "["), "]"))
+}
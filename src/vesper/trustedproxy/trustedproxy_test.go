@@ -0,0 +1,74 @@
+package trustedproxy
+
+import (
+	"testing"
+	"net/http"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := make(map[string]*Proxies)
+	for _, h := range []string{"forwarded", "x-forwarded-for", "X-Real-Ip"} {
+		p, err := InitObject([]string{"10.0.0.0/8", "2001:db8::1"}, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxies[h] = p
+	}
+	p := proxies["x-forwarded-for"]
+	for _, c := range []struct {
+		remote	string
+		header	http.Header
+		want		string
+	}{
+		// untrusted peer - headers are ignored
+		{"192.0.2.1:5060", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "192.0.2.1"},
+		{"10.0.0.1:5060", http.Header{}, "10.0.0.1"},
+		// rightmost untrusted address is the client
+		{"10.0.0.1:5060", http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.2"}}, "198.51.100.1"},
+		{"10.0.0.1:5060", http.Header{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1"}}, "198.51.100.1"},
+		// all trusted - leftmost
+		{"10.0.0.1:5060", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		// malformed entry stops the walk
+		{"10.0.0.1:5060", http.Header{"X-Forwarded-For": {"198.51.100.1, bogus, 10.0.0.2"}}, "10.0.0.2"},
+		// only the configured header is honored
+		{"10.0.0.1:5060", http.Header{"Forwarded": {"for=192.0.2.60"}}, "10.0.0.1"},
+		{"10.0.0.1:5060", http.Header{"X-Real-Ip": {"198.51.100.7"}}, "10.0.0.1"},
+	} {
+		if got := p.ClientIP(c.remote, c.header); got != c.want {
+			t.Errorf("ClientIP(%v, %v) = %v - want %v", c.remote, c.header, got, c.want)
+		}
+	}
+	for _, c := range []struct {
+		proxyHeader	string
+		remote			string
+		header			http.Header
+		want				string
+	}{
+		{"forwarded", "10.0.0.1:5060", http.Header{"Forwarded": {`for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{"forwarded", "10.0.0.1:5060", http.Header{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"forwarded", "[2001:db8::1]:5060", http.Header{"Forwarded": {"For=192.0.2.60"}}, "192.0.2.60"},
+		// a spoofed X-Forwarded-For is ignored
+		{"forwarded", "10.0.0.1:5060", http.Header{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"198.51.100.1"}}, "192.0.2.60"},
+		{"forwarded", "10.0.0.1:5060", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "10.0.0.1"},
+		{"X-Real-Ip", "10.0.0.1:5060", http.Header{"X-Real-Ip": {"198.51.100.7"}}, "198.51.100.7"},
+	} {
+		if got := proxies[c.proxyHeader].ClientIP(c.remote, c.header); got != c.want {
+			t.Errorf("%v - ClientIP(%v, %v) = %v - want %v", c.proxyHeader, c.remote, c.header, got, c.want)
+		}
+	}
+	var none *Proxies
+	if got := none.ClientIP("10.0.0.1:5060", http.Header{"X-Forwarded-For": {"198.51.100.1"}}); got != "10.0.0.1" {
+		t.Errorf("ClientIP() with no trusted proxies = %v - want 10.0.0.1", got)
+	}
+}
+
+func TestInitObjectInvalid(t *testing.T) {
+	for _, c := range []string{"10.0.0.0/33", "bogus", ""} {
+		if _, err := InitObject([]string{c}, "forwarded"); err == nil {
+			t.Errorf("InitObject(%v) - want error", c)
+		}
+	}
+	if _, err := InitObject([]string{"10.0.0.0/8"}, "x-client-ip"); err == nil {
+		t.Errorf("InitObject() with header x-client-ip - want error")
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/httprouter"
 	"github.com/satori/go.uuid"
 	"vesper/configuration"
+	"vesper/sip"
 	"vesper/stats"
+	"vesper/audit"
 	kitlog "github.com/go-kit/kit/log"
 )
 
@@ -28,16 +30,25 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 	response.Header().Set("Access-Control-Allow-Origin", "*")
 	response.Header().Set("Content-Type", "application/json")
 	clientIP := getClientIP(request)
+	client := clientIdentity(request)
 	traceID := request.Header.Get("Trace-Id")
 	if traceID == "" {
 		traceID = "VESPER-" + uuid.NewV1().String()
 	}
 	response.Header().Set("Trace-Id", traceID)
 	stats.IncrVerificationRequestCount()
+	// every terminal outcome is recorded
+	decision := audit.Entry{TraceID: traceID, Client: requestClient(request, clientIP), Result: "failed"}
+	failed := func(reasonCode string) {
+		decision.ReasonCode = reasonCode
+		recordDecision(response, "verification", start, decision)
+	}
 	var iat int64
 	var origTN string
 	var destTNs []string
 	var identity string
+	var rphIdentity string
+	var resourcePriority []string
 	// verify no query is present
 	// verify the request body is correct
 	var r map[string]interface{}
@@ -45,23 +56,39 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 	switch {
 	case err == io.EOF:
 		// empty request body
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest")
+		failed("VESPER-4100")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest")
 		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4100", "empty request body", nil)
 		return
 	case err != nil :
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest")
+		failed("VESPER-4102")
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest")
 		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4102", "unable to parse request body", nil)
 		return
 	default:
 		// err == nil
 		if !reflect.ValueOf(r["dest"]).IsValid() || !reflect.ValueOf(r["iat"]).IsValid() || !reflect.ValueOf(r["orig"]).IsValid() || !reflect.ValueOf(r["identity"]).IsValid() {
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+			failed("VESPER-4103")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4103", "one or more of the require fields missing in request payload", nil)
 			return
 		}
 		// request payload should not contain more than the expected fields
-		if len(r) != 4 {
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+		// date (SIP Date header) is optional
+		// rphIdentity and resourcePriority (RFC 8443) are optional
+		expectedFields := 4
+		if reflect.ValueOf(r["date"]).IsValid() {
+			expectedFields++
+		}
+		if reflect.ValueOf(r["rphIdentity"]).IsValid() {
+			expectedFields++
+		}
+		if reflect.ValueOf(r["resourcePriority"]).IsValid() {
+			expectedFields++
+		}
+		if len(r) != expectedFields {
+			failed("VESPER-4104")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4104", "request payload has more than expected fields", nil)
 			return
 		}
@@ -71,27 +98,78 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 		case reflect.Float64:
 			iat = int64(reflect.ValueOf(r["iat"]).Float())
 			if iat <= 0 {
-				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+				failed("VESPER-4105")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4105", "iat value in request payload is <= 0", nil)
 				return
 			}
 		default:
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+			failed("VESPER-4106")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4106", "iat field in request payload MUST be a number", nil)
 			return
 		}
 
+		// date ...
+		// if present, iat of the call is taken from the SIP Date header instead
+		if reflect.ValueOf(r["date"]).IsValid() {
+			switch reflect.TypeOf(r["date"]).Kind() {
+			case reflect.String:
+				d, err := sip.ParseDate(reflect.ValueOf(r["date"]).String())
+				if err != nil {
+					failed("VESPER-4172")
+					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+					serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4172", fmt.Sprintf("%v - date field in request payload is not a valid SIP Date", err), nil)
+					return
+				}
+				iat = d.Unix()
+			default:
+				failed("VESPER-4173")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4173", "date field in request payload MUST be a string", nil)
+				return
+			}
+		}
+
+		// rphIdentity and resourcePriority ...
+		// both or none MUST be present
+		if reflect.ValueOf(r["rphIdentity"]).IsValid() != reflect.ValueOf(r["resourcePriority"]).IsValid() {
+			failed("VESPER-4195")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4195", "rphIdentity and resourcePriority fields MUST both be present in request payload", nil)
+			return
+		}
+		if reflect.ValueOf(r["rphIdentity"]).IsValid() {
+			v, ok := r["rphIdentity"].(string)
+			if !ok || len(strings.TrimSpace(v)) == 0 {
+				failed("VESPER-4196")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4196", "rphIdentity field in request payload MUST be a non-empty string", nil)
+				return
+			}
+			rphIdentity = v
+			resourcePriority, err = resourcePriorityValues(r["resourcePriority"])
+			if err != nil {
+				failed("VESPER-4197")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4197", err.Error(), nil)
+				return
+			}
+		}
+
 		// identity ...
 		switch reflect.TypeOf(r["identity"]).Kind() {
 		case reflect.String:
 			identity = reflect.ValueOf(r["identity"]).String()
 			if len(strings.TrimSpace(identity)) == 0 {
-				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+				failed("VESPER-4107")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4107", "identity field in request payload is an empty string", nil)
 				return
 			}
 		default:
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+			failed("VESPER-4108")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4108", "identity field in request payload MUST be a string", nil)
 			return
 		}
@@ -102,17 +180,20 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 			origKeys := reflect.ValueOf(r["orig"]).MapKeys()
 			switch {
 			case len(origKeys) == 0 :
-				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+				failed("VESPER-4109")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4109", "orig in request payload is an empty object", nil)
 				return
 			case len(origKeys) > 1 :
-				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+				failed("VESPER-4110")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4110", "orig in request payload should contain only one field", nil)
 				return
 			default:
 				// field should be "tn" only
 				if origKeys[0].String() != "tn" {
-					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+					failed("VESPER-4111")
+					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 					serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4111", "orig in request payload does not contain field \"tn\"", nil)
 					return
 				}
@@ -122,25 +203,29 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 					// empty array object
 					ot := reflect.ValueOf(r["orig"].(map[string]interface{})["tn"])
 					if ot.Len() == 0 {
-						lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+						failed("VESPER-4112")
+						lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 						serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4112", "orig tn in request payload is an empty array", nil)
 						return
 					}
 					// contains empty string
 					if ot.Len() != 1 {
-						lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+						failed("VESPER-4113")
+						lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 						serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4113", "orig tn array contains more than one element in request payload", nil)
 						return
 					}
 					for i := 0; i < ot.Len(); i++ {
 						tn := ot.Index(i).Elem()
 						if tn.Kind() != reflect.String {
-							lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+							failed("VESPER-4114")
+							lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 							serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4114", "orig tn in request payload is not a string", nil)
 							return
 						} else {
 							if len(strings.TrimSpace(tn.String())) == 0 {
-								lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+								failed("VESPER-4115")
+								lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 								serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4115", "orig tn in request payload is an empty string", nil)
 								return
 							}
@@ -149,13 +234,15 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 						}
 					}
 				default:
-					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+					failed("VESPER-4116")
+					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 					serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4116", "orig tn in request payload is not an array", nil)
 					return
 				}
 			}
 		default:
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+			failed("VESPER-4117")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4117", "orig field in request payload MUST be a JSON object", nil)
 			return
 		}
@@ -166,17 +253,20 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 			destKeys := reflect.ValueOf(r["dest"]).MapKeys()
 			switch {
 			case len(destKeys) == 0 :
-				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+				failed("VESPER-4118")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4118", "dest in request payload is an empty object", nil)
 				return
 			case len(destKeys) > 1 :
-				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+				failed("VESPER-4119")
+				lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 				serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4119", "dest in request payload should contain only one field", nil)
 				return
 			default:
 				// field should be "tn" only
 				if destKeys[0].String() != "tn" {
-					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+					failed("VESPER-4120")
+					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 					serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4120", "dest in request payload does not contain field \"tn\"", nil)
 					return
 				}
@@ -186,7 +276,8 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 					// empty array object
 					dt := reflect.ValueOf(r["dest"].(map[string]interface{})["tn"])
 					if dt.Len() == 0 {
-						lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+						failed("VESPER-4121")
+						lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 						serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4121", "dest tn in request payload is an empty array", nil)
 						return
 					}
@@ -194,12 +285,14 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 					for i := 0; i < dt.Len(); i++ {
 						tn := dt.Index(i).Elem()
 						if tn.Kind() != reflect.String {
-							lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+							failed("VESPER-4122")
+							lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 							serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4122", "one or more dest tns in request payload is not a string", nil)
 							return
 						} else {
 							if len(strings.TrimSpace(tn.String())) == 0 {
-								lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+								failed("VESPER-4123")
+								lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 								serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4123", "one or more dest tns in request payload is an empty string", nil)
 								return
 							}
@@ -208,130 +301,182 @@ func verifyRequest(response http.ResponseWriter, request *http.Request, _ httpro
 						}
 					}
 				default:
-					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+					failed("VESPER-4124")
+					lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 					serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4124", "dest tn in request payload is not an array", nil)
 					return
 				}
 			}
 		default:
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
+			failed("VESPER-4125")
+			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
 			serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4125", "dest field in request payload MUST be a JSON object", nil)
 			return
 		}
 	}
-	logInfo("type", "verifyRequest", "traceID", traceID, "module", "verifyRequest", "requestPayload", r)
+	if errCode, err := validateNumbering(origTN, destTNs, verificationOrigNumbering, verificationDestNumbering); err != nil {
+		failed(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+	logInfo("type", "verifyRequest", "traceID", traceID, "client", client, "module", "verifyRequest", "requestPayload", r)
+
+	decision.Orig, decision.Dest, decision.Iat = origTN, destTNs, iat
+	pp, errCode, err := validateIdentity(identity, origTN, destTNs, iat, start.Unix(), traceID, clientIP)
+	if err != nil {
+		failed(errCode)
+		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "client", client, "module", "verifyRequest", "requestPayload", r)
+		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
+		return
+	}
+
+	resp := make(map[string]interface{})
+	resp["verificationResponse"] = make(map[string]interface{})
+	// verify signature
+	code, httpCode, err := verifySignature(pp.x5u, pp.token, configuration.ConfigurationInstance().VerifyRootCA)
+	if err != nil {
+		failed(code)
+		lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "verifyRequest", "message", fmt.Sprintf("%v - error in verifying signature", err), "resp", resp)
+		resp["verificationResponse"].(map[string]interface{})["reasonCode"] = code
+		resp["verificationResponse"].(map[string]interface{})["reasonString"] = err.Error()
+		serveHttpResponse(start, response, lg, httpCode, "error", traceID, "", "", resp)
+		return
+	}
+	// the claims are attributed to the signer only once the signature is verified
+	decision.Attest, _ = pp.claims["attest"].(string)
+	decision.OrigID, _ = pp.claims["origid"].(string)
+	decision.X5u = pp.x5u
+	fail, code, err := dnoVerification(origTN)
+	decision.ReasonCode = code
+	if fail {
+		recordDecision(response, "verification", start, decision)
+		lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "verifyRequest", "message", err.Error(), "resp", resp)
+		resp["verificationResponse"].(map[string]interface{})["reasonCode"] = code
+		resp["verificationResponse"].(map[string]interface{})["reasonString"] = err.Error()
+		serveHttpResponse(start, response, lg, http.StatusForbidden, "error", traceID, "", "", resp)
+		return
+	}
+	if err != nil {
+		// the call is verified, but flagged
+		resp["verificationResponse"].(map[string]interface{})["dno"] = ErrorBlob{ReasonCode: code, ReasonString: err.Error()}
+	}
+	lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "verifyRequest")
+	resp["verificationResponse"].(map[string]interface{})["dest"] = r["dest"]
+	resp["verificationResponse"].(map[string]interface{})["iat"] = r["iat"]
+	resp["verificationResponse"].(map[string]interface{})["orig"] = r["orig"]
+	resp["verificationResponse"].(map[string]interface{})["jwt"] = make(map[string]interface{})
+	resp["verificationResponse"].(map[string]interface{})["jwt"].(map[string]interface{})["header"] = pp.header
+	resp["verificationResponse"].(map[string]interface{})["jwt"].(map[string]interface{})["claims"] = pp.claims
+	if owner := origIDOwner(pp.x5u, pp.claims); owner != nil {
+		// origid was issued by vesper
+		resp["verificationResponse"].(map[string]interface{})["origidOwner"] = owner
+	}
+	// the post-verify hook may add to the response (e.g. a reputation score), if configured
+	if code, err := applyPostVerifyHook(traceID, requestClient(request, clientIP), resp["verificationResponse"].(map[string]interface{}), origTN, destTNs, iat, decision.Attest, decision.OrigID, pp.x5u); err != nil {
+		failed(code)
+		resp["verificationResponse"] = make(map[string]interface{})
+		lg := kitlog.With(glogger, "type", "requestResponseTime", "client", client, "module", "verifyRequest", "message", err.Error(), "resp", resp)
+		resp["verificationResponse"].(map[string]interface{})["reasonCode"] = code
+		resp["verificationResponse"].(map[string]interface{})["reasonString"] = err.Error()
+		serveHttpResponse(start, response, lg, http.StatusServiceUnavailable, "error", traceID, "", "", resp)
+		return
+	}
+	// the rph PASSporT is verified after the post-verify hook, which can still fail
+	// verification, so that it is not cached as replayed
+	if len(rphIdentity) > 0 {
+		// the rph PASSporT is verified independently - the result does not fail verification
+		resp["verificationResponse"].(map[string]interface{})["rph"] = verifyRph(rphIdentity, resourcePriority, origTN, destTNs, iat, start.Unix(), traceID, clientIP)
+	}
+	// cache claims in identity header to validate replay attacks in future
+	// note that caching happens only if verification is successful
+	replayAttackCache.Add(pp.iat, pp.claimsString)
+	decision.Result = "verified"
+	recordDecision(response, "verification", start, decision)
+	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
+}
+
+// passport - identity header validated by validateIdentity
+type passport struct {
+	token					string		// JWT
+	x5u						string
+	header				map[string]interface{}
+	claims				map[string]interface{}
+	iat						int64			// iat in claims
+	claimsString	string		// stringified claims - used to detect replay attacks
+}
 
+// validateIdentity - validates an identity header against orig TN, dest TNs and
+// iat of the call. Everything but the signature is validated.
+// t is the current time, in seconds
+func validateIdentity(identity, origTN string, destTNs []string, iat, t int64, traceID, clientIP string) (*passport, string, error) {
 	// first extract the JWT in identity string
 	token := strings.Split(identity, ";")
 	// validate identity field
 	if len(token) < 2 {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
-		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4126", "Identity field does not contain all the relevant parameters in request payload", nil)
-		return
+		return nil, "VESPER-4126", fmt.Errorf("Identity field does not contain all the relevant parameters in request payload")
 	}
 	// JWT
 	jwt := strings.Split(token[0], ".")
 	if len(jwt) != 3 {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
-		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4127", "Invalid JWT format in identity field in request payload", nil)
-		return
+		return nil, "VESPER-4127", fmt.Errorf("Invalid JWT format in identity field in request payload")
 	}
 	// Info parameter
 	if !regexInfo.MatchString(token[1]) {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
-		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4128", "Invalid info parameter in identity field in request payload", nil)
-		return
+		return nil, "VESPER-4128", fmt.Errorf("Invalid info parameter in identity field in request payload")
 	}
 	info := token[1][6:len(token[1])-1]
-	
+
 	// extract header from JWT for validation
 	// also get the x5u information required to verify signature
-	x5u, hh, err := validateHeader(start, response, traceID, clientIP, token[0])
+	x5u, hh, errCode, err := validateHeader(token[0], "shaken")
 	if err != nil {
-		// function writes to http.ResponseWriter directly
-		return
+		return nil, errCode, err
 	}
 	// compare x5u and info
 	if x5u != info {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
-		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4131", "x5u value in JWT header does not match info parameter in identity field in request payload", nil)
-		return
-	}	
-	
+		return nil, "VESPER-4131", fmt.Errorf("x5u value in JWT header does not match info parameter in identity field in request payload")
+	}
+
 	// extract claims from JWT for validation
-	orderedMap, iatInClaims, err := validateClaims(start, response, traceID, clientIP, token[0], origTN, destTNs, iat, start.Unix())
+	orderedMap, iatInClaims, errCode, err := validateClaims(traceID, clientIP, token[0], origTN, destTNs, iat, t)
 	if err != nil {
-		// function writes to http.ResponseWriter directly
-		return
+		return nil, errCode, err
 	}
-	
+
 	// replay attack validation
 	// convert ordered map to json string and check for replay attacks
 	claimsString, err := json.Marshal(orderedMap)
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
-		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4168", fmt.Sprintf("%v - unable to validate replay attack", err), nil)
-		return
+		return nil, "VESPER-4168", fmt.Errorf("%v - unable to validate replay attack", err)
 	}
 	if ok := replayAttackCache.IsPresent(iatInClaims, string(claimsString)); ok {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "verifyRequest", "requestPayload", r)
-		serveHttpResponse(start, response, lg, http.StatusBadRequest, "error", traceID, "VESPER-4169", fmt.Sprintf("possible replay attack - identity header repeated - JWT claims (%+v) is cached", string(claimsString)), nil)
-		return
+		return nil, "VESPER-4169", fmt.Errorf("possible replay attack - identity header repeated - JWT claims (%+v) is cached", string(claimsString))
 	}
-
-	resp := make(map[string]interface{})
-	resp["verificationResponse"] = make(map[string]interface{})
-	// verify signature
-	code, errCode, err := verifySignature(x5u, token[0], configuration.ConfigurationInstance().VerifyRootCA)
-	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestResponseTime", "module", "verifyRequest", "message", fmt.Sprintf("%v - error in verifying signature", err), "resp", resp)
-		resp["verificationResponse"].(map[string]interface{})["reasonCode"] = code
-		resp["verificationResponse"].(map[string]interface{})["reasonString"] = err.Error()
-		serveHttpResponse(start, response, lg, errCode, "error", traceID, "", "", resp)
-		return
-	}
-	lg := kitlog.With(glogger, "type", "requestResponseTime", "module", "verifyRequest")
-	resp["verificationResponse"].(map[string]interface{})["dest"] = r["dest"]
-	resp["verificationResponse"].(map[string]interface{})["iat"] = r["iat"]
-	resp["verificationResponse"].(map[string]interface{})["orig"] = r["orig"]
-	resp["verificationResponse"].(map[string]interface{})["jwt"] = make(map[string]interface{})
-	resp["verificationResponse"].(map[string]interface{})["jwt"].(map[string]interface{})["header"] = hh
-	resp["verificationResponse"].(map[string]interface{})["jwt"].(map[string]interface{})["claims"] = orderedMap
-	// cache claims in identity header to validate replay attacks in future
-	// note that caching happens only if verification is successful
-	replayAttackCache.Add(iatInClaims, string(claimsString))
-	serveHttpResponse(start, response, lg, http.StatusOK, "info", traceID, "", "", resp)
+	return &passport{token: token[0], x5u: x5u, header: hh, claims: orderedMap, iat: iatInClaims, claimsString: string(claimsString)}, "", nil
 }
 
-// validateHeader - validate JWT header
+// validateHeader - validate JWT header of a PASSporT of type ppt
 // check if expected key-values exist
-func validateHeader(start time.Time, w http.ResponseWriter, traceID, clientIP, j string) (string, map[string]interface{}, error) {
+func validateHeader(j, ppt string) (string, map[string]interface{}, string, error) {
 	var x5u string
 	s := strings.Split(j, ".")
 	// s[0] is the encoded header
 	h, err := base64Decode(s[0])
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "jwtHeader", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4150", fmt.Sprintf("%v - unable to base64 url decode header part of JWT", err), nil)
-		return "", nil, err
+		return "", nil, "VESPER-4150", fmt.Errorf("%v - unable to base64 url decode header part of JWT", err)
 	}
 	m := make(map[string]interface{})
 	if err := json.Unmarshal(h, &m); err != nil {
-		lg := kitlog.With(glogger, "type", "jwtHeader", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4151", fmt.Sprintf("%v - unable to unmarshal decoded header to map[string]interface{}", err), nil)
-		return "", nil, err
+		return "", nil, "VESPER-4151", fmt.Errorf("%v - unable to unmarshal decoded header to map[string]interface{}", err)
 	}
 	if len(m) != 4 {
 		// not the expected number of fields in header
-		lg := kitlog.With(glogger, "type", "jwtHeader", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4132", "decoded header does not have the expected number of fields (4)", nil)
-		return "", nil, fmt.Errorf("decoded header does not have the expected number of fields (4)")
+		return "", nil, "VESPER-4132", fmt.Errorf("decoded header does not have the expected number of fields (4)")
 	}
 	// err == nil
 	if !reflect.ValueOf(m["alg"]).IsValid() || !reflect.ValueOf(m["ppt"]).IsValid() || !reflect.ValueOf(m["typ"]).IsValid() || !reflect.ValueOf(m["x5u"]).IsValid() {
-		lg := kitlog.With(glogger, "type", "jwtHeader", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4133", "one or more of the required fields missing in JWT header", nil)
-		return "", nil, fmt.Errorf("one or more of the required fields missing in JWT header")
+		return "", nil, "VESPER-4133", fmt.Errorf("one or more of the required fields missing in JWT header")
 	}
 
 	// alg ...
@@ -339,29 +484,20 @@ func validateHeader(start time.Time, w http.ResponseWriter, traceID, clientIP, j
 	case reflect.String:
 		alg := reflect.ValueOf(m["alg"]).String()
 		if alg != "ES256" {
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-			serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4134", "alg field value in JWT header is not \"ES256\"", nil)
-			return "", nil, fmt.Errorf("alg field value in JWT header is not \"ES256\"")
+			return "", nil, "VESPER-4134", fmt.Errorf("alg field value in JWT header is not \"ES256\"")
 		}
 	default:
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4135", "alg field in JWT header is not a string", nil)
-		return "", nil, fmt.Errorf("alg field value in JWT header is not a string")
+		return "", nil, "VESPER-4135", fmt.Errorf("alg field value in JWT header is not a string")
 	}
 
 	// ppt ...
 	switch reflect.TypeOf(m["ppt"]).Kind() {
 	case reflect.String:
-		ppt := reflect.ValueOf(m["ppt"]).String()
-		if ppt != "shaken" {
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-			serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4136", "ppt field value in JWT header is not \"shaken\"", nil)
-			return "", nil, fmt.Errorf("ppt field value in JWT header is not \"shaken\"")
+		if reflect.ValueOf(m["ppt"]).String() != ppt {
+			return "", nil, "VESPER-4136", fmt.Errorf("ppt field value in JWT header is not \"%v\"", ppt)
 		}
 	default:
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4137", "ppt field value in JWT header is not a string", nil)
-		return "", nil, fmt.Errorf("ppt field value in JWT header is not a string")
+		return "", nil, "VESPER-4137", fmt.Errorf("ppt field value in JWT header is not a string")
 	}
 
 	// typ ...
@@ -369,14 +505,10 @@ func validateHeader(start time.Time, w http.ResponseWriter, traceID, clientIP, j
 	case reflect.String:
 		typ := reflect.ValueOf(m["typ"]).String()
 		if typ != "passport" {
-			lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-			serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4138", "typ field value in JWT header is not \"passport\"", nil)
-			return "", nil, fmt.Errorf("typ field value in JWT header is not \"passport\"")
+			return "", nil, "VESPER-4138", fmt.Errorf("typ field value in JWT header is not \"passport\"")
 		}
 	default:
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4139", "typ field value in JWT header is not a string", nil)
-		return "", nil, fmt.Errorf("typ field value in JWT header is not a string")
+		return "", nil, "VESPER-4139", fmt.Errorf("typ field value in JWT header is not a string")
 	}
 
 	// x5u ...
@@ -384,44 +516,52 @@ func validateHeader(start time.Time, w http.ResponseWriter, traceID, clientIP, j
 	case reflect.String:
 		x5u = reflect.ValueOf(m["x5u"]).String()
 	default:
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateHeader")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4140", "x5u field value in JWT header is not a string", nil)
-		return "", nil, fmt.Errorf("x5u field value in JWT header is not a string")
+		return "", nil, "VESPER-4140", fmt.Errorf("x5u field value in JWT header is not a string")
 	}
 
-	return x5u, m, nil
+	return x5u, m, "", nil
 }
 
 // validateClaims - validate JWT claims
 // check if expected key-values exist
-func validateClaims(start time.Time, w http.ResponseWriter, traceID, clientIP, j, oTN string, dTNs []string, iat, t int64) (map[string]interface{}, int64, error) {
+func validateClaims(traceID, clientIP, j, oTN string, dTNs []string, iat, t int64) (map[string]interface{}, int64, string, error) {
 	s := strings.Split(j, ".")
 	// s[0] is the encoded claims
 	c, err := base64Decode(s[1])
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateClaims")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4152", fmt.Sprintf("%v - unable to base64 url decode claims part of JWT", err), nil)
-		return nil, 0, err
+		return nil, 0, "VESPER-4152", fmt.Errorf("%v - unable to base64 url decode claims part of JWT", err)
 	}
 	m := make(map[string]interface{})
 	if err := json.Unmarshal(c, &m); err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateClaims")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4153", fmt.Sprintf("%v - unable to unmarshal decoded claims to map[string]interface{}", err), nil)
-		return nil, 0, err
+		return nil, 0, "VESPER-4153", fmt.Errorf("%v - unable to unmarshal decoded claims to map[string]interface{}", err)
 	}
-	//origTNInClaims, iatInClaims, destTNsInClaims, err := validatePayload(w, m, traceID, clientIP)
 	orderedMap, origTNInClaims, iatInClaims, destTNsInClaims, _, errCode, err := validatePayload(m, traceID, clientIP)
 	if err != nil {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateClaims")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, errCode, err.Error(), nil)
-		return nil, 0, err
+		return nil, 0, errCode, err
+	}
+	if errCode, err := matchClaims(m, origTNInClaims, destTNsInClaims, iatInClaims, oTN, dTNs, iat, t); err != nil {
+		return nil, 0, errCode, err
+	}
+	return orderedMap, iatInClaims, "", nil
+}
+
+// validateIatFreshness - iat in JWT claims must be neither stale nor in the
+// future, at time t
+func validateIatFreshness(iatInClaims, t int64) (string, error) {
+	if (t > (iatInClaims + configuration.ConfigurationInstance().ValidIatPeriod)) {
+		return "VESPER-4167", fmt.Errorf("iat value (%v seconds) in JWT claims indicates stale date", iatInClaims)
 	}
+	if (iatInClaims > (t + configuration.ConfigurationInstance().IatFutureTolerance)) {
+		return "VESPER-4171", fmt.Errorf("iat value (%v seconds) in JWT claims is in the future", iatInClaims)
+	}
+	return "", nil
+}
+
+// matchClaims - orig TN, dest TNs and iat in JWT claims m must match the call
+func matchClaims(m map[string]interface{}, origTNInClaims string, destTNsInClaims []string, iatInClaims int64, oTN string, dTNs []string, iat, t int64) (string, error) {
 	// validate orig TN
 	if origTNInClaims != oTN {
-		es := fmt.Sprintf("orig TN %v in request payload does not match orig TN in JWT claims (%+v)", oTN, m)
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateClaims")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4154", es, nil)
-		return nil, 0, fmt.Errorf("%v", es)
+		return "VESPER-4154", fmt.Errorf("orig TN %v in request payload does not match orig TN in JWT claims (%+v)", oTN, m)
 	}
 	// validate dest TNs
 	isMatch := false
@@ -441,17 +581,16 @@ func validateClaims(start time.Time, w http.ResponseWriter, traceID, clientIP, j
 		}
 	}
 	if !isMatch {
-		es := fmt.Sprintf("dest TNs %+v in request payload does not match dest TNs in JWT claims (%+v)", dTNs, m)
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateClaims")
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4155", es, nil)
-		return nil, 0, fmt.Errorf("%v", es)
+		return "VESPER-4155", fmt.Errorf("dest TNs %+v in request payload does not match dest TNs in JWT claims (%+v)", dTNs, m)
 	}
 	// iat in JWT validation
-	if (t > (iatInClaims + configuration.ConfigurationInstance().ValidIatPeriod)) {
-		lg := kitlog.With(glogger, "type", "requestPayload", "clientIP", clientIP, "module", "validateClaims")
-		es := fmt.Sprintf("iat value (%v seconds) in JWT claims indicates stale date", iatInClaims)
-		serveHttpResponse(start, w, lg, http.StatusBadRequest, "error", traceID, "VESPER-4167", es, nil)
-		return nil, 0, fmt.Errorf("%v", es)
+	if errCode, err := validateIatFreshness(iatInClaims, t); err != nil {
+		return errCode, err
+	}
+	// RFC 8224 section 4.1 - iat of the call (Date header) and iat in JWT claims
+	// must be close enough
+	if d := iat - iatInClaims; d > configuration.ConfigurationInstance().IatDateTolerance || -d > configuration.ConfigurationInstance().IatDateTolerance {
+		return "VESPER-4170", fmt.Errorf("iat value (%v seconds) in JWT claims differs from Date/iat (%v seconds) in request by more than %v seconds", iatInClaims, iat, configuration.ConfigurationInstance().IatDateTolerance)
 	}
-	return orderedMap, iatInClaims, nil
+	return "", nil
 }
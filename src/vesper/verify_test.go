@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+	"strings"
+	"testing"
+	"vesper/configuration"
+)
+
+func TestValidateClaims(t *testing.T) {
+	s := newTestSigner(t, "https://cert.example.com/claims.pem")
+	c := configuration.ConfigurationInstance()
+	now := time.Now().Unix()
+	orig, dest := "12155551212", []string{"12155551213"}
+	for _, tc := range []struct {
+		name				string
+		iatInClaims	int64
+		orig				string
+		dest				[]string
+		iat					int64
+		errCode			string
+	}{
+		{"match", now, orig, dest, now, ""},
+		{"Date within tolerance", now, orig, dest, now - c.IatDateTolerance, ""},
+		{"iat within future tolerance", now + c.IatFutureTolerance, orig, dest, now + c.IatFutureTolerance, ""},
+		{"orig", now, "12155551299", dest, now, "VESPER-4154"},
+		{"dest", now, orig, []string{"12155551299"}, now, "VESPER-4155"},
+		{"more dest", now, orig, []string{"12155551213", "12155551214"}, now, "VESPER-4155"},
+		{"stale iat", now - c.ValidIatPeriod - 1, orig, dest, now - c.ValidIatPeriod - 1, "VESPER-4167"},
+		{"future iat", now + c.IatFutureTolerance + 1, orig, dest, now + c.IatFutureTolerance + 1, "VESPER-4171"},
+		{"Date before iat", now, orig, dest, now - c.IatDateTolerance - 1, "VESPER-4170"},
+		{"Date after iat", now - 1, orig, dest, now + c.IatDateTolerance, "VESPER-4170"},
+	} {
+		identity := s.sign(t, "shaken", testClaims(orig, dest, tc.iatInClaims, map[string]interface{}{"attest": "A", "origid": "de305d54-75b4-431b-adb2-eb6b9e546014"}))
+		claims, iat, errCode, err := validateClaims("trace", "127.0.0.1", strings.Split(identity, ";")[0], tc.orig, tc.dest, tc.iat, now)
+		if errCode != tc.errCode {
+			t.Errorf("%v: reason code = %v (%v) - want %v", tc.name, errCode, err, tc.errCode)
+			continue
+		}
+		if len(tc.errCode) == 0 && (iat != tc.iatInClaims || claims["attest"] != "A") {
+			t.Errorf("%v: claims = %+v, iat %v - want iat %v", tc.name, claims, iat, tc.iatInClaims)
+		}
+	}
+}